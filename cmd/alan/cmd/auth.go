@@ -0,0 +1,226 @@
+// Copyright (C) 2018 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/spf13/pflag"
+
+	pkgalan "github.com/nlamirault/alan/pkg/alan"
+	pkgcmd "github.com/nlamirault/alan/pkg/cmd"
+	"github.com/nlamirault/alan/pkg/vault"
+)
+
+const (
+	envVaultUsername = "ALAN_VAULT_USERNAME"
+	envVaultPassword = "ALAN_VAULT_PASSWORD"
+	envVaultRoleID   = "ALAN_VAULT_ROLE_ID"
+	envVaultSecretID = "ALAN_VAULT_SECRET_ID"
+	envVaultRole     = "ALAN_VAULT_ROLE"
+	envVaultMount    = "ALAN_VAULT_MOUNT"
+	envVaultPrefix   = "ALAN_VAULT_PREFIX"
+)
+
+var (
+	vaultMount          string
+	vaultPrefix         string
+	vaultCACert         string
+	vaultCAPath         string
+	vaultClientCert     string
+	vaultClientKey      string
+	vaultTLSServerName  string
+	vaultTLSSkipVerify  bool
+	authMethod          string
+	authMount           string
+	authToken           string
+	authUsername        string
+	authPassword        string
+	authPasswordFile    string
+	authRoleID          string
+	authRoleIDFile      string
+	authSecretID        string
+	authSecretIDFile    string
+	authSecretIDWrapped bool
+	authCertName        string
+	authRole            string
+	authJWTFile         string
+)
+
+// addVaultFlags setup the flags used to connect to the Vault server
+func addVaultFlags(flags *pflag.FlagSet) {
+	defaults := vault.NewConfig()
+	flags.StringVar(&vaultAddress, "vault", defaults.Address, "Vault address (VAULT_ADDR)")
+	flags.StringVar(&vaultCACert, "ca-cert", defaults.CACert, "PEM-encoded CA certificate file to verify the Vault server (VAULT_CACERT)")
+	flags.StringVar(&vaultCAPath, "ca-path", defaults.CAPath, "Directory of PEM-encoded CA certificate files (VAULT_CAPATH)")
+	flags.StringVar(&vaultClientCert, "client-cert", defaults.ClientCert, "PEM-encoded client certificate for TLS authentication (VAULT_CLIENT_CERT)")
+	flags.StringVar(&vaultClientKey, "client-key", defaults.ClientKey, "PEM-encoded private key of the client certificate (VAULT_CLIENT_KEY)")
+	flags.StringVar(&vaultTLSServerName, "tls-server-name", defaults.TLSServerName, "Name to use as the SNI host when connecting via TLS (VAULT_TLS_SERVER_NAME)")
+	flags.BoolVar(&vaultTLSSkipVerify, "tls-skip-verify", defaults.TLSSkipVerify, "Disable verification of the Vault server certificate. Insecure (VAULT_SKIP_VERIFY)")
+	flags.StringVar(&vaultMount, "mount", envOrDefault(envVaultMount, vault.DefaultMount), "Mount path of the KV secrets engine")
+	flags.StringVar(&vaultPrefix, "prefix", envOrDefault(envVaultPrefix, vault.DefaultPrefix),
+		"Path of the secrets into the mount. Can use {{.Username}}, {{.DisplayName}}, {{.EntityID}} or {{.EntityName}}")
+	flags.StringVar(&authMethod, "auth-method", vault.AuthToken,
+		fmt.Sprintf("Vault authentication method (%s)", strings.Join(vault.AuthMethods, ", ")))
+	flags.StringVar(&authMount, "auth-mount", "", "Mount path of the authentication method (default to the method name)")
+	flags.StringVar(&authToken, "auth-token", "", "Vault token (default to VAULT_TOKEN or ~/.vault-token)")
+	flags.StringVar(&authUsername, "auth-username", "", "Username for userpass or ldap authentication")
+	flags.StringVar(&authPassword, "auth-password", "", "Password for userpass or ldap authentication")
+	flags.StringVar(&authPasswordFile, "auth-password-file", "", "File containing the password for userpass or ldap authentication")
+	flags.StringVar(&authRoleID, "auth-role-id", "", "Role ID for approle authentication")
+	flags.StringVar(&authRoleIDFile, "auth-role-id-file", "", "File containing the role ID for approle authentication")
+	flags.StringVar(&authSecretID, "auth-secret-id", "", "Secret ID for approle authentication")
+	flags.StringVar(&authSecretIDFile, "auth-secret-id-file", "", "File containing the secret ID for approle authentication")
+	flags.BoolVar(&authSecretIDWrapped, "auth-secret-id-wrapped", false, "The approle secret ID is a response-wrapping token")
+	flags.StringVar(&authCertName, "auth-cert-name", "", "Certificate role name for cert authentication")
+	flags.StringVar(&authRole, "auth-role", "", "Role for kubernetes authentication")
+	flags.StringVar(&authJWTFile, "auth-jwt-file", vault.DefaultKubernetesTokenPath, "Service account token for kubernetes authentication")
+}
+
+// newVaultClient creates the Vault client using the authentication flags
+func newVaultClient() (*vault.Client, error) {
+	return newVaultClientFor(vaultMount, vaultPrefix)
+}
+
+// newVaultClientFor creates the Vault client for the given mount and prefix
+func newVaultClientFor(mount string, prefix string) (*vault.Client, error) {
+	auth, err := newAuthenticator()
+	if err != nil {
+		return nil, err
+	}
+	config := vault.NewConfig()
+	config.Address = vaultAddress
+	config.Mount = mount
+	config.Prefix = prefix
+	config.CACert = vaultCACert
+	config.CAPath = vaultCAPath
+	config.ClientCert = vaultClientCert
+	config.ClientKey = vaultClientKey
+	config.TLSServerName = vaultTLSServerName
+	config.TLSSkipVerify = vaultTLSSkipVerify
+	return vault.NewClient(config, auth)
+}
+
+// newVaultProvider creates a provider for the Vault client, using the mapping rules of the profile
+func newVaultProvider(client *vault.Client, cas bool) pkgalan.Provider {
+	return pkgalan.NewMappedProvider(vault.NewProvider(client, cas), mappingRules())
+}
+
+func newAuthenticator() (vault.Authenticator, error) {
+	switch authMethod {
+	case vault.AuthToken:
+		return &vault.TokenAuth{
+			Token: authToken,
+		}, nil
+
+	case vault.AuthUserpass, vault.AuthLDAP:
+		username, err := readCredential(authUsername, envVaultUsername, "", "")
+		if err != nil {
+			return nil, err
+		}
+		if len(username) == 0 {
+			return nil, fmt.Errorf("missing username for %s authentication", authMethod)
+		}
+		password, err := readCredential(authPassword, envVaultPassword, authPasswordFile,
+			fmt.Sprintf("Please input the Vault password for %s: ", username))
+		if err != nil {
+			return nil, err
+		}
+		if authMethod == vault.AuthLDAP {
+			return &vault.LDAPAuth{
+				Mount:    authMount,
+				Username: username,
+				Password: password,
+			}, nil
+		}
+		return &vault.UserpassAuth{
+			Mount:    authMount,
+			Username: username,
+			Password: password,
+		}, nil
+
+	case vault.AuthAppRole:
+		roleID, err := readCredential(authRoleID, envVaultRoleID, authRoleIDFile, "")
+		if err != nil {
+			return nil, err
+		}
+		secretID, err := readCredential(authSecretID, envVaultSecretID, authSecretIDFile, "")
+		if err != nil {
+			return nil, err
+		}
+		return &vault.AppRoleAuth{
+			Mount:    authMount,
+			RoleID:   roleID,
+			SecretID: secretID,
+			Wrapped:  authSecretIDWrapped,
+		}, nil
+
+	case vault.AuthCert:
+		return &vault.CertAuth{
+			Mount: authMount,
+			Name:  authCertName,
+		}, nil
+
+	case vault.AuthKubernetes:
+		role, err := readCredential(authRole, envVaultRole, "", "")
+		if err != nil {
+			return nil, err
+		}
+		return &vault.KubernetesAuth{
+			Mount:     authMount,
+			Role:      role,
+			TokenPath: authJWTFile,
+		}, nil
+	}
+	return nil, fmt.Errorf("unsupported authentication method: %s", authMethod)
+}
+
+// readCredential retrieve a credential from a flag value, a file, an environment
+// variable or ask it to the user if a prompt is given
+func readCredential(value string, envVar string, filename string, prompt string) (string, error) {
+	if len(value) > 0 {
+		return value, nil
+	}
+	if len(filename) > 0 {
+		data, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(data)), nil
+	}
+	if len(envVar) > 0 {
+		if value := os.Getenv(envVar); len(value) > 0 {
+			return value, nil
+		}
+	}
+	if len(prompt) > 0 {
+		password, err := pkgcmd.ReadPassword(prompt)
+		if err == pkgcmd.ErrNoTerminal {
+			return "", fmt.Errorf("%s: use --auth-password, --auth-password-file or %s", err, envVar)
+		}
+		return password, err
+	}
+	return "", nil
+}
+
+func envOrDefault(envVar string, value string) string {
+	if env := os.Getenv(envVar); len(env) > 0 {
+		return env
+	}
+	return value
+}
@@ -0,0 +1,54 @@
+// Copyright (C) 2018 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_ReadCredentialPrecedence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "alan")
+	if err != nil {
+		t.Fatalf("Can't create directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "password")
+	if err := ioutil.WriteFile(filename, []byte("from-file\n"), 0600); err != nil {
+		t.Fatalf("Can't write file: %s", err)
+	}
+	defer os.Unsetenv(envVaultPassword)
+	os.Setenv(envVaultPassword, "from-env")
+
+	for _, test := range []struct {
+		value    string
+		filename string
+		expected string
+	}{
+		{"from-flag", filename, "from-flag"},
+		{"", filename, "from-file"},
+		{"", "", "from-env"},
+	} {
+		credential, err := readCredential(test.value, envVaultPassword, test.filename, "")
+		if err != nil {
+			t.Fatalf("Can't read credential: %s", err)
+		}
+		if credential != test.expected {
+			t.Fatalf("Invalid credential: %s, expected %s", credential, test.expected)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+// Copyright (C) 2018 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/spf13/cobra"
+
+	pkgalan "github.com/nlamirault/alan/pkg/alan"
+	"github.com/nlamirault/alan/pkg/bitwarden"
+	pkgcmd "github.com/nlamirault/alan/pkg/cmd"
+)
+
+const (
+	envBitwardenPassword = "ALAN_BITWARDEN_PASSWORD"
+)
+
+var (
+	bitwardenExport string
+	encrypt         bool
+	kdfName         string
+	exportFrom      string
+)
+
+type bitwardenCmd struct {
+	out io.Writer
+}
+
+func newBitwardenCmd(out io.Writer) *cobra.Command {
+	bitwardenCmd := &bitwardenCmd{
+		out: out,
+	}
+
+	cmd := &cobra.Command{
+		Use:   "bitwarden",
+		Short: "Manage Bitwarden JSON exports. See subcommands",
+		RunE:  nil,
+	}
+
+	showCmd := &cobra.Command{
+		Use:   "show",
+		Short: "Show a Bitwarden JSON export",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(bitwardenExport) == 0 {
+				return fmt.Errorf("missing export filename")
+			}
+			return bitwardenCmd.showExport()
+		},
+	}
+	importCmd := &cobra.Command{
+		Use:   "import",
+		Short: "Import a Bitwarden JSON export into a Vault or another password manager",
+		Example: `
+               alan bitwarden import --file ./bitwarden.json
+               alan bitwarden import --file ./bitwarden.json --to keepassxc:./alan.kdbx`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(bitwardenExport) == 0 {
+				return fmt.Errorf("missing export filename")
+			}
+			return bitwardenCmd.importExport()
+		},
+	}
+	exportCmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export Vault entries, or another password manager, to a Bitwarden JSON file",
+		Example: `
+               alan bitwarden export --file ./bitwarden.json --encrypt
+               alan bitwarden export --file ./bitwarden.json --from keepassxc:./alan.kdbx`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(bitwardenExport) == 0 {
+				return fmt.Errorf("missing export filename")
+			}
+			return bitwardenCmd.export()
+		},
+	}
+
+	cmd.PersistentFlags().StringVar(&bitwardenExport, "file", "", "JSON filename")
+	addPwsafeFlags(cmd.PersistentFlags())
+	addOutputFlags(cmd.PersistentFlags())
+	importCmd.PersistentFlags().StringVar(&importTo, "to", "", "Destination: <provider>:<location>, Vault by default")
+	addPlanFlags(importCmd.PersistentFlags())
+	importCmd.PersistentFlags().BoolVar(&cas, "cas", false, "Use check-and-set writes to avoid overwriting concurrent changes (KV version 2 only)")
+	importCmd.PersistentFlags().IntVar(&backups, "backups", pkgalan.DefaultBackups, "Number of backup copies of the KeepassXC database kept when it is overwritten")
+	importCmd.PersistentFlags().StringVar(&keyFile, "key-file", "", "Key file of the KeepassXC database")
+	addVaultFlags(importCmd.PersistentFlags())
+	exportCmd.PersistentFlags().StringVar(&exportFrom, "from", "", "Source: <provider>:<location>, Vault by default")
+	addPlanFlags(exportCmd.PersistentFlags())
+	exportCmd.PersistentFlags().BoolVar(&merge, "merge", false, "Merge the secrets into the existing file")
+	exportCmd.PersistentFlags().BoolVar(&force, "force", false, "Overwrite the existing file")
+	exportCmd.PersistentFlags().IntVar(&backups, "backups", pkgalan.DefaultBackups, "Number of backup copies of the file kept when it is overwritten")
+	exportCmd.PersistentFlags().BoolVar(&encrypt, "encrypt", false, "Protect the export with a password")
+	exportCmd.PersistentFlags().StringVar(&kdfName, "kdf", "pbkdf2",
+		fmt.Sprintf("Key derivation of the password-protected export (%s)", strings.Join(bitwarden.KDFNames, ", ")))
+	addVaultFlags(exportCmd.PersistentFlags())
+	cmd.AddCommand(showCmd)
+	cmd.AddCommand(importCmd)
+	cmd.AddCommand(exportCmd)
+	return cmd
+}
+
+// newBitwardenProvider creates a provider for the given JSON file
+func newBitwardenProvider(filename string, overwrite bool) *bitwarden.Provider {
+	source := &pkgcmd.PasswordSource{
+		File:    passwordFile,
+		Stdin:   passwordStdin,
+		Command: passwordCommand,
+		EnvVar:  envBitwardenPassword,
+		Prompt:  "Please input the export password: ",
+	}
+	provider := bitwarden.NewProvider(filename, source.Read, overwrite)
+	provider.SetBackups(backups)
+	return provider
+}
+
+// bitwardenURI returns the provider URI of the export
+func bitwardenURI() string {
+	return "bitwarden:" + bitwardenExport
+}
+
+func (cmd bitwardenCmd) showExport() error {
+	glog.V(1).Infof("Show export: %s", bitwardenExport)
+	if _, err := os.Stat(bitwardenExport); err != nil {
+		return err
+	}
+	printer, err := newPrinter(cmd.out)
+	if err != nil {
+		return err
+	}
+	provider := newBitwardenProvider(bitwardenExport, false)
+	if err := provider.Open(); err != nil {
+		return err
+	}
+	tree, err := provider.Load()
+	if err != nil {
+		return err
+	}
+	if err := showTree(printer, tree); err != nil {
+		return err
+	}
+	return provider.Close()
+}
+
+func (cmd bitwardenCmd) importExport() error {
+	glog.V(1).Infof("Import export: %s", bitwardenExport)
+	if _, err := os.Stat(bitwardenExport); err != nil {
+		return err
+	}
+	toURI, to, err := importDestination()
+	if err != nil {
+		return err
+	}
+	return syncProviders(cmd.out, bitwardenURI(), newBitwardenProvider(bitwardenExport, false), toURI, to)
+}
+
+func (cmd bitwardenCmd) export() error {
+	glog.V(1).Infof("Export to file: %s", bitwardenExport)
+	if _, err := os.Stat(bitwardenExport); err == nil && !merge && !force {
+		return fmt.Errorf("File %s already exists, use --merge or --force", bitwardenExport)
+	}
+	provider := newBitwardenProvider(bitwardenExport, force && !merge)
+	if encrypt {
+		kdf, err := bitwarden.NewKDF(kdfName)
+		if err != nil {
+			return err
+		}
+		provider.SetEncryption(kdf)
+	}
+	fromURI, from, err := exportSource()
+	if err != nil {
+		return err
+	}
+	return syncProviders(cmd.out, fromURI, from, bitwardenURI(), provider)
+}
@@ -0,0 +1,141 @@
+// Copyright (C) 2018 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"os"
+	"strconv"
+
+	"github.com/golang/glog"
+	"github.com/mitchellh/go-homedir"
+	"github.com/spf13/pflag"
+
+	pkgalan "github.com/nlamirault/alan/pkg/alan"
+	pkgcmd "github.com/nlamirault/alan/pkg/cmd"
+)
+
+const (
+	envConfig  = "ALAN_CONFIG"
+	envProfile = "ALAN_PROFILE"
+)
+
+var (
+	configFile  string
+	profileName string
+	profile     *pkgcmd.Profile
+)
+
+// profileSetting define a flag set from the profile, if neither the flag
+// nor the environment variable are set
+type profileSetting struct {
+	flag   string
+	envVar string
+	value  string
+	path   bool
+}
+
+// addConfigFlags adds the flags used to select the profile
+func addConfigFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&configFile, "config", envOrDefault(envConfig, pkgcmd.DefaultConfigFile), "Configuration file")
+	flags.StringVar(&profileName, "profile", os.Getenv(envProfile), "Profile of the configuration file")
+}
+
+// loadProfile reads the selected profile and uses it as default values of the flags
+func loadProfile(flags *pflag.FlagSet) error {
+	config, err := pkgcmd.LoadConfig(configFile)
+	if err != nil {
+		return err
+	}
+	if profile, err = config.Profile(profileName); err != nil || profile == nil {
+		return err
+	}
+	glog.V(1).Infof("Use profile %s", profile.Name)
+	for _, setting := range profileSettings(profile) {
+		flag := flags.Lookup(setting.flag)
+		if flag == nil || flag.Changed || len(setting.value) == 0 {
+			continue
+		}
+		if len(setting.envVar) > 0 && len(os.Getenv(setting.envVar)) > 0 {
+			continue
+		}
+		value := setting.value
+		if setting.path {
+			if value, err = homedir.Expand(value); err != nil {
+				return err
+			}
+		}
+		if err := flags.Set(setting.flag, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func profileSettings(profile *pkgcmd.Profile) []profileSetting {
+	settings := []profileSetting{}
+	if config := profile.Vault; config != nil {
+		settings = append(settings,
+			profileSetting{flag: "vault", envVar: "VAULT_ADDR", value: config.Address},
+			profileSetting{flag: "mount", envVar: envVaultMount, value: config.Mount},
+			profileSetting{flag: "prefix", envVar: envVaultPrefix, value: config.Prefix},
+			profileSetting{flag: "ca-cert", envVar: "VAULT_CACERT", value: config.CACert, path: true},
+			profileSetting{flag: "ca-path", envVar: "VAULT_CAPATH", value: config.CAPath, path: true},
+			profileSetting{flag: "client-cert", envVar: "VAULT_CLIENT_CERT", value: config.ClientCert, path: true},
+			profileSetting{flag: "client-key", envVar: "VAULT_CLIENT_KEY", value: config.ClientKey, path: true},
+			profileSetting{flag: "tls-server-name", envVar: "VAULT_TLS_SERVER_NAME", value: config.TLSServerName},
+			profileSetting{flag: "tls-skip-verify", envVar: "VAULT_SKIP_VERIFY", value: boolSetting(config.TLSSkipVerify)})
+		if auth := config.Auth; auth != nil {
+			settings = append(settings,
+				profileSetting{flag: "auth-method", value: auth.Method},
+				profileSetting{flag: "auth-mount", value: auth.Mount},
+				profileSetting{flag: "auth-username", envVar: envVaultUsername, value: auth.Username},
+				profileSetting{flag: "auth-password-file", envVar: envVaultPassword, value: auth.PasswordFile, path: true},
+				profileSetting{flag: "auth-role-id", envVar: envVaultRoleID, value: auth.RoleID},
+				profileSetting{flag: "auth-role-id-file", envVar: envVaultRoleID, value: auth.RoleIDFile, path: true},
+				profileSetting{flag: "auth-secret-id-file", envVar: envVaultSecretID, value: auth.SecretIDFile, path: true},
+				profileSetting{flag: "auth-secret-id-wrapped", value: boolSetting(auth.SecretIDWrapped)},
+				profileSetting{flag: "auth-cert-name", value: auth.CertName},
+				profileSetting{flag: "auth-role", envVar: envVaultRole, value: auth.Role},
+				profileSetting{flag: "auth-jwt-file", value: auth.JWTFile, path: true})
+		}
+	}
+	if config := profile.KeepassXC; config != nil {
+		settings = append(settings,
+			profileSetting{flag: "database", value: config.Database, path: true},
+			profileSetting{flag: "key-file", envVar: envKeepassKeyFile, value: config.KeyFile, path: true},
+			profileSetting{flag: "password-file", envVar: envKeepassPassword, value: config.PasswordFile, path: true},
+			profileSetting{flag: "password-command", envVar: envKeepassPassword, value: config.PasswordCommand})
+	}
+	return settings
+}
+
+func boolSetting(value bool) string {
+	if !value {
+		return ""
+	}
+	return strconv.FormatBool(value)
+}
+
+// mappingRules returns the mapping rules of the profile, from the KeepassXC groups to the Vault paths
+func mappingRules() []pkgalan.MappingRule {
+	rules := []pkgalan.MappingRule{}
+	if profile == nil {
+		return rules
+	}
+	for _, mapping := range profile.Mappings {
+		rules = append(rules, pkgalan.MappingRule{Path: mapping.KeepassXC, Target: mapping.Vault})
+	}
+	return rules
+}
@@ -17,10 +17,12 @@ package cmd
 import (
 	"fmt"
 	"io"
+	"os"
 	"strings"
 
 	"github.com/golang/glog"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 
 	pkgalan "github.com/nlamirault/alan/pkg/alan"
 	pkgcmd "github.com/nlamirault/alan/pkg/cmd"
@@ -28,8 +30,22 @@ import (
 	"github.com/nlamirault/alan/pkg/vault"
 )
 
+const (
+	envKeepassPassword = "ALAN_KEEPASS_PASSWORD"
+	envKeepassKeyFile  = "ALAN_KEEPASS_KEY_FILE"
+)
+
 var (
-	database string
+	database        string
+	cas             bool
+	keyFile         string
+	noPassword      bool
+	passwordFile    string
+	passwordStdin   bool
+	passwordCommand string
+	merge           bool
+	force           bool
+	backups         = pkgalan.DefaultBackups
 )
 
 type keepassxcCmd struct {
@@ -64,7 +80,7 @@ func newKeepassXCCmd(out io.Writer) *cobra.Command {
 			if len(database) == 0 {
 				return fmt.Errorf("missing database name")
 			}
-			vaultClient, err := vault.NewClient(vaultAddress, "alan", "turing")
+			vaultClient, err := newVaultClient()
 			if err != nil {
 				return err
 			}
@@ -78,7 +94,7 @@ func newKeepassXCCmd(out io.Writer) *cobra.Command {
 			if len(database) == 0 {
 				return fmt.Errorf("missing database name")
 			}
-			vaultClient, err := vault.NewClient(vaultAddress, "alan", "turing")
+			vaultClient, err := newVaultClient()
 			if err != nil {
 				return err
 			}
@@ -86,145 +102,161 @@ func newKeepassXCCmd(out io.Writer) *cobra.Command {
 		},
 	}
 
-	showCmd.PersistentFlags().StringVar(&database, "database", "", "Database filename")
-	importCmd.PersistentFlags().StringVar(&database, "database", "", "Database filename")
-	importCmd.PersistentFlags().StringVar(&vaultAddress, "vault", vault.DefaultAddr, "Vault address")
-	exportCmd.PersistentFlags().StringVar(&database, "database", "", "Database filename")
-	exportCmd.PersistentFlags().StringVar(&vaultAddress, "vault", vault.DefaultAddr, "Vault address")
+	cmd.PersistentFlags().StringVar(&database, "database", "", "Database filename")
+	addKeepassFlags(cmd.PersistentFlags())
+	addOutputFlags(cmd.PersistentFlags())
+	addPlanFlags(importCmd.PersistentFlags())
+	importCmd.PersistentFlags().BoolVar(&cas, "cas", false, "Use check-and-set writes to avoid overwriting concurrent changes (KV version 2 only)")
+	addVaultFlags(importCmd.PersistentFlags())
+	addPlanFlags(exportCmd.PersistentFlags())
+	exportCmd.PersistentFlags().BoolVar(&merge, "merge", false, "Merge the secrets into the existing database")
+	exportCmd.PersistentFlags().BoolVar(&force, "force", false, "Overwrite the existing database")
+	exportCmd.PersistentFlags().IntVar(&backups, "backups", pkgalan.DefaultBackups, "Number of backup copies of the database kept when it is overwritten")
+	addVaultFlags(exportCmd.PersistentFlags())
 	cmd.AddCommand(showCmd)
 	cmd.AddCommand(importCmd)
 	cmd.AddCommand(exportCmd)
 	return cmd
 }
 
-func (cmd keepassxcCmd) importDB(vaultClient *vault.Client) error {
-	glog.V(1).Infof("Import database: %s", database)
-	keepassClient, err := keepassxc.NewClient(database)
-	if err != nil {
-		return err
+// addKeepassFlags adds the flags used to unlock a database
+func addKeepassFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&keyFile, "key-file", os.Getenv(envKeepassKeyFile), "Key file of the database")
+	flags.BoolVar(&noPassword, "no-password", false, "Unlock the database with the key file only")
+	flags.StringVar(&passwordFile, "password-file", "", "File which contains the database password")
+	flags.BoolVar(&passwordStdin, "password-stdin", false, "Read the database password from the standard input")
+	flags.StringVar(&passwordCommand, "password-command", "", "Command which prints the database password")
+}
+
+// newKeepassClient creates a KeepassXC client using the password sources from the flags
+func newKeepassClient() (*keepassxc.Client, error) {
+	return newKeepassClientFor(database)
+}
+
+// newKeepassClientFor creates a client for the given database
+func newKeepassClientFor(filename string) (*keepassxc.Client, error) {
+	credentials := &keepassxc.Credentials{
+		KeyFile: keyFile,
 	}
-	if err := keepassClient.Open(); err != nil {
-		return err
+	if noPassword {
+		if len(keyFile) == 0 {
+			return nil, fmt.Errorf("A key file is required without password")
+		}
+	} else {
+		source := &pkgcmd.PasswordSource{
+			File:    passwordFile,
+			Stdin:   passwordStdin,
+			Command: passwordCommand,
+			EnvVar:  envKeepassPassword,
+			Prompt:  "Please input your password: ",
+		}
+		credentials.Password = source.Read
 	}
-	if err := vaultClient.Login(); err != nil {
-		return err
+	client, err := keepassxc.NewClient(filename, credentials)
+	if err != nil {
+		return nil, err
 	}
-	secrets, err := keepassClient.Load()
+	client.SetBackups(backups)
+	return client, nil
+}
+
+func (cmd keepassxcCmd) importDB(vaultClient *vault.Client) error {
+	glog.V(1).Infof("Import database: %s", database)
+	keepassClient, err := newKeepassClient()
 	if err != nil {
 		return err
 	}
-	//glog.V(2).Infof("Secrets for Vault: %s", secrets)
-	for name, group := range secrets {
-		glog.V(2).Infof("Manage Vault group: %s", name)
-		for _, secret := range group {
-			glog.V(2).Infof("Manage Vault secret: %s", secret)
-			if len(secret.Title) == 0 {
-				fmt.Printf(pkgcmd.YellowOut(fmt.Sprintf("No title for secret: %s %s\n", secret.Username, secret.URL)))
-			} else {
-				path := fmt.Sprintf("%s/%s", name, secret.Title)
-				fmt.Printf(pkgcmd.GreenOut(fmt.Sprintf("Add secret: %s\n", path)))
-				vaultClient.Write(path, secret)
-			}
-		}
-	}
-	return keepassClient.Close()
+	return syncProviders(cmd.out, keepassURI(), keepassxc.NewProvider(keepassClient, false),
+		vaultURI(vaultClient), newVaultProvider(vaultClient, cas))
+}
+
+// keepassURI returns the provider URI of the database
+func keepassURI() string {
+	return "keepassxc:" + database
+}
+
+// vaultURI returns the provider URI of the Vault secrets
+func vaultURI(vaultClient *vault.Client) string {
+	return "vault:" + pkgalan.JoinPath(vaultClient.Mount(), vaultClient.Prefix())
+}
+
+// showEntry define an entry displayed by show
+type showEntry struct {
+	Path     string
+	Group    string
+	Title    string
+	Username string
+	URL      string
 }
 
 func (cmd keepassxcCmd) showDB() error {
 	glog.V(1).Infof("Show database: %s", database)
-	keepassClient, err := keepassxc.NewClient(database)
+	printer, err := newPrinter(cmd.out)
+	if err != nil {
+		return err
+	}
+	keepassClient, err := newKeepassClient()
 	if err != nil {
 		return err
 	}
 	if err := keepassClient.Open(); err != nil {
 		return err
 	}
-	secrets, err := keepassClient.Load()
+	tree, err := keepassClient.Load()
 	if err != nil {
 		return err
 	}
-	for name, group := range secrets {
-		fmt.Println(pkgcmd.GreenOut(name))
-		for _, secret := range group {
-			if len(secret.Title) == 0 {
-				fmt.Printf("%s %s %s\n", pkgcmd.RedOut(">>>"), pkgcmd.YellowOut(secret.Username), pkgcmd.YellowOut(secret.URL))
-			} else {
-				fmt.Printf("%s: %s %s\n", pkgcmd.BlueOut(secret.Title), pkgcmd.BlueOut(secret.Username), pkgcmd.BlueOut(secret.URL))
-			}
-		}
+	if err := showTree(printer, tree); err != nil {
+		return err
 	}
-
 	return keepassClient.Close()
 }
 
-func (cmd keepassxcCmd) exportDB(vaultClient *vault.Client) error {
-	glog.V(1).Infof("Export database: %s", database)
-	if err := vaultClient.Login(); err != nil {
-		return err
-	}
-
-	keepassClient, err := keepassxc.NewClient(database)
-	if err != nil {
-		return err
-	}
+// showTree prints the groups and the secrets of a tree
+func showTree(printer *pkgcmd.Printer, tree *pkgalan.Group) error {
+	entries := []showEntry{}
+	tree.Walk(func(group *pkgalan.Group) error {
+		for _, secret := range group.Secrets {
+			entries = append(entries, showEntry{
+				Path:     pkgalan.SecretPath(group.Path, secret),
+				Group:    group.Path,
+				Title:    secret.Title,
+				Username: secret.Username,
+				URL:      secret.URL,
+			})
+		}
+		return nil
+	})
+	return printer.Print(entries, func(out io.Writer) error {
+		showGroup(out, tree, 0)
+		return nil
+	})
+}
 
-	data, err := vaultClient.List(path)
-	if err != nil {
-		return err
-	}
-	glog.V(1).Infof("Vault secrets: %s", data)
-	secrets := map[string][]*pkgalan.Secret{}
-	for _, key := range data["keys"].([]interface{}) {
-		path := key.(string)
-		keySecrets, err := extractKeyEntries(keepassClient, vaultClient, path)
-		if err != nil {
-			return err
+func showGroup(out io.Writer, group *pkgalan.Group, depth int) {
+	indent := strings.Repeat("  ", depth)
+	fmt.Fprintf(out, "%s%s\n", indent, pkgcmd.GreenOut(group.Name))
+	for _, secret := range group.Secrets {
+		if len(secret.Title) == 0 {
+			fmt.Fprintf(out, "%s  %s %s %s\n", indent, pkgcmd.RedOut(">>>"), pkgcmd.YellowOut(secret.Username), pkgcmd.YellowOut(secret.URL))
+		} else {
+			fmt.Fprintf(out, "%s  %s: %s %s\n", indent, pkgcmd.BlueOut(secret.Title), pkgcmd.BlueOut(secret.Username), pkgcmd.BlueOut(secret.URL))
 		}
-		secrets[path] = keySecrets
 	}
-
-	if err := keepassClient.Create(secrets); err != nil {
-		return err
+	for _, subgroup := range group.Groups {
+		showGroup(out, subgroup, depth+1)
 	}
-	return keepassClient.Save()
 }
 
-func extractKeyEntries(keepassClient *keepassxc.Client, vaultClient *vault.Client, path string) ([]*pkgalan.Secret, error) {
-	glog.V(2).Infof("Analyse secrets for path: %s", path)
-	secrets := []*pkgalan.Secret{}
-	glog.V(2).Infof("Analyse Vault group: %s", path)
-	fmt.Printf(pkgcmd.GreenOut(fmt.Sprintf("Vault group: %s\n", path)))
-	data, err := vaultClient.List(path)
-	if err != nil {
-		return nil, err
+func (cmd keepassxcCmd) exportDB(vaultClient *vault.Client) error {
+	glog.V(1).Infof("Export database: %s", database)
+	if _, err := os.Stat(database); err == nil && !merge && !force {
+		return fmt.Errorf("Database %s already exists, use --merge or --force", database)
 	}
-	for _, key := range data["keys"].([]interface{}) {
-		newPath := fmt.Sprintf("%s%s", path, key.(string))
-		if strings.HasSuffix(key.(string), "/") {
-			glog.V(2).Infof("Analyse sub entry: %s", newPath)
-			keySecrets, err := extractKeyEntries(keepassClient, vaultClient, newPath)
-			if err != nil {
-				return nil, err
-			}
-			secrets = append(secrets, keySecrets...)
-		} else {
-			glog.V(2).Infof("Secret for: %s", newPath)
-			fmt.Printf(pkgcmd.BlueOut(fmt.Sprintf("Vault entry: %s\n", newPath)))
-			keyData, err := vaultClient.Read(newPath)
-			if err != nil {
-				return nil, err
-			}
-			glog.V(1).Infof("Vault secret: %s", keyData)
-			if keyData["Title"] != nil {
-				secrets = append(secrets, &pkgalan.Secret{
-					Title:    keyData[pkgalan.Title].(string),
-					Username: keyData[pkgalan.Username].(string),
-					Password: keyData[pkgalan.Password].(string),
-					URL:      keyData[pkgalan.URL].(string),
-				})
-			}
-		}
+	keepassClient, err := newKeepassClient()
+	if err != nil {
+		return err
 	}
-
-	return secrets, nil
+	return syncProviders(cmd.out, vaultURI(vaultClient), newVaultProvider(vaultClient, false),
+		keepassURI(), keepassxc.NewProvider(keepassClient, force && !merge))
 }
@@ -0,0 +1,157 @@
+// Copyright (C) 2018 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/golang/glog"
+	"github.com/spf13/cobra"
+
+	pkgalan "github.com/nlamirault/alan/pkg/alan"
+	"github.com/nlamirault/alan/pkg/lastpass"
+	"github.com/nlamirault/alan/pkg/vault"
+)
+
+var (
+	lastpassExport string
+)
+
+type lastpassCmd struct {
+	out io.Writer
+}
+
+func newLastpassCmd(out io.Writer) *cobra.Command {
+	lastpassCmd := &lastpassCmd{
+		out: out,
+	}
+
+	cmd := &cobra.Command{
+		Use:   "lastpass",
+		Short: "Manage LastPass CSV exports. See subcommands",
+		RunE:  nil,
+	}
+
+	showCmd := &cobra.Command{
+		Use:   "show",
+		Short: "Show a LastPass CSV export",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(lastpassExport) == 0 {
+				return fmt.Errorf("missing export filename")
+			}
+			return lastpassCmd.showExport()
+		},
+	}
+	importCmd := &cobra.Command{
+		Use:   "import",
+		Short: "Import a LastPass CSV export into a Vault or another password manager",
+		Example: `
+               alan lastpass import --file ./lastpass.csv
+               alan lastpass import --file ./lastpass.csv --to keepassxc:./alan.kdbx`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(lastpassExport) == 0 {
+				return fmt.Errorf("missing export filename")
+			}
+			return lastpassCmd.importExport()
+		},
+	}
+	exportCmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export Vault entries to a LastPass CSV file",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(lastpassExport) == 0 {
+				return fmt.Errorf("missing export filename")
+			}
+			vaultClient, err := newVaultClient()
+			if err != nil {
+				return err
+			}
+			return lastpassCmd.exportVault(vaultClient)
+		},
+	}
+
+	cmd.PersistentFlags().StringVar(&lastpassExport, "file", "", "CSV filename")
+	addOutputFlags(cmd.PersistentFlags())
+	importCmd.PersistentFlags().StringVar(&importTo, "to", "", "Destination: <provider>:<location>, Vault by default")
+	addPlanFlags(importCmd.PersistentFlags())
+	importCmd.PersistentFlags().BoolVar(&cas, "cas", false, "Use check-and-set writes to avoid overwriting concurrent changes (KV version 2 only)")
+	importCmd.PersistentFlags().IntVar(&backups, "backups", pkgalan.DefaultBackups, "Number of backup copies of the KeepassXC database kept when it is overwritten")
+	addKeepassFlags(importCmd.PersistentFlags())
+	addVaultFlags(importCmd.PersistentFlags())
+	addPlanFlags(exportCmd.PersistentFlags())
+	exportCmd.PersistentFlags().BoolVar(&merge, "merge", false, "Merge the secrets into the existing file")
+	exportCmd.PersistentFlags().BoolVar(&force, "force", false, "Overwrite the existing file")
+	exportCmd.PersistentFlags().IntVar(&backups, "backups", pkgalan.DefaultBackups, "Number of backup copies of the file kept when it is overwritten")
+	addVaultFlags(exportCmd.PersistentFlags())
+	cmd.AddCommand(showCmd)
+	cmd.AddCommand(importCmd)
+	cmd.AddCommand(exportCmd)
+	return cmd
+}
+
+// newLastpassProvider creates a provider for the given CSV file
+func newLastpassProvider(filename string, overwrite bool) *lastpass.Provider {
+	provider := lastpass.NewProvider(filename, overwrite)
+	provider.SetBackups(backups)
+	return provider
+}
+
+// lastpassURI returns the provider URI of the export
+func lastpassURI() string {
+	return "lastpass:" + lastpassExport
+}
+
+func (cmd lastpassCmd) showExport() error {
+	glog.V(1).Infof("Show export: %s", lastpassExport)
+	if _, err := os.Stat(lastpassExport); err != nil {
+		return err
+	}
+	printer, err := newPrinter(cmd.out)
+	if err != nil {
+		return err
+	}
+	provider := newLastpassProvider(lastpassExport, false)
+	if err := provider.Open(); err != nil {
+		return err
+	}
+	tree, err := provider.Load()
+	if err != nil {
+		return err
+	}
+	return showTree(printer, tree)
+}
+
+func (cmd lastpassCmd) importExport() error {
+	glog.V(1).Infof("Import export: %s", lastpassExport)
+	if _, err := os.Stat(lastpassExport); err != nil {
+		return err
+	}
+	toURI, to, err := importDestination()
+	if err != nil {
+		return err
+	}
+	return syncProviders(cmd.out, lastpassURI(), newLastpassProvider(lastpassExport, false), toURI, to)
+}
+
+func (cmd lastpassCmd) exportVault(vaultClient *vault.Client) error {
+	glog.V(1).Infof("Export to file: %s", lastpassExport)
+	if _, err := os.Stat(lastpassExport); err == nil && !merge && !force {
+		return fmt.Errorf("File %s already exists, use --merge or --force", lastpassExport)
+	}
+	return syncProviders(cmd.out, vaultURI(vaultClient), newVaultProvider(vaultClient, false),
+		lastpassURI(), newLastpassProvider(lastpassExport, force && !merge))
+}
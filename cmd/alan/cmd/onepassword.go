@@ -0,0 +1,114 @@
+// Copyright (C) 2018 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/golang/glog"
+	"github.com/spf13/cobra"
+
+	pkgalan "github.com/nlamirault/alan/pkg/alan"
+	"github.com/nlamirault/alan/pkg/onepassword"
+)
+
+var (
+	onepasswordExport string
+	importTo          string
+)
+
+type onepasswordCmd struct {
+	out io.Writer
+}
+
+func newOnepasswordCmd(out io.Writer) *cobra.Command {
+	onepasswordCmd := &onepasswordCmd{
+		out: out,
+	}
+
+	cmd := &cobra.Command{
+		Use:   "onepassword",
+		Short: "Manage 1Password exports. See subcommands",
+		RunE:  nil,
+	}
+
+	showCmd := &cobra.Command{
+		Use:   "show",
+		Short: "Show a 1Password export",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(onepasswordExport) == 0 {
+				return fmt.Errorf("missing export filename")
+			}
+			return onepasswordCmd.showExport()
+		},
+	}
+	importCmd := &cobra.Command{
+		Use:   "import",
+		Short: "Import a 1Password export into a Vault or another password manager",
+		Example: `
+               alan onepassword import --file ./export.1pux
+               alan onepassword import --file ./Personal.1pif --to keepassxc:./alan.kdbx`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(onepasswordExport) == 0 {
+				return fmt.Errorf("missing export filename")
+			}
+			return onepasswordCmd.importExport()
+		},
+	}
+
+	cmd.PersistentFlags().StringVar(&onepasswordExport, "file", "", "1PUX file, or 1PIF file or directory")
+	addOutputFlags(cmd.PersistentFlags())
+	importCmd.PersistentFlags().StringVar(&importTo, "to", "", "Destination: <provider>:<location>, Vault by default")
+	addPlanFlags(importCmd.PersistentFlags())
+	importCmd.PersistentFlags().BoolVar(&cas, "cas", false, "Use check-and-set writes to avoid overwriting concurrent changes (KV version 2 only)")
+	importCmd.PersistentFlags().IntVar(&backups, "backups", pkgalan.DefaultBackups, "Number of backup copies of the KeepassXC database kept when it is overwritten")
+	addKeepassFlags(importCmd.PersistentFlags())
+	addVaultFlags(importCmd.PersistentFlags())
+	cmd.AddCommand(showCmd)
+	cmd.AddCommand(importCmd)
+	return cmd
+}
+
+// onepasswordURI returns the provider URI of the export
+func onepasswordURI() string {
+	return "onepassword:" + onepasswordExport
+}
+
+func (cmd onepasswordCmd) showExport() error {
+	glog.V(1).Infof("Show export: %s", onepasswordExport)
+	printer, err := newPrinter(cmd.out)
+	if err != nil {
+		return err
+	}
+	provider := onepassword.NewProvider(onepasswordExport)
+	if err := provider.Open(); err != nil {
+		return err
+	}
+	tree, err := provider.Load()
+	if err != nil {
+		return err
+	}
+	return showTree(printer, tree)
+}
+
+func (cmd onepasswordCmd) importExport() error {
+	glog.V(1).Infof("Import export: %s", onepasswordExport)
+	toURI, to, err := importDestination()
+	if err != nil {
+		return err
+	}
+	return syncProviders(cmd.out, onepasswordURI(), onepassword.NewProvider(onepasswordExport), toURI, to)
+}
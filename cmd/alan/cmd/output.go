@@ -0,0 +1,49 @@
+// Copyright (C) 2018 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/spf13/pflag"
+
+	pkgcmd "github.com/nlamirault/alan/pkg/cmd"
+)
+
+var (
+	output         string
+	outputTemplate string
+)
+
+// addOutputFlags adds the flags used to choose the output format
+func addOutputFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&output, "output", pkgcmd.OutputTable,
+		fmt.Sprintf("Output format (%s)", strings.Join(pkgcmd.OutputFormats, ", ")))
+	flags.StringVar(&outputTemplate, "template", "", "Go template used by the template output")
+}
+
+// newPrinter creates a printer for the output format. Colors are only used by the table output.
+func newPrinter(out io.Writer) (*pkgcmd.Printer, error) {
+	printer, err := pkgcmd.NewPrinter(out, output, outputTemplate)
+	if err != nil {
+		return nil, err
+	}
+	if !printer.IsTable() {
+		pkgcmd.DisableColors()
+	}
+	return printer, nil
+}
@@ -0,0 +1,184 @@
+// Copyright (C) 2018 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/golang/glog"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	pkgalan "github.com/nlamirault/alan/pkg/alan"
+	pkgcmd "github.com/nlamirault/alan/pkg/cmd"
+	"github.com/nlamirault/alan/pkg/pwsafe"
+	"github.com/nlamirault/alan/pkg/vault"
+)
+
+const (
+	envPwsafePassword = "ALAN_PWSAFE_PASSWORD"
+)
+
+var (
+	pwsafeDatabase string
+)
+
+type pwsafeCmd struct {
+	out io.Writer
+}
+
+func newPwsafeCmd(out io.Writer) *cobra.Command {
+	pwsafeCmd := &pwsafeCmd{
+		out: out,
+	}
+
+	cmd := &cobra.Command{
+		Use:   "pwsafe",
+		Short: "Manage Password Safe database. See subcommands",
+		RunE:  nil,
+	}
+
+	showCmd := &cobra.Command{
+		Use:   "show",
+		Short: "Show a Password Safe database",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(pwsafeDatabase) == 0 {
+				return fmt.Errorf("missing database name")
+			}
+			return pwsafeCmd.showDB()
+		},
+	}
+	importCmd := &cobra.Command{
+		Use:   "import",
+		Short: "Import a Password Safe database into a Vault",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(pwsafeDatabase) == 0 {
+				return fmt.Errorf("missing database name")
+			}
+			vaultClient, err := newVaultClient()
+			if err != nil {
+				return err
+			}
+			return pwsafeCmd.importDB(vaultClient)
+		},
+	}
+	exportCmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export Vault entries to a Password Safe database",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(pwsafeDatabase) == 0 {
+				return fmt.Errorf("missing database name")
+			}
+			vaultClient, err := newVaultClient()
+			if err != nil {
+				return err
+			}
+			return pwsafeCmd.exportDB(vaultClient)
+		},
+	}
+
+	cmd.PersistentFlags().StringVar(&pwsafeDatabase, "database", "", "Database filename")
+	addPwsafeFlags(cmd.PersistentFlags())
+	addOutputFlags(cmd.PersistentFlags())
+	addPlanFlags(importCmd.PersistentFlags())
+	importCmd.PersistentFlags().BoolVar(&cas, "cas", false, "Use check-and-set writes to avoid overwriting concurrent changes (KV version 2 only)")
+	addVaultFlags(importCmd.PersistentFlags())
+	addPlanFlags(exportCmd.PersistentFlags())
+	exportCmd.PersistentFlags().BoolVar(&merge, "merge", false, "Merge the secrets into the existing database")
+	exportCmd.PersistentFlags().BoolVar(&force, "force", false, "Overwrite the existing database")
+	exportCmd.PersistentFlags().IntVar(&backups, "backups", pkgalan.DefaultBackups, "Number of backup copies of the database kept when it is overwritten")
+	addVaultFlags(exportCmd.PersistentFlags())
+	cmd.AddCommand(showCmd)
+	cmd.AddCommand(importCmd)
+	cmd.AddCommand(exportCmd)
+	return cmd
+}
+
+// addPwsafeFlags adds the flags used to unlock a database
+func addPwsafeFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&passwordFile, "password-file", "", "File which contains the database password")
+	flags.BoolVar(&passwordStdin, "password-stdin", false, "Read the database password from the standard input")
+	flags.StringVar(&passwordCommand, "password-command", "", "Command which prints the database password")
+}
+
+// newPwsafeClientFor creates a client for the given database
+func newPwsafeClientFor(filename string) (*pwsafe.Client, error) {
+	source := &pkgcmd.PasswordSource{
+		File:    passwordFile,
+		Stdin:   passwordStdin,
+		Command: passwordCommand,
+		EnvVar:  envPwsafePassword,
+		Prompt:  "Please input your password: ",
+	}
+	client, err := pwsafe.NewClient(filename, source.Read)
+	if err != nil {
+		return nil, err
+	}
+	client.SetBackups(backups)
+	return client, nil
+}
+
+// pwsafeURI returns the provider URI of the database
+func pwsafeURI() string {
+	return "pwsafe:" + pwsafeDatabase
+}
+
+func (cmd pwsafeCmd) showDB() error {
+	glog.V(1).Infof("Show database: %s", pwsafeDatabase)
+	printer, err := newPrinter(cmd.out)
+	if err != nil {
+		return err
+	}
+	client, err := newPwsafeClientFor(pwsafeDatabase)
+	if err != nil {
+		return err
+	}
+	if err := client.Open(); err != nil {
+		return err
+	}
+	tree, err := client.Load()
+	if err != nil {
+		return err
+	}
+	if err := showTree(printer, tree); err != nil {
+		return err
+	}
+	return client.Close()
+}
+
+func (cmd pwsafeCmd) importDB(vaultClient *vault.Client) error {
+	glog.V(1).Infof("Import database: %s", pwsafeDatabase)
+	client, err := newPwsafeClientFor(pwsafeDatabase)
+	if err != nil {
+		return err
+	}
+	return syncProviders(cmd.out, pwsafeURI(), pwsafe.NewProvider(client, false),
+		vaultURI(vaultClient), newVaultProvider(vaultClient, cas))
+}
+
+func (cmd pwsafeCmd) exportDB(vaultClient *vault.Client) error {
+	glog.V(1).Infof("Export database: %s", pwsafeDatabase)
+	if _, err := os.Stat(pwsafeDatabase); err == nil && !merge && !force {
+		return fmt.Errorf("Database %s already exists, use --merge or --force", pwsafeDatabase)
+	}
+	client, err := newPwsafeClientFor(pwsafeDatabase)
+	if err != nil {
+		return err
+	}
+	return syncProviders(cmd.out, vaultURI(vaultClient), newVaultProvider(vaultClient, false),
+		pwsafeURI(), pwsafe.NewProvider(client, force && !merge))
+}
@@ -15,6 +15,7 @@
 package cmd
 
 import (
+	"errors"
 	goflag "flag"
 	"fmt"
 	"io"
@@ -46,16 +47,28 @@ var (
 
 func newApplicationCommand(out io.Writer) *cobra.Command {
 	rootCmd := &cobra.Command{
-		Use:          cliName,
-		Long:         `Bridge between Vault and password managers`,
-		SilenceUsage: true,
+		Use:           cliName,
+		Long:          `Bridge between Vault and password managers`,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			return loadProfile(cmd.Flags())
+		},
 	}
+	addConfigFlags(rootCmd.PersistentFlags())
 	rootCmd.AddCommand(
 		newVersionCmd(out, helpMessage),
 		newCompletionCmd(out, completionExample),
 		newKeepassXCCmd(out),
+		newPwsafeCmd(out),
+		newOnepasswordCmd(out),
+		newLastpassCmd(out),
+		newBitwardenCmd(out),
 		newVaultCmd(out),
+		newSyncCmd(out),
+		newSearchCmd(out),
 	)
+	registerProviders()
 	cobra.EnablePrefixMatching = true
 
 	// add glog flags
@@ -66,10 +79,16 @@ func newApplicationCommand(out io.Writer) *cobra.Command {
 	return rootCmd
 }
 
+// errChangesPending is returned by a dry-run with changes to apply
+var errChangesPending = errors.New("Changes pending")
+
 func Execute() {
 	cmd := newApplicationCommand(os.Stdout)
 	if err := cmd.Execute(); err != nil {
-		fmt.Println(pkgcmd.RedOut(err))
+		if err == errChangesPending {
+			os.Exit(2)
+		}
+		fmt.Fprintln(os.Stderr, pkgcmd.RedOut(err))
 		os.Exit(1)
 	}
 }
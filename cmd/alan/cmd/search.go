@@ -0,0 +1,111 @@
+// Copyright (C) 2018 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/spf13/cobra"
+
+	pkgalan "github.com/nlamirault/alan/pkg/alan"
+	pkgcmd "github.com/nlamirault/alan/pkg/cmd"
+)
+
+var (
+	searchFrom   string
+	searchMode   string
+	searchFields []string
+)
+
+type searchCmd struct {
+	out io.Writer
+}
+
+func newSearchCmd(out io.Writer) *cobra.Command {
+	searchCmd := &searchCmd{
+		out: out,
+	}
+
+	cmd := &cobra.Command{
+		Use:   "search [query]",
+		Short: "Search secrets by title, username, URL, tags and notes",
+		Example: `
+               alan search github
+               alan search --from keepassxc:./alan.kdbx --mode glob 'git*'
+               alan search --mode regex '^gh-' --field username=alan
+               alan search --field tags=work`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			query := ""
+			if len(args) > 0 {
+				query = args[0]
+			}
+			return searchCmd.search(query)
+		},
+	}
+	cmd.PersistentFlags().StringVar(&searchFrom, "from", "",
+		"Provider searched: <provider>:<location>. Default to the KeepassXC database if set, Vault otherwise")
+	cmd.PersistentFlags().StringVar(&searchMode, "mode", pkgalan.SearchFuzzy,
+		fmt.Sprintf("Search mode (%s)", strings.Join(pkgalan.SearchModes, ", ")))
+	cmd.PersistentFlags().StringArrayVar(&searchFields, "field", nil,
+		fmt.Sprintf("Only keep the secrets whose field matches: <field>=<value>, or only search a field: <field> (%s or a custom field)",
+			strings.Join(pkgalan.SearchFields, ", ")))
+	cmd.PersistentFlags().StringVar(&database, "database", "", "Database filename of the keepassxc provider without location")
+	addKeepassFlags(cmd.PersistentFlags())
+	addVaultFlags(cmd.PersistentFlags())
+	addOutputFlags(cmd.PersistentFlags())
+	return cmd
+}
+
+func (cmd searchCmd) search(text string) error {
+	query, err := pkgalan.NewQuery(text, searchMode, searchFields)
+	if err != nil {
+		return err
+	}
+	printer, err := newPrinter(cmd.out)
+	if err != nil {
+		return err
+	}
+	uri := searchFrom
+	if len(uri) == 0 {
+		uri = "vault:"
+		if len(database) > 0 {
+			uri = keepassURI()
+		}
+	}
+	glog.V(1).Infof("Search %s in %s", text, uri)
+	provider, err := pkgalan.NewProvider(uri)
+	if err != nil {
+		return err
+	}
+	if err := provider.Open(); err != nil {
+		return err
+	}
+	defer provider.Close()
+	tree, err := provider.Load()
+	if err != nil {
+		return err
+	}
+	results := query.Search(tree)
+	return printer.Print(results, func(out io.Writer) error {
+		for _, result := range results {
+			fmt.Fprintf(out, "%s\n", pkgcmd.GreenOut(result.Path))
+		}
+		return nil
+	})
+}
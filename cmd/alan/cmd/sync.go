@@ -0,0 +1,510 @@
+// Copyright (C) 2018 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/mitchellh/go-homedir"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	pkgalan "github.com/nlamirault/alan/pkg/alan"
+	pkgcmd "github.com/nlamirault/alan/pkg/cmd"
+	"github.com/nlamirault/alan/pkg/keepassxc"
+	"github.com/nlamirault/alan/pkg/onepassword"
+	"github.com/nlamirault/alan/pkg/pwsafe"
+)
+
+var (
+	syncFrom     string
+	syncTo       string
+	dryRun       bool
+	twoWay       bool
+	conflict     string
+	syncStateDir string
+	fullSync     bool
+	prune        bool
+)
+
+type syncCmd struct {
+	out io.Writer
+}
+
+func newSyncCmd(out io.Writer) *cobra.Command {
+	syncCmd := &syncCmd{
+		out: out,
+	}
+
+	cmd := &cobra.Command{
+		Use:   "sync",
+		Short: "Synchronize secrets from a password manager to another one",
+		Example: `
+               alan sync --from keepassxc:./alan.kdbx --to vault:secret/alan
+               alan sync --from vault:secret/alan --to keepassxc:./backup.kdbx
+               alan sync --from keepassxc:./alan.kdbx --to vault:secret/alan --two-way --conflict newest`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(syncFrom) == 0 || len(syncTo) == 0 {
+				return fmt.Errorf("missing source or destination. Available providers: %s",
+					strings.Join(pkgalan.Providers(), ", "))
+			}
+			return syncCmd.sync()
+		},
+	}
+	cmd.PersistentFlags().StringVar(&syncFrom, "from", "", "Source: <provider>:<location>")
+	cmd.PersistentFlags().StringVar(&syncTo, "to", "", "Destination: <provider>:<location>")
+	cmd.PersistentFlags().BoolVar(&twoWay, "two-way", false, "Propagate the changes of both providers to each other")
+	cmd.PersistentFlags().StringVar(&conflict, "conflict", pkgalan.ConflictNewest,
+		fmt.Sprintf("Strategy for the secrets modified on both sides with --two-way (%s)", strings.Join(pkgalan.ConflictStrategies, ", ")))
+	cmd.PersistentFlags().BoolVar(&cas, "cas", false, "Use check-and-set writes to avoid overwriting concurrent changes (KV version 2 only)")
+	cmd.PersistentFlags().IntVar(&backups, "backups", pkgalan.DefaultBackups, "Number of backup copies of the KeepassXC database kept when it is overwritten")
+	addPlanFlags(cmd.PersistentFlags())
+	addOutputFlags(cmd.PersistentFlags())
+	cmd.PersistentFlags().StringVar(&database, "database", "", "Database filename of the keepassxc provider without location")
+	addKeepassFlags(cmd.PersistentFlags())
+	addVaultFlags(cmd.PersistentFlags())
+	cmd.AddCommand(newSyncStatusCmd(out))
+	return cmd
+}
+
+func newSyncStatusCmd(out io.Writer) *cobra.Command {
+	syncCmd := &syncCmd{
+		out: out,
+	}
+
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: "Display the secrets changed since the last synchronization",
+		Example: `
+               alan sync status --from keepassxc:./alan.kdbx --to vault:secret/alan`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(syncFrom) == 0 || len(syncTo) == 0 {
+				return fmt.Errorf("missing source or destination. Available providers: %s",
+					strings.Join(pkgalan.Providers(), ", "))
+			}
+			return syncCmd.status()
+		},
+	}
+	return cmd
+}
+
+// registerProviders makes the providers available, configured using the command line flags
+func registerProviders() {
+	pkgalan.RegisterProvider("bitwarden", func(location string) (pkgalan.Provider, error) {
+		if len(location) == 0 {
+			location = bitwardenExport
+		}
+		if len(location) == 0 {
+			return nil, fmt.Errorf("missing export filename")
+		}
+		return newBitwardenProvider(location, false), nil
+	})
+	pkgalan.RegisterProvider("keepassxc", func(location string) (pkgalan.Provider, error) {
+		if len(location) == 0 {
+			location = database
+		}
+		if len(location) == 0 {
+			return nil, fmt.Errorf("missing database name")
+		}
+		client, err := newKeepassClientFor(location)
+		if err != nil {
+			return nil, err
+		}
+		return keepassxc.NewProvider(client, false), nil
+	})
+	pkgalan.RegisterProvider("lastpass", func(location string) (pkgalan.Provider, error) {
+		if len(location) == 0 {
+			location = lastpassExport
+		}
+		if len(location) == 0 {
+			return nil, fmt.Errorf("missing export filename")
+		}
+		return newLastpassProvider(location, false), nil
+	})
+	pkgalan.RegisterProvider("onepassword", func(location string) (pkgalan.Provider, error) {
+		if len(location) == 0 {
+			return nil, fmt.Errorf("missing export filename")
+		}
+		return onepassword.NewProvider(location), nil
+	})
+	pkgalan.RegisterProvider("pwsafe", func(location string) (pkgalan.Provider, error) {
+		if len(location) == 0 {
+			location = pwsafeDatabase
+		}
+		if len(location) == 0 {
+			return nil, fmt.Errorf("missing database name")
+		}
+		client, err := newPwsafeClientFor(location)
+		if err != nil {
+			return nil, err
+		}
+		return pwsafe.NewProvider(client, false), nil
+	})
+	pkgalan.RegisterProvider("vault", func(location string) (pkgalan.Provider, error) {
+		mount, prefix := vaultMount, vaultPrefix
+		if location = strings.Trim(location, "/"); len(location) > 0 {
+			parts := strings.SplitN(location, "/", 2)
+			mount, prefix = parts[0], ""
+			if len(parts) == 2 {
+				prefix = parts[1]
+			}
+		}
+		client, err := newVaultClientFor(mount, prefix)
+		if err != nil {
+			return nil, err
+		}
+		return newVaultProvider(client, cas), nil
+	})
+}
+
+func (cmd syncCmd) sync() error {
+	glog.V(1).Infof("Synchronize %s to %s", syncFrom, syncTo)
+	from, err := pkgalan.NewProvider(syncFrom)
+	if err != nil {
+		return err
+	}
+	to, err := pkgalan.NewProvider(syncTo)
+	if err != nil {
+		return err
+	}
+	if twoWay {
+		return syncBidirectional(cmd.out, syncFrom, from, syncTo, to)
+	}
+	return syncProviders(cmd.out, syncFrom, from, syncTo, to)
+}
+
+func (cmd syncCmd) status() error {
+	from, err := pkgalan.NewProvider(syncFrom)
+	if err != nil {
+		return err
+	}
+	to, err := pkgalan.NewProvider(syncTo)
+	if err != nil {
+		return err
+	}
+	state, err := pkgalan.LoadState(stateFilename(syncFrom, syncTo), syncFrom, syncTo)
+	if err != nil {
+		return err
+	}
+	if err := from.Open(); err != nil {
+		return err
+	}
+	defer pkgalan.Release(from)
+	if err := to.Open(); err != nil {
+		return err
+	}
+	defer pkgalan.Release(to)
+	source, err := from.Load()
+	if err != nil {
+		return err
+	}
+	statuses, err := state.OutOfDate(source, to)
+	if err != nil {
+		return err
+	}
+	printer, err := newPrinter(cmd.out)
+	if err != nil {
+		return err
+	}
+	status := syncStatus{Updated: state.Updated, OutOfDate: statuses}
+	return printer.Print(status, func(out io.Writer) error {
+		if state.Updated.IsZero() {
+			fmt.Fprintf(out, "Never synchronized\n")
+		} else {
+			fmt.Fprintf(out, "Last synchronization: %s\n", state.Updated.Format(time.RFC3339))
+		}
+		if len(statuses) > 0 {
+			w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "STATUS\tPATH")
+			for _, status := range statuses {
+				fmt.Fprintf(w, "%s\t%s\n", status.Status, status.Path)
+			}
+			if err := w.Flush(); err != nil {
+				return err
+			}
+		}
+		fmt.Fprintf(out, "%d secrets out of date\n", len(statuses))
+		return nil
+	})
+}
+
+// syncStatus define the secrets changed since the last synchronization
+type syncStatus struct {
+	Updated   time.Time              `json:"updated"`
+	OutOfDate []pkgalan.SecretStatus `json:"out_of_date"`
+}
+
+// importDestination returns the provider given by --to, or else the Vault one
+func importDestination() (string, pkgalan.Provider, error) {
+	if len(importTo) > 0 {
+		provider, err := pkgalan.NewProvider(importTo)
+		return importTo, provider, err
+	}
+	vaultClient, err := newVaultClient()
+	if err != nil {
+		return "", nil, err
+	}
+	return vaultURI(vaultClient), newVaultProvider(vaultClient, cas), nil
+}
+
+// exportSource returns the provider given by --from, or else the Vault one
+func exportSource() (string, pkgalan.Provider, error) {
+	if len(exportFrom) > 0 {
+		provider, err := pkgalan.NewProvider(exportFrom)
+		return exportFrom, provider, err
+	}
+	vaultClient, err := newVaultClient()
+	if err != nil {
+		return "", nil, err
+	}
+	return vaultURI(vaultClient), newVaultProvider(vaultClient, false), nil
+}
+
+// syncProviders copies the secrets from a provider to another one and displays the changes.
+// Using dry-run, the changes are only displayed, and errChangesPending is
+// returned if there are some.
+// The providers are saved only when the synchronization succeeds.
+func syncProviders(out io.Writer, fromURI string, from pkgalan.Provider, toURI string, to pkgalan.Provider) error {
+	if err := from.Open(); err != nil {
+		return err
+	}
+	defer pkgalan.Release(from)
+	if err := to.Open(); err != nil {
+		return err
+	}
+	defer pkgalan.Release(to)
+	filename := stateFilename(fromURI, toURI)
+	state, err := pkgalan.LoadState(filename, fromURI, toURI)
+	if err != nil {
+		return err
+	}
+	var plan *pkgalan.Plan
+	if fullSync {
+		plan, err = pkgalan.PlanSync(from, to, prune)
+	} else {
+		plan, err = pkgalan.PlanIncrementalSync(from, to, state, prune)
+	}
+	if err != nil {
+		return err
+	}
+	if dryRun {
+		if err := printPlan(out, plan); err != nil {
+			return err
+		}
+		if plan.Pending() > 0 {
+			return errChangesPending
+		}
+		return nil
+	}
+	if err := plan.Apply(to); err != nil {
+		return err
+	}
+	printChanges(out, plan)
+	fmt.Fprintf(out, "%d changes, %d unchanged secrets\n", plan.Pending(), len(plan.Changes)-plan.Pending())
+	plan.Record(state)
+	if err := plan.RecordVersions(to, state); err != nil {
+		return err
+	}
+	if err := to.Close(); err != nil {
+		return err
+	}
+	if err := from.Close(); err != nil {
+		return err
+	}
+	return state.Save(filename)
+}
+
+// syncBidirectional propagates the changes of two providers to each other.
+// The providers are saved only when the synchronization succeeds.
+func syncBidirectional(out io.Writer, fromURI string, from pkgalan.Provider, toURI string, to pkgalan.Provider) error {
+	resolve, err := pkgalan.NewConflictResolver(conflict, promptConflict)
+	if err != nil {
+		return err
+	}
+	if err := from.Open(); err != nil {
+		return err
+	}
+	defer pkgalan.Release(from)
+	if err := to.Open(); err != nil {
+		return err
+	}
+	defer pkgalan.Release(to)
+	source, err := from.Load()
+	if err != nil {
+		return err
+	}
+	destination, err := to.Load()
+	if err != nil {
+		return err
+	}
+	filename := stateFilename(fromURI, toURI)
+	state, err := pkgalan.LoadState(filename, fromURI, toURI)
+	if err != nil {
+		return err
+	}
+	plan, err := pkgalan.NewBidirectionalPlan(source, destination, state, resolve, prune)
+	if err != nil {
+		return err
+	}
+	if dryRun {
+		printer, err := newPrinter(out)
+		if err != nil {
+			return err
+		}
+		if !printer.IsTable() {
+			if err := printer.Print(plan, nil); err != nil {
+				return err
+			}
+			if plan.Pending() > 0 {
+				return errChangesPending
+			}
+			return nil
+		}
+		fmt.Fprintf(out, "%s\n", pkgcmd.BlueOut(fromURI))
+		if err := printPlan(out, plan.Source); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "%s\n", pkgcmd.BlueOut(toURI))
+		if err := printPlan(out, plan.Destination); err != nil {
+			return err
+		}
+		if plan.Pending() > 0 {
+			return errChangesPending
+		}
+		return nil
+	}
+	if err := plan.Source.Apply(from); err != nil {
+		return err
+	}
+	if err := plan.Destination.Apply(to); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "%s\n", pkgcmd.BlueOut(fromURI))
+	printChanges(out, plan.Source)
+	fmt.Fprintf(out, "%s\n", pkgcmd.BlueOut(toURI))
+	printChanges(out, plan.Destination)
+	fmt.Fprintf(out, "%d changes\n", plan.Pending())
+	if err := to.Close(); err != nil {
+		return err
+	}
+	if err := from.Close(); err != nil {
+		return err
+	}
+	return plan.State.Save(filename)
+}
+
+// promptConflict asks the user which version of a secret to keep
+func promptConflict(path string, source *pkgalan.Secret, destination *pkgalan.Secret) (pkgalan.Resolution, error) {
+	fmt.Fprint(os.Stderr, pkgcmd.YellowOut(fmt.Sprintf("Conflict for %s\n", path)))
+	fmt.Fprintf(os.Stderr, "  source modified: %s, destination modified: %s\n", formatTime(source.Modified), formatTime(destination.Modified))
+	for _, field := range pkgalan.Diff(destination, source) {
+		fmt.Fprintf(os.Stderr, "  %s: %q (destination) / %q (source)\n", field.Name, field.Old, field.New)
+	}
+	for {
+		answer, err := pkgcmd.Ask("Keep [s]ource, [d]estination or [b]oth versions? ")
+		if err != nil {
+			return pkgalan.ResolveSource, err
+		}
+		switch strings.ToLower(answer) {
+		case "s", "source":
+			return pkgalan.ResolveSource, nil
+		case "d", "destination":
+			return pkgalan.ResolveDestination, nil
+		case "b", "both":
+			return pkgalan.ResolveBoth, nil
+		}
+	}
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "unknown"
+	}
+	return t.Format(time.RFC3339)
+}
+
+// stateFilename returns the file of the last synchronization state of two providers
+func stateFilename(fromURI string, toURI string) string {
+	dir, err := homedir.Expand(syncStateDir)
+	if err != nil {
+		glog.Warningf("Invalid state directory %s: %s", syncStateDir, err)
+		dir = syncStateDir
+	}
+	return pkgalan.StateFilename(dir, fromURI, toURI)
+}
+
+// printChanges displays the applied changes
+func printChanges(out io.Writer, plan *pkgalan.Plan) {
+	for _, change := range plan.Changes {
+		switch change.Action {
+		case pkgalan.ActionCreate:
+			fmt.Fprint(out, pkgcmd.GreenOut(fmt.Sprintf("Add secret: %s\n", change.Path)))
+		case pkgalan.ActionUpdate:
+			fmt.Fprint(out, pkgcmd.YellowOut(fmt.Sprintf("Update secret: %s\n", change.Path)))
+		case pkgalan.ActionDelete:
+			fmt.Fprint(out, pkgcmd.RedOut(fmt.Sprintf("Delete secret: %s\n", change.Path)))
+		case pkgalan.ActionRecycle:
+			fmt.Fprint(out, pkgcmd.RedOut(fmt.Sprintf("Recycle secret: %s\n", change.Path)))
+		case pkgalan.ActionCreateGroup:
+			fmt.Fprint(out, pkgcmd.GreenOut(fmt.Sprintf("Add group: %s\n", change.Path)))
+		}
+	}
+}
+
+// printPlan displays the changes as a table or as JSON
+func printPlan(out io.Writer, plan *pkgalan.Plan) error {
+	printer, err := newPrinter(out)
+	if err != nil {
+		return err
+	}
+	return printer.Print(plan, func(out io.Writer) error {
+		return printPlanTable(out, plan)
+	})
+}
+
+func printPlanTable(out io.Writer, plan *pkgalan.Plan) error {
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "ACTION\tPATH\tCHANGES")
+	for _, change := range plan.Changes {
+		fields := []string{}
+		for _, field := range change.Fields {
+			if change.Action == pkgalan.ActionCreate {
+				fields = append(fields, field.Name)
+			} else {
+				fields = append(fields, fmt.Sprintf("%s: %q -> %q", field.Name, field.Old, field.New))
+			}
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", change.Action, change.Path, strings.Join(fields, ", "))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "%d changes pending\n", plan.Pending())
+	return nil
+}
+
+// addPlanFlags adds the flags used to preview the changes
+func addPlanFlags(flags *pflag.FlagSet) {
+	flags.BoolVar(&dryRun, "dry-run", false, "Display the changes without applying them. Exit with code 2 if changes are pending")
+	flags.StringVar(&syncStateDir, "state-dir", "~/.alan/state", "Directory of the state of the last synchronizations")
+	flags.BoolVar(&prune, "prune", false, "Delete the destination secrets missing from the source, recycling the ones into its recycle bin")
+	flags.BoolVar(&fullSync, "full", false, "Compare all the secrets instead of the ones changed since the last synchronization")
+}
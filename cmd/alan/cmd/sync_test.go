@@ -0,0 +1,86 @@
+// Copyright (C) 2018 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	pkgalan "github.com/nlamirault/alan/pkg/alan"
+	pkgcmd "github.com/nlamirault/alan/pkg/cmd"
+	"github.com/nlamirault/alan/pkg/lastpass"
+)
+
+// closingProvider counts the Close calls of a provider
+type closingProvider struct {
+	*lastpass.Provider
+	closed int
+}
+
+func (provider *closingProvider) Close() error {
+	provider.closed++
+	return provider.Provider.Close()
+}
+
+func Test_SyncClosesProviders(t *testing.T) {
+	dir, err := ioutil.TempDir("", "alan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(dir string, format string, strategy string, dry bool) {
+		syncStateDir, output, conflict, dryRun = dir, format, strategy, dry
+	}(syncStateDir, output, conflict, dryRun)
+	syncStateDir, output, conflict = dir, pkgcmd.OutputTable, pkgalan.ConflictNewest
+	source := filepath.Join(dir, "source.csv")
+	content := "url,username,password,totp,extra,name,grouping,fav\nhttps://github.com,alan,enigma,,,Github,Dev,0\n"
+	if err := ioutil.WriteFile(source, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	destination := filepath.Join(dir, "destination.csv")
+
+	dryRun = true
+	for _, sync := range []func(io.Writer, string, pkgalan.Provider, string, pkgalan.Provider) error{syncProviders, syncBidirectional} {
+		from := &closingProvider{Provider: lastpass.NewProvider(source, false)}
+		to := &closingProvider{Provider: lastpass.NewProvider(destination, false)}
+		if err := sync(&bytes.Buffer{}, "lastpass:"+source, from, "lastpass:"+destination, to); err != errChangesPending {
+			t.Fatalf("Expected pending changes: %v", err)
+		}
+		if from.closed == 0 || to.closed == 0 {
+			t.Fatalf("Providers not closed: %d %d", from.closed, to.closed)
+		}
+		if _, err := os.Stat(destination); !os.IsNotExist(err) {
+			t.Fatalf("Destination written by a dry run: %v", err)
+		}
+	}
+
+	dryRun = false
+	if err := syncProviders(&bytes.Buffer{}, "lastpass:"+source, lastpass.NewProvider(source, false),
+		"lastpass:"+destination, lastpass.NewProvider(destination, false)); err != nil {
+		t.Fatal(err)
+	}
+	reader := lastpass.NewProvider(destination, false)
+	if err := reader.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer pkgalan.Release(reader)
+	if secret, _ := reader.Read("Dev/Github"); secret == nil || secret.Password != "enigma" {
+		t.Fatalf("Invalid destination: %v", secret)
+	}
+}
@@ -17,9 +17,12 @@ package cmd
 import (
 	"fmt"
 	"io"
+	"strings"
+	"time"
 
 	"github.com/golang/glog"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 
 	pkgalan "github.com/nlamirault/alan/pkg/alan"
 	pkgcmd "github.com/nlamirault/alan/pkg/cmd"
@@ -27,7 +30,19 @@ import (
 )
 
 var (
-	path string
+	path          string
+	secretVersion int
+	recursive     bool
+	depth         int
+	destroy       bool
+	targetPath    string
+	putSecret     pkgalan.Secret
+	putPassword   string
+	putFields     []string
+	generate      bool
+	passwordSize  int
+	noSymbols     bool
+	interactive   bool
 )
 
 type vaultCmd struct {
@@ -52,7 +67,7 @@ func newVaultCmd(out io.Writer) *cobra.Command {
 			if len(path) == 0 {
 				return fmt.Errorf("missing path")
 			}
-			vaultClient, err := vault.NewClient(vaultAddress, "alan", "turing")
+			vaultClient, err := newVaultClient()
 			if err != nil {
 				return err
 			}
@@ -66,7 +81,7 @@ func newVaultCmd(out io.Writer) *cobra.Command {
 			// if len(path) == 0 {
 			// 	return fmt.Errorf("missing path")
 			// }
-			vaultClient, err := vault.NewClient(vaultAddress, "alan", "turing")
+			vaultClient, err := newVaultClient()
 			if err != nil {
 				return err
 			}
@@ -74,44 +89,413 @@ func newVaultCmd(out io.Writer) *cobra.Command {
 		},
 	}
 
-	getCmd.PersistentFlags().StringVar(&path, "path", "", "Vault path")
-	getCmd.PersistentFlags().StringVar(&vaultAddress, "vault", vault.DefaultAddr, "Vault address")
-	listCmd.PersistentFlags().StringVar(&path, "path", "", "Vault path")
-	listCmd.PersistentFlags().StringVar(&vaultAddress, "vault", vault.DefaultAddr, "Vault address")
+	treeCmd := &cobra.Command{
+		Use:   "tree",
+		Short: "Display the hierarchy of the folders and secrets under a path",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			vaultClient, err := newVaultClient()
+			if err != nil {
+				return err
+			}
+			return vaultCmd.tree(vaultClient)
+		},
+	}
+
+	putCmd := &cobra.Command{
+		Use:   "put",
+		Short: "Write a secret under a path",
+		Example: `
+               alan vault put --path Dev/Github --username alan --url https://github.com --generate
+               alan vault put --path Dev/Github --interactive`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(path) == 0 {
+				return fmt.Errorf("missing path")
+			}
+			vaultClient, err := newVaultClient()
+			if err != nil {
+				return err
+			}
+			return vaultCmd.put(vaultClient, cmd.Flags())
+		},
+	}
+
+	rmCmd := &cobra.Command{
+		Use:   "rm",
+		Short: "Delete a secret, or the secrets of a folder",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(path) == 0 {
+				return fmt.Errorf("missing path")
+			}
+			vaultClient, err := newVaultClient()
+			if err != nil {
+				return err
+			}
+			return vaultCmd.remove(vaultClient)
+		},
+	}
+
+	mvCmd := &cobra.Command{
+		Use:   "mv",
+		Short: "Move a secret, or the secrets of a folder, to another path",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(path) == 0 || len(targetPath) == 0 {
+				return fmt.Errorf("missing path or destination")
+			}
+			vaultClient, err := newVaultClient()
+			if err != nil {
+				return err
+			}
+			return vaultCmd.copy(vaultClient, true)
+		},
+	}
+
+	cpCmd := &cobra.Command{
+		Use:   "cp",
+		Short: "Copy a secret, or the secrets of a folder, to another path",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(path) == 0 || len(targetPath) == 0 {
+				return fmt.Errorf("missing path or destination")
+			}
+			vaultClient, err := newVaultClient()
+			if err != nil {
+				return err
+			}
+			return vaultCmd.copy(vaultClient, false)
+		},
+	}
+
+	historyCmd := &cobra.Command{
+		Use:   "history",
+		Short: "Show the versions of a secret",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(path) == 0 {
+				return fmt.Errorf("missing path")
+			}
+			vaultClient, err := newVaultClient()
+			if err != nil {
+				return err
+			}
+			return vaultCmd.history(vaultClient)
+		},
+	}
+
+	cmd.PersistentFlags().StringVar(&path, "path", "", "Vault path")
+	addVaultFlags(cmd.PersistentFlags())
+	addOutputFlags(cmd.PersistentFlags())
+	getCmd.PersistentFlags().IntVar(&secretVersion, "version", 0, "Version of the secret (KV version 2 only)")
+	listCmd.PersistentFlags().BoolVar(&recursive, "recursive", false, "List the secrets of the subfolders")
+	listCmd.PersistentFlags().IntVar(&depth, "depth", 0, "Maximum depth of the subfolders, 0 for no limit")
+	treeCmd.PersistentFlags().IntVar(&depth, "depth", 0, "Maximum depth of the subfolders, 0 for no limit")
+	putCmd.PersistentFlags().StringVar(&putSecret.Username, "username", "", "Username of the secret")
+	putCmd.PersistentFlags().StringVar(&putSecret.URL, "url", "", "URL of the secret")
+	putCmd.PersistentFlags().StringVar(&putSecret.Notes, "notes", "", "Notes of the secret")
+	putCmd.PersistentFlags().StringArrayVar(&putSecret.Tags, "tag", nil, "Tag of the secret")
+	putCmd.PersistentFlags().StringArrayVar(&putFields, "field", nil, "Custom field of the secret: <name>=<value>")
+	putCmd.PersistentFlags().StringVar(&putPassword, "password", "", "Password of the secret. Asked if not set, for a new secret")
+	putCmd.PersistentFlags().BoolVar(&generate, "generate", false, "Generate the password")
+	putCmd.PersistentFlags().IntVar(&passwordSize, "length", pkgcmd.DefaultPasswordLength, "Length of the generated password")
+	putCmd.PersistentFlags().BoolVar(&noSymbols, "no-symbols", false, "Only use letters and digits in the generated password")
+	putCmd.PersistentFlags().BoolVar(&interactive, "interactive", false, "Ask the values of the secret which are not set")
+	putCmd.PersistentFlags().BoolVar(&cas, "cas", false, "Use check-and-set writes to avoid overwriting concurrent changes (KV version 2 only)")
+	rmCmd.PersistentFlags().BoolVar(&recursive, "recursive", false, "Delete the secrets of a folder")
+	rmCmd.PersistentFlags().BoolVar(&destroy, "destroy", false, "Remove all the versions of the secrets (KV version 2 only)")
+	mvCmd.PersistentFlags().StringVar(&targetPath, "to", "", "Destination path")
+	cpCmd.PersistentFlags().StringVar(&targetPath, "to", "", "Destination path")
+	mvCmd.PersistentFlags().BoolVar(&force, "force", false, "Overwrite the existing secrets")
+	cpCmd.PersistentFlags().BoolVar(&force, "force", false, "Overwrite the existing secrets")
 	cmd.AddCommand(getCmd)
 	cmd.AddCommand(listCmd)
+	cmd.AddCommand(treeCmd)
+	cmd.AddCommand(putCmd)
+	cmd.AddCommand(rmCmd)
+	cmd.AddCommand(mvCmd)
+	cmd.AddCommand(cpCmd)
+	cmd.AddCommand(historyCmd)
 	return cmd
 }
 
 func (cmd vaultCmd) get(vaultClient *vault.Client) error {
 	glog.V(1).Infof("Get secret for path %s", path)
+	printer, err := newPrinter(cmd.out)
+	if err != nil {
+		return err
+	}
 	if err := vaultClient.Login(); err != nil {
 		return err
 	}
-	data, err := vaultClient.Read(path)
+	secret, err := vaultClient.ReadSecretVersion(path, secretVersion)
 	if err != nil {
 		return err
 	}
-	glog.V(1).Infof("Vault secret: %s", data)
-	fmt.Printf("Username: %s\nPassword: %s\nURL: %s\n",
-		pkgcmd.GreenOut(data[pkgalan.Username].(string)),
-		pkgcmd.GreenOut(data[pkgalan.Password].(string)),
-		pkgcmd.GreenOut(data[pkgalan.URL].(string)))
-	return nil
+	glog.V(1).Infof("Vault secret: %s", secret.Title)
+	return printer.Print(secret, func(out io.Writer) error {
+		fmt.Fprintf(out, "Username: %s\nPassword: %s\nURL: %s\n",
+			pkgcmd.GreenOut(secret.Username),
+			pkgcmd.GreenOut(secret.Password),
+			pkgcmd.GreenOut(secret.URL))
+		if len(secret.Notes) > 0 {
+			fmt.Fprintf(out, "Notes: %s\n", pkgcmd.GreenOut(secret.Notes))
+		}
+		for _, field := range secret.Fields {
+			fmt.Fprintf(out, "%s: %s\n", field.Name, pkgcmd.GreenOut(field.Value))
+		}
+		for _, attachment := range secret.Attachments {
+			fmt.Fprintf(out, "Attachment: %s (%d bytes)\n", pkgcmd.GreenOut(attachment.Name), len(attachment.Content))
+		}
+		return nil
+	})
 }
 
 func (cmd vaultCmd) list(vaultClient *vault.Client) error {
 	glog.V(1).Infof("List secrets for path %s", path)
+	printer, err := newPrinter(cmd.out)
+	if err != nil {
+		return err
+	}
 	if err := vaultClient.Login(); err != nil {
 		return err
 	}
+	if recursive {
+		return cmd.listRecursive(vaultClient, printer)
+	}
 	data, err := vaultClient.List(path)
 	if err != nil {
 		return err
 	}
 	glog.V(1).Infof("Vault secrets: %s", data)
-	for _, key := range data["keys"].([]interface{}) {
-		fmt.Printf("- %s\n", pkgcmd.GreenOut(key))
+	keys := []string{}
+	values, _ := data["keys"].([]interface{})
+	for _, value := range values {
+		key, _ := value.(string)
+		if !pkgalan.IsReserved(key) {
+			keys = append(keys, key)
+		}
 	}
+	return printer.Print(keys, func(out io.Writer) error {
+		for _, key := range keys {
+			fmt.Fprintf(out, "- %s\n", pkgcmd.GreenOut(key))
+		}
+		return nil
+	})
+}
+
+// listRecursive prints the paths of the secrets under the path, relative to it
+func (cmd vaultCmd) listRecursive(vaultClient *vault.Client, printer *pkgcmd.Printer) error {
+	root := strings.Trim(path, "/")
+	keys := []string{}
+	err := vaultClient.Walk(root, func(key string, folder bool, level int) error {
+		if folder {
+			if depth > 0 && level >= depth {
+				return vault.SkipFolder
+			}
+			return nil
+		}
+		keys = append(keys, strings.TrimPrefix(strings.TrimPrefix(key, root), "/"))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return printer.Print(keys, func(out io.Writer) error {
+		for _, key := range keys {
+			fmt.Fprintf(out, "- %s\n", pkgcmd.GreenOut(key))
+		}
+		return nil
+	})
+}
+
+func (cmd vaultCmd) tree(vaultClient *vault.Client) error {
+	glog.V(1).Infof("Tree of secrets for path %s", path)
+	printer, err := newPrinter(cmd.out)
+	if err != nil {
+		return err
+	}
+	if err := vaultClient.Login(); err != nil {
+		return err
+	}
+	tree, err := vaultClient.Tree(path, depth)
+	if err != nil {
+		return err
+	}
+	return printer.Print(tree, func(out io.Writer) error {
+		name := tree.Path
+		if len(name) == 0 {
+			name = pkgalan.JoinPath(vaultClient.Mount(), vaultClient.Prefix())
+		}
+		fmt.Fprintf(out, "%s %s\n", pkgcmd.BlueOut(name+"/"), folderCount(tree))
+		printFolder(out, tree, "")
+		return nil
+	})
+}
+
+// printFolder prints the content of a folder, indented by prefix
+func printFolder(out io.Writer, folder *vault.Folder, prefix string) {
+	last := len(folder.Folders) + len(folder.Secrets) - 1
+	for i, child := range folder.Folders {
+		branch, indent := "├── ", "│   "
+		if i == last {
+			branch, indent = "└── ", "    "
+		}
+		fmt.Fprintf(out, "%s%s%s %s\n", prefix, branch, pkgcmd.BlueOut(child.Name+"/"), folderCount(child))
+		printFolder(out, child, prefix+indent)
+	}
+	for i, secret := range folder.Secrets {
+		branch := "├── "
+		if len(folder.Folders)+i == last {
+			branch = "└── "
+		}
+		fmt.Fprintf(out, "%s%s%s\n", prefix, branch, pkgcmd.GreenOut(secret))
+	}
+}
+
+func folderCount(folder *vault.Folder) string {
+	if folder.Truncated {
+		return "(...)"
+	}
+	if folder.Count == 1 {
+		return "(1 secret)"
+	}
+	return fmt.Sprintf("(%d secrets)", folder.Count)
+}
+
+func (cmd vaultCmd) put(vaultClient *vault.Client, flags *pflag.FlagSet) error {
+	glog.V(1).Infof("Put secret for path %s", path)
+	names := pkgalan.SplitPath(path)
+	if len(names) == 0 {
+		return fmt.Errorf("missing path")
+	}
+	if err := vaultClient.Login(); err != nil {
+		return err
+	}
+	provider := vault.NewProvider(vaultClient, cas)
+	existing, err := provider.Read(path)
+	if err != nil {
+		return err
+	}
+	secret := pkgalan.Secret{}
+	if existing != nil {
+		secret = *existing
+	}
+	// the title is the name of the secret in its path
+	secret.Title = names[len(names)-1]
+	// the flags which are set override the values of an existing secret
+	for _, attribute := range []struct {
+		name   string
+		flag   string
+		target *string
+	}{
+		{"username", putSecret.Username, &secret.Username},
+		{"url", putSecret.URL, &secret.URL},
+		{"notes", putSecret.Notes, &secret.Notes},
+	} {
+		if flags.Changed(attribute.name) {
+			*attribute.target = attribute.flag
+			continue
+		}
+		if interactive {
+			answer, err := pkgcmd.Ask(fmt.Sprintf("%s [%s]: ", strings.Title(attribute.name), *attribute.target))
+			if err != nil {
+				return err
+			}
+			if len(answer) > 0 {
+				*attribute.target = answer
+			}
+		}
+	}
+	if flags.Changed("tag") {
+		secret.Tags = putSecret.Tags
+	}
+	for _, field := range putFields {
+		parts := strings.SplitN(field, "=", 2)
+		if len(parts) != 2 || len(parts[0]) == 0 {
+			return fmt.Errorf("invalid field: %s", field)
+		}
+		if existing := secret.Field(parts[0]); existing != nil {
+			existing.Value = parts[1]
+		} else {
+			secret.Fields = append(secret.Fields, pkgalan.Field{Name: parts[0], Value: parts[1]})
+		}
+	}
+	switch {
+	case generate:
+		if secret.Password, err = pkgcmd.GeneratePassword(passwordSize, !noSymbols); err != nil {
+			return err
+		}
+	case flags.Changed("password"):
+		secret.Password = putPassword
+	case existing == nil || interactive:
+		password, err := pkgcmd.ReadPassword("Password: ")
+		if err == pkgcmd.ErrNoTerminal {
+			return fmt.Errorf("%s: use --password or --generate", err)
+		}
+		if err != nil {
+			return err
+		}
+		if len(password) > 0 || existing == nil {
+			secret.Password = password
+		}
+	}
+	if err := provider.Write(path, secret); err != nil {
+		return err
+	}
+	fmt.Fprintf(cmd.out, "%s %s\n", pkgcmd.GreenOut("Written:"), path)
 	return nil
 }
+
+func (cmd vaultCmd) remove(vaultClient *vault.Client) error {
+	glog.V(1).Infof("Remove secrets for path %s", path)
+	if err := vaultClient.Login(); err != nil {
+		return err
+	}
+	removed, err := vaultClient.Remove(path, recursive, destroy)
+	for _, key := range removed {
+		fmt.Fprintf(cmd.out, "%s %s\n", pkgcmd.RedOut("Deleted:"), key)
+	}
+	return err
+}
+
+func (cmd vaultCmd) copy(vaultClient *vault.Client, move bool) error {
+	glog.V(1).Infof("Copy secrets for path %s to %s", path, targetPath)
+	if err := vaultClient.Login(); err != nil {
+		return err
+	}
+	operation, label := vaultClient.Copy, "Copied:"
+	if move {
+		operation, label = vaultClient.Move, "Moved:"
+	}
+	copied, err := operation(path, targetPath, force)
+	for _, key := range copied {
+		fmt.Fprintf(cmd.out, "%s %s\n", pkgcmd.GreenOut(label), key)
+	}
+	return err
+}
+
+func (cmd vaultCmd) history(vaultClient *vault.Client) error {
+	glog.V(1).Infof("History of secret for path %s", path)
+	printer, err := newPrinter(cmd.out)
+	if err != nil {
+		return err
+	}
+	if err := vaultClient.Login(); err != nil {
+		return err
+	}
+	versions, err := vaultClient.History(path)
+	if err != nil {
+		return err
+	}
+	return printer.Print(versions, func(out io.Writer) error {
+		for _, version := range versions {
+			status := pkgcmd.GreenOut("active")
+			if version.Destroyed {
+				status = pkgcmd.RedOut("destroyed")
+			} else if !version.DeletionTime.IsZero() {
+				status = pkgcmd.YellowOut(fmt.Sprintf("deleted %s", version.DeletionTime.Format(time.RFC3339)))
+			}
+			fmt.Fprintf(out, "- %s %s %s\n",
+				pkgcmd.BlueOut(fmt.Sprintf("v%d", version.Version)),
+				version.CreatedTime.Format(time.RFC3339),
+				status)
+		}
+		return nil
+	})
+}
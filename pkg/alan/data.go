@@ -14,6 +14,12 @@
 
 package alan
 
+import (
+	"bytes"
+	"strings"
+	"time"
+)
+
 const (
 	Generator = "Alan"
 
@@ -21,12 +27,269 @@ const (
 	Password = "Password"
 	Title    = "Title"
 	URL      = "URL"
+	Notes    = "Notes"
+
+	// UUID is the storage key of the identifier of the secret
+	UUID = "UUID"
+
+	// Tags is the storage key of the tags
+	Tags = "Tags"
+
+	// Fields is the storage key of the custom fields
+	Fields = "Fields"
+
+	// PasswordHistory is the storage key of the previous passwords
+	PasswordHistory = "PasswordHistory"
+
+	// Attachments is the storage key of the attachments
+	Attachments = "Attachments"
+
+	// AttachmentsFolder is the folder which contains the attachments too
+	// large to be stored into their secret
+	AttachmentsFolder = ".attachments"
+
+	// PathSeparator separates the groups of a secret path
+	PathSeparator = "/"
+
+	// TagSeparator separates the tags of a KeepassXC entry
+	TagSeparator = ";"
+
+	// GroupMarker is the name of the entry which keeps an empty group into
+	// storages without folders
+	GroupMarker = ".group"
+
+	// OTPField is the name of the field of the one-time password, as used by KeepassXC
+	OTPField = "otp"
+
+	// URLField is the name of the fields of the additional URLs of a login
+	URLField = "URL"
+
+	// FavoriteTag is the tag of the favorite entries
+	FavoriteTag = "Favorite"
 )
 
 // Secret define the entity for Vault storage
 type Secret struct {
-	Title    string
-	Username string
+	// UUID identifies the secret into its original database (base64 encoded), if any
+	UUID        string
+	Title       string
+	Username    string
+	Password    string
+	URL         string
+	Notes       string
+	Tags        []string
+	Fields      []Field
+	Attachments []Attachment
+	// PasswordHistory are the previous passwords, the oldest first. It isn't compared by Equal.
+	PasswordHistory []PasswordChange
+	// Modified is the last modification time, if known
+	Modified time.Time
+}
+
+// PasswordChange define a previous password of a secret
+type PasswordChange struct {
 	Password string
-	URL      string
+	// Changed is the time the password was replaced, if known
+	Changed time.Time
+}
+
+// Attachment define a binary file attached to a secret
+type Attachment struct {
+	Name    string
+	Content []byte
+}
+
+// Field define a custom field of a secret
+type Field struct {
+	Name      string
+	Value     string
+	Protected bool
+}
+
+// IsStandardField returns true for the fields stored into the Secret attributes
+func IsStandardField(name string) bool {
+	switch name {
+	case Title, Username, Password, URL, Notes:
+		return true
+	}
+	return false
+}
+
+// Field returns the custom field with the given name, or nil
+func (secret *Secret) Field(name string) *Field {
+	for i := range secret.Fields {
+		if secret.Fields[i].Name == name {
+			return &secret.Fields[i]
+		}
+	}
+	return nil
+}
+
+// Attachment returns the attachment with the given name, or nil
+func (secret *Secret) Attachment(name string) *Attachment {
+	for i := range secret.Attachments {
+		if secret.Attachments[i].Name == name {
+			return &secret.Attachments[i]
+		}
+	}
+	return nil
+}
+
+// Equal returns true if both secrets have the same content, ignoring their UUID
+// and their modification time
+func (secret *Secret) Equal(other *Secret) bool {
+	if secret.Title != other.Title || secret.Username != other.Username ||
+		secret.Password != other.Password || secret.URL != other.URL ||
+		secret.Notes != other.Notes ||
+		strings.Join(secret.Tags, TagSeparator) != strings.Join(other.Tags, TagSeparator) ||
+		len(secret.Fields) != len(other.Fields) ||
+		len(secret.Attachments) != len(other.Attachments) {
+		return false
+	}
+	for i := range secret.Fields {
+		if secret.Fields[i] != other.Fields[i] {
+			return false
+		}
+	}
+	for i := range secret.Attachments {
+		if secret.Attachments[i].Name != other.Attachments[i].Name ||
+			!bytes.Equal(secret.Attachments[i].Content, other.Attachments[i].Content) {
+			return false
+		}
+	}
+	return true
+}
+
+// Group define a folder of secrets, which can contain other groups
+type Group struct {
+	Name    string
+	Path    string
+	Secrets []Secret
+	Groups  []*Group
+}
+
+// NewGroup creates a group under the given parent path
+func NewGroup(parentPath string, name string) *Group {
+	return &Group{
+		Name: name,
+		Path: JoinPath(parentPath, EscapeName(name)),
+	}
+}
+
+// GroupTree builds a tree of groups from the names of their levels
+type GroupTree struct {
+	Root   *Group
+	groups map[string]*Group
+}
+
+// NewGroupTree creates a tree with an empty root group
+func NewGroupTree() *GroupTree {
+	root := &Group{Name: "Root"}
+	return &GroupTree{
+		Root:   root,
+		groups: map[string]*Group{"": root},
+	}
+}
+
+// Group returns the group with the given names, creating it and its parents if needed
+func (tree *GroupTree) Group(names []string) *Group {
+	path := GroupPath(names)
+	if group, ok := tree.groups[path]; ok {
+		return group
+	}
+	parent := tree.Group(names[:len(names)-1])
+	group := NewGroup(parent.Path, names[len(names)-1])
+	parent.Groups = append(parent.Groups, group)
+	tree.groups[path] = group
+	return group
+}
+
+// IsEmpty returns true if the group has neither secrets nor subgroups
+func (group *Group) IsEmpty() bool {
+	return len(group.Secrets) == 0 && len(group.Groups) == 0
+}
+
+// Walk calls fn for the group then recursively for all its subgroups
+func (group *Group) Walk(fn func(group *Group) error) error {
+	if err := fn(group); err != nil {
+		return err
+	}
+	for _, subgroup := range group.Groups {
+		if err := subgroup.Walk(fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Index returns the groups and the secrets of the tree by path
+func (group *Group) Index() (map[string]*Group, map[string]*Secret) {
+	groups := map[string]*Group{}
+	secrets := map[string]*Secret{}
+	group.Walk(func(group *Group) error {
+		groups[group.Path] = group
+		for i := range group.Secrets {
+			secrets[SecretPath(group.Path, group.Secrets[i])] = &group.Secrets[i]
+		}
+		return nil
+	})
+	return groups, secrets
+}
+
+// JoinPath joins path elements using the separator, ignoring empty ones
+func JoinPath(elements ...string) string {
+	parts := []string{}
+	for _, element := range elements {
+		element = strings.Trim(element, PathSeparator)
+		if len(element) > 0 {
+			parts = append(parts, element)
+		}
+	}
+	return strings.Join(parts, PathSeparator)
+}
+
+// GroupPath returns the path of the unescaped names
+func GroupPath(names []string) string {
+	elements := []string{}
+	for _, name := range names {
+		elements = append(elements, EscapeName(name))
+	}
+	return JoinPath(elements...)
+}
+
+// SplitPath returns the unescaped names of a path
+func SplitPath(path string) []string {
+	names := []string{}
+	for _, element := range strings.Split(path, PathSeparator) {
+		if len(element) > 0 {
+			names = append(names, UnescapeName(element))
+		}
+	}
+	return names
+}
+
+var (
+	nameEscaper   = strings.NewReplacer("%", "%25", PathSeparator, "%2F")
+	nameUnescaper = strings.NewReplacer("%25", "%", "%2F", PathSeparator, "%2E", ".")
+)
+
+// EscapeName escapes a group or secret name to use it as a path element.
+// A leading dot is escaped too, as these names are reserved (GroupMarker,
+// AttachmentsFolder).
+func EscapeName(name string) string {
+	escaped := nameEscaper.Replace(name)
+	if strings.HasPrefix(escaped, ".") {
+		escaped = "%2E" + escaped[1:]
+	}
+	return escaped
+}
+
+// UnescapeName returns the original name of a path element
+func UnescapeName(element string) string {
+	return nameUnescaper.Replace(element)
+}
+
+// IsReserved returns true if the path element is used internally by alan
+func IsReserved(element string) bool {
+	return strings.HasPrefix(strings.TrimSuffix(element, PathSeparator), ".")
 }
@@ -0,0 +1,112 @@
+// Copyright (C) 2018 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package alan
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/golang/glog"
+)
+
+// DefaultBackups is the default number of backup copies kept when a file is overwritten
+const DefaultBackups = 3
+
+// WriteFile writes a file atomically: the content is written to a temporary
+// file of the same directory, synced then renamed over the original file,
+// keeping its mode. Before overwriting, the original file is copied to
+// <filename>.bak.1, older copies being rotated up to <filename>.bak.<backups>.
+func WriteFile(filename string, backups int, write func(w io.Writer) error) error {
+	mode := os.FileMode(0600)
+	info, err := os.Stat(filename)
+	exists := err == nil
+	if exists {
+		mode = info.Mode().Perm()
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	dir, base := filepath.Split(filename)
+	if len(dir) == 0 {
+		dir = "."
+	}
+	file, err := ioutil.TempFile(dir, "."+base+".tmp")
+	if err != nil {
+		return err
+	}
+	tmpname := file.Name()
+	defer os.Remove(tmpname)
+
+	err = write(file)
+	if err == nil {
+		err = file.Chmod(mode)
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	if exists && backups > 0 {
+		if err := backupFile(filename, backups, mode); err != nil {
+			return fmt.Errorf("Can't backup %s: %s", filename, err)
+		}
+	}
+	glog.V(2).Infof("Rename %s to %s", tmpname, filename)
+	if err := os.Rename(tmpname, filename); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+// backupFile rotates the backup copies then copies the file to the first one
+func backupFile(filename string, backups int, mode os.FileMode) error {
+	for i := backups - 1; i > 0; i-- {
+		src := fmt.Sprintf("%s.bak.%d", filename, i)
+		if _, err := os.Stat(src); err != nil {
+			continue
+		}
+		if err := os.Rename(src, fmt.Sprintf("%s.bak.%d", filename, i+1)); err != nil {
+			return err
+		}
+	}
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	glog.V(1).Infof("Backup %s", filename)
+	return ioutil.WriteFile(filename+".bak.1", content, mode)
+}
+
+// syncDir flushes the directory entries, to persist the rename
+func syncDir(dir string) error {
+	file, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if err := file.Sync(); err != nil {
+		// Some systems, like Windows, can't sync directories
+		glog.V(2).Infof("Can't sync directory %s: %s", dir, err)
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+// Copyright (C) 2018 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package alan
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeContent(content string) func(w io.Writer) error {
+	return func(w io.Writer) error {
+		_, err := io.WriteString(w, content)
+		return err
+	}
+}
+
+func Test_WriteFileWithBackups(t *testing.T) {
+	dir, err := ioutil.TempDir("", "alan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "alan.kdbx")
+	if err := WriteFile(filename, 2, writeContent("v1")); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Fatalf("Invalid mode: %v", info.Mode())
+	}
+	if err := os.Chmod(filename, 0640); err != nil {
+		t.Fatal(err)
+	}
+	for _, content := range []string{"v2", "v3", "v4"} {
+		if err := WriteFile(filename, 2, writeContent(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected := map[string]string{"": "v4", ".bak.1": "v3", ".bak.2": "v2"}
+	for suffix, content := range expected {
+		data, err := ioutil.ReadFile(filename + suffix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != content {
+			t.Fatalf("Invalid content for %s: %s", suffix, data)
+		}
+	}
+	if info, _ := os.Stat(filename); info.Mode().Perm() != 0640 {
+		t.Fatalf("Mode not kept: %v", info.Mode())
+	}
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 3 {
+		t.Fatalf("Invalid files: %v", files)
+	}
+}
+
+func Test_WriteFileError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "alan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "alan.kdbx")
+	if err := WriteFile(filename, 2, writeContent("v1")); err != nil {
+		t.Fatal(err)
+	}
+	err = WriteFile(filename, 2, func(w io.Writer) error {
+		io.WriteString(w, "partial")
+		return fmt.Errorf("encoding error")
+	})
+	if err == nil {
+		t.Fatal("Expected an error")
+	}
+	if data, _ := ioutil.ReadFile(filename); string(data) != "v1" {
+		t.Fatalf("Original file modified: %s", data)
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 1 {
+		t.Fatalf("Temporary files left: %v", files)
+	}
+}
@@ -0,0 +1,167 @@
+// Copyright (C) 2018 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package alan
+
+import (
+	"strings"
+)
+
+// MappingRule stores the secrets of a group under another path of a provider
+type MappingRule struct {
+	// Path is the path of the group exposed
+	Path string
+	// Target is the path of the group into the provider
+	Target string
+}
+
+// mappedProvider exposes the secrets of a provider under other paths
+type mappedProvider struct {
+	Provider
+	rules []MappingRule
+}
+
+// NewMappedProvider exposes the secrets of a provider with their paths
+// rewritten using the rules. The first rule matching a path is used.
+func NewMappedProvider(provider Provider, rules []MappingRule) Provider {
+	if len(rules) == 0 {
+		return provider
+	}
+	return &mappedProvider{
+		Provider: provider,
+		rules:    rules,
+	}
+}
+
+// rewrite replaces the from prefix of the path
+func rewrite(path string, from string, to string) (string, bool) {
+	from = strings.Trim(from, PathSeparator)
+	switch {
+	case path == from:
+		return strings.Trim(to, PathSeparator), true
+	case len(from) == 0:
+		return JoinPath(to, path), true
+	case strings.HasPrefix(path, from+PathSeparator):
+		return JoinPath(to, strings.TrimPrefix(path, from+PathSeparator)), true
+	}
+	return path, false
+}
+
+// target returns the path into the provider
+func (provider *mappedProvider) target(path string) string {
+	for _, rule := range provider.rules {
+		if target, ok := rewrite(path, rule.Path, rule.Target); ok {
+			return target
+		}
+	}
+	return path
+}
+
+// source returns the path exposed
+func (provider *mappedProvider) source(path string) string {
+	for _, rule := range provider.rules {
+		if source, ok := rewrite(path, rule.Target, rule.Path); ok {
+			return source
+		}
+	}
+	return path
+}
+
+// Load returns the tree of the provider, with the groups moved using the rules
+func (provider *mappedProvider) Load() (*Group, error) {
+	tree, err := provider.Provider.Load()
+	if err != nil {
+		return nil, err
+	}
+	mapped := &Group{Name: tree.Name}
+	groups := map[string]*Group{"": mapped}
+	var mkGroup func(path string) *Group
+	mkGroup = func(path string) *Group {
+		if group, ok := groups[path]; ok {
+			return group
+		}
+		parentPath, name := "", path
+		if i := strings.LastIndex(path, PathSeparator); i >= 0 {
+			parentPath, name = path[:i], path[i+1:]
+		}
+		parent := mkGroup(parentPath)
+		group := NewGroup(parent.Path, UnescapeName(name))
+		parent.Groups = append(parent.Groups, group)
+		groups[path] = group
+		return group
+	}
+	tree.Walk(func(group *Group) error {
+		path := provider.source(group.Path)
+		if len(group.Secrets) > 0 || (group.IsEmpty() && len(group.Path) > 0) {
+			target := mkGroup(path)
+			target.Secrets = append(target.Secrets, group.Secrets...)
+		}
+		return nil
+	})
+	return mapped, nil
+}
+
+// Read returns the secret from its path into the provider
+func (provider *mappedProvider) Read(path string) (*Secret, error) {
+	return provider.Provider.Read(provider.target(path))
+}
+
+// Write stores the secret under its path into the provider
+func (provider *mappedProvider) Write(path string, secret Secret) error {
+	return provider.Provider.Write(provider.target(path), secret)
+}
+
+// Delete removes the secret from its path into the provider
+func (provider *mappedProvider) Delete(path string) error {
+	return provider.Provider.Delete(provider.target(path))
+}
+
+// CreateGroup creates the group under its path into the provider
+func (provider *mappedProvider) CreateGroup(path string) error {
+	return provider.Provider.CreateGroup(provider.target(path))
+}
+
+// Recycled returns the recycled secrets of the provider, if any
+func (provider *mappedProvider) Recycled() []RecycledSecret {
+	recycling, ok := provider.Provider.(RecyclingProvider)
+	if !ok {
+		return nil
+	}
+	recycled := []RecycledSecret{}
+	for _, secret := range recycling.Recycled() {
+		recycled = append(recycled, RecycledSecret{Path: provider.source(secret.Path), UUID: secret.UUID})
+	}
+	return recycled
+}
+
+// Recycle moves the secret into the recycle bin of the provider, or removes it
+func (provider *mappedProvider) Recycle(path string) error {
+	return recycle(provider.Provider, provider.target(path))
+}
+
+// Discard drops the changes of the provider, if it keeps them until it is closed
+func (provider *mappedProvider) Discard() {
+	if discarding, ok := provider.Provider.(DiscardingProvider); ok {
+		discarding.Discard()
+	}
+}
+
+// Version returns the version of the secret, 0 if the provider isn't versioned
+func (provider *mappedProvider) Version(path string) (int, error) {
+	versioned, ok := provider.Provider.(VersionedProvider)
+	if !ok {
+		return 0, nil
+	}
+	return versioned.Version(provider.target(path))
+}
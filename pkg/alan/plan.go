@@ -0,0 +1,491 @@
+// Copyright (C) 2018 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package alan
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/golang/glog"
+)
+
+// Action define a modification of a destination
+type Action string
+
+const (
+	// ActionCreate creates a secret
+	ActionCreate Action = "create"
+	// ActionUpdate modifies a secret
+	ActionUpdate Action = "update"
+	// ActionUnchanged keeps a secret
+	ActionUnchanged Action = "unchanged"
+	// ActionDelete removes a secret
+	ActionDelete Action = "delete"
+	// ActionRecycle moves a secret into the recycle bin, or removes it
+	ActionRecycle Action = "recycle"
+	// ActionCreateGroup creates an empty group
+	ActionCreateGroup Action = "create-group"
+)
+
+// Mask replaces the protected values displayed
+const Mask = "********"
+
+// FieldChange define the modification of a field of a secret
+type FieldChange struct {
+	Name string `json:"name"`
+	Old  string `json:"old"`
+	New  string `json:"new"`
+}
+
+// Change define a modification of a destination
+type Change struct {
+	Action Action `json:"action"`
+	Path   string `json:"path"`
+	// From is the previous path of a moved secret
+	From   string        `json:"from,omitempty"`
+	Fields []FieldChange `json:"fields,omitempty"`
+	// Secret is the content to write
+	Secret *Secret `json:"-"`
+}
+
+// Plan define the changes needed to synchronize a destination with a source
+type Plan struct {
+	Changes []Change `json:"changes"`
+}
+
+// NewPlan compares the source and the destination trees.
+// Using prune, the secrets of the destination missing from the source are deleted.
+// Several source secrets with the same path are an error, as only one of them
+// could be written.
+func NewPlan(from *Group, to *Group, prune bool) (*Plan, error) {
+	groups, secrets := to.Index()
+	plan := &Plan{Changes: []Change{}}
+	sources := map[string]bool{}
+	err := from.Walk(func(group *Group) error {
+		if group.IsEmpty() && len(group.Path) > 0 {
+			if _, ok := groups[group.Path]; !ok {
+				plan.Changes = append(plan.Changes, Change{Action: ActionCreateGroup, Path: group.Path})
+			}
+			return nil
+		}
+		for i := range group.Secrets {
+			secret := &group.Secrets[i]
+			if len(secret.Title) == 0 {
+				glog.Warningf("Skipping secret without title into %s: %s %s", group.Path, secret.Username, secret.URL)
+				continue
+			}
+			path := SecretPath(group.Path, *secret)
+			if sources[path] {
+				return duplicateError(path)
+			}
+			sources[path] = true
+			plan.Changes = append(plan.Changes, newChange(path, secrets[path], secret))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if prune {
+		paths := []string{}
+		for path := range secrets {
+			if !sources[path] {
+				paths = append(paths, path)
+			}
+		}
+		plan.addDeletes(paths)
+	}
+	return plan, nil
+}
+
+func duplicateError(path string) error {
+	return fmt.Errorf("Duplicate secret %s: several entries have the same title into the group", path)
+}
+
+// newChange returns the change from the current secret, nil if missing, to the new one
+func newChange(path string, current *Secret, secret *Secret) Change {
+	change := Change{Action: ActionCreate, Path: path, Secret: secret}
+	if current != nil {
+		change.Fields = Diff(current, secret)
+		change.Action = ActionUpdate
+		if len(change.Fields) == 0 {
+			change.Action = ActionUnchanged
+		}
+	} else {
+		change.Fields = Diff(&Secret{}, secret)
+	}
+	return change
+}
+
+func (plan *Plan) addDeletes(paths []string) {
+	sort.Strings(paths)
+	for _, path := range paths {
+		plan.Changes = append(plan.Changes, Change{Action: ActionDelete, Path: path})
+	}
+}
+
+// NewIncrementalPlan compares the source to the state of the last synchronization.
+// Only the secrets changed since are read from the destination. The secrets
+// renamed or moved since are moved into the destination. Pruning removes the
+// synchronized secrets deleted from the source.
+func NewIncrementalPlan(from *Group, to Provider, state *State, prune bool) (*Plan, error) {
+	plan := &Plan{Changes: []Change{}}
+	sources := map[string]bool{}
+	synchronized := map[string]bool{}
+	err := from.Walk(func(group *Group) error {
+		if group.IsEmpty() && len(group.Path) > 0 {
+			if !state.hasGroup(group.Path) {
+				plan.Changes = append(plan.Changes, Change{Action: ActionCreateGroup, Path: group.Path})
+			}
+			return nil
+		}
+		for i := range group.Secrets {
+			secret := &group.Secrets[i]
+			if len(secret.Title) == 0 {
+				glog.Warningf("Skipping secret without title into %s: %s %s", group.Path, secret.Username, secret.URL)
+				continue
+			}
+			path := SecretPath(group.Path, *secret)
+			if sources[path] {
+				return duplicateError(path)
+			}
+			sources[path] = true
+			synced, ok := state.lookup(path, secret)
+			if ok {
+				synchronized[stateKey(synced.Path, synced.UUID)] = true
+			}
+			if ok && synced.Hash == Hash(secret) && synced.Path == path {
+				plan.Changes = append(plan.Changes, Change{Action: ActionUnchanged, Path: path, Secret: secret})
+				continue
+			}
+			current, err := to.Read(path)
+			if err == nil && current == nil && ok && synced.Path != path {
+				// compared to the secret before its move
+				current, err = to.Read(synced.Path)
+			}
+			if err != nil {
+				return err
+			}
+			change := newChange(path, current, secret)
+			if ok && synced.Path != path {
+				change.From = synced.Path
+				if change.Action == ActionUnchanged {
+					change.Action = ActionUpdate
+				}
+			}
+			plan.Changes = append(plan.Changes, change)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i, change := range plan.Changes {
+		// the previous path is used by another secret now
+		if len(change.From) > 0 && sources[change.From] {
+			plan.Changes[i].From = ""
+		}
+	}
+	if prune {
+		paths := []string{}
+		for key, synced := range state.Secrets {
+			if !synchronized[key] && !sources[synced.Path] {
+				paths = append(paths, synced.Path)
+			}
+		}
+		plan.addDeletes(paths)
+	}
+	return plan, nil
+}
+
+// Pending returns the number of changes to apply
+func (plan *Plan) Pending() int {
+	pending := 0
+	for _, change := range plan.Changes {
+		if change.Action != ActionUnchanged {
+			pending++
+		}
+	}
+	return pending
+}
+
+// Apply performs the changes on the destination
+func (plan *Plan) Apply(to Provider) error {
+	for _, change := range plan.Changes {
+		glog.V(1).Infof("Apply change: %s %s", change.Action, change.Path)
+		var err error
+		switch change.Action {
+		case ActionCreate, ActionUpdate:
+			if err = to.Write(change.Path, *change.Secret); err == nil && len(change.From) > 0 {
+				err = deleteMoved(to, change.From)
+			}
+		case ActionDelete:
+			err = to.Delete(change.Path)
+		case ActionRecycle:
+			err = recycle(to, change.Path)
+		case ActionCreateGroup:
+			err = to.CreateGroup(change.Path)
+		}
+		if err != nil {
+			return fmt.Errorf("Can't %s %s: %s", change.Action, change.Path, err)
+		}
+	}
+	return nil
+}
+
+// deleteMoved removes the previous secret of a moved one, if the provider
+// didn't move it by itself
+func deleteMoved(to Provider, path string) error {
+	secret, err := to.Read(path)
+	if err != nil || secret == nil {
+		return err
+	}
+	return recycle(to, path)
+}
+
+// recycle moves a secret into the recycle bin of the provider, or removes it
+func recycle(to Provider, path string) error {
+	if recycling, ok := to.(RecyclingProvider); ok {
+		return recycling.Recycle(path)
+	}
+	return to.Delete(path)
+}
+
+// recycleDeletes turns into recycles the deletions of the secrets recycled into
+// the source. They are matched by path, or by the UUID of the destination secret.
+func (plan *Plan) recycleDeletes(from Provider, uuid func(path string) string) {
+	recycling, ok := from.(RecyclingProvider)
+	if !ok {
+		return
+	}
+	paths := map[string]bool{}
+	uuids := map[string]bool{}
+	for _, recycled := range recycling.Recycled() {
+		paths[recycled.Path] = true
+		if len(recycled.UUID) > 0 {
+			uuids[recycled.UUID] = true
+		}
+	}
+	for i, change := range plan.Changes {
+		if change.Action == ActionDelete && (paths[change.Path] || uuids[uuid(change.Path)]) {
+			plan.Changes[i].Action = ActionRecycle
+		}
+	}
+}
+
+// Record replaces the secrets of the state by the synchronized ones
+func (plan *Plan) Record(state *State) {
+	previous := &State{Secrets: state.Secrets}
+	state.Secrets = map[string]SecretState{}
+	for _, change := range plan.Changes {
+		switch {
+		case change.Action == ActionCreateGroup:
+			if !state.hasGroup(change.Path) {
+				state.Groups = append(state.Groups, change.Path)
+			}
+		case change.Secret != nil && change.Action != ActionDelete && change.Action != ActionRecycle:
+			state.Secrets[stateKey(change.Path, change.Secret.UUID)] = newSecretState(previous, change.Path, change.Secret)
+		}
+	}
+}
+
+// RecordVersions stores into the state the versions of the written secrets,
+// if the destination is versioned
+func (plan *Plan) RecordVersions(to Provider, state *State) error {
+	versioned, ok := to.(VersionedProvider)
+	if !ok {
+		return nil
+	}
+	for _, change := range plan.Changes {
+		if change.Secret == nil || (change.Action != ActionCreate && change.Action != ActionUpdate) {
+			continue
+		}
+		key := stateKey(change.Path, change.Secret.UUID)
+		synced, ok := state.Secrets[key]
+		if !ok {
+			continue
+		}
+		version, err := versioned.Version(change.Path)
+		if err != nil {
+			return err
+		}
+		synced.Version = version
+		state.Secrets[key] = synced
+	}
+	return nil
+}
+
+// Sync copies the secrets and the groups of the source to the destination.
+// Secrets with the same content are not written again.
+func Sync(from Provider, to Provider, prune bool) (*Plan, error) {
+	plan, err := PlanSync(from, to, prune)
+	if err != nil {
+		return nil, err
+	}
+	if err := plan.Apply(to); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// PlanSync computes the changes needed to synchronize the destination with the source.
+// Pruning recycles the secrets found into the recycle bin of the source.
+func PlanSync(from Provider, to Provider, prune bool) (*Plan, error) {
+	source, err := from.Load()
+	if err != nil {
+		return nil, err
+	}
+	destination, err := to.Load()
+	if err != nil {
+		return nil, err
+	}
+	plan, err := NewPlan(source, destination, prune)
+	if err != nil {
+		return nil, err
+	}
+	_, secrets := destination.Index()
+	plan.recycleDeletes(from, func(path string) string {
+		if secret, ok := secrets[path]; ok {
+			return secret.UUID
+		}
+		return ""
+	})
+	return plan, nil
+}
+
+// PlanIncrementalSync loads the source and compares it to the state of the
+// last synchronization. Without state, the full trees are compared.
+func PlanIncrementalSync(from Provider, to Provider, state *State, prune bool) (*Plan, error) {
+	if len(state.Secrets) == 0 {
+		return PlanSync(from, to, prune)
+	}
+	source, err := from.Load()
+	if err != nil {
+		return nil, err
+	}
+	plan, err := NewIncrementalPlan(source, to, state, prune)
+	if err != nil {
+		return nil, err
+	}
+	plan.recycleDeletes(from, func(path string) string {
+		synced, _ := state.find(path)
+		return synced.UUID
+	})
+	return plan, nil
+}
+
+// Diff returns the fields modified between two versions of a secret.
+// Passwords and protected fields are masked.
+func Diff(old *Secret, new *Secret) []FieldChange {
+	changes := []FieldChange{}
+	diff := func(name string, oldValue string, newValue string, protected bool) {
+		if oldValue == newValue {
+			return
+		}
+		if protected {
+			oldValue, newValue = mask(oldValue), mask(newValue)
+		}
+		changes = append(changes, FieldChange{Name: name, Old: oldValue, New: newValue})
+	}
+	diff(Title, old.Title, new.Title, false)
+	diff(Username, old.Username, new.Username, false)
+	diff(Password, old.Password, new.Password, true)
+	diff(URL, old.URL, new.URL, false)
+	diff(Notes, old.Notes, new.Notes, false)
+	diff(Tags, strings.Join(old.Tags, TagSeparator), strings.Join(new.Tags, TagSeparator), false)
+
+	for _, name := range fieldNames(old, new) {
+		oldField, newField := old.Field(name), new.Field(name)
+		oldValue, newValue, protected := "", "", false
+		if oldField != nil {
+			oldValue, protected = oldField.Value, oldField.Protected
+		}
+		if newField != nil {
+			newValue, protected = newField.Value, protected || newField.Protected
+		}
+		diff(name, oldValue, newValue, protected)
+		if oldField != nil && newField != nil && oldValue == newValue && oldField.Protected != newField.Protected {
+			changes = append(changes, FieldChange{Name: name, Old: protection(oldField.Protected), New: protection(newField.Protected)})
+		}
+	}
+
+	for _, name := range attachmentNames(old, new) {
+		oldAttachment, newAttachment := old.Attachment(name), new.Attachment(name)
+		if oldAttachment != nil && newAttachment != nil && bytes.Equal(oldAttachment.Content, newAttachment.Content) {
+			continue
+		}
+		changes = append(changes, FieldChange{
+			Name: "Attachment " + name,
+			Old:  attachmentSize(oldAttachment),
+			New:  attachmentSize(newAttachment),
+		})
+	}
+	if len(changes) == 0 && !old.Equal(new) {
+		// Same values in a different order
+		changes = append(changes, FieldChange{Name: "Order"})
+	}
+	return changes
+}
+
+func mask(value string) string {
+	if len(value) == 0 {
+		return ""
+	}
+	return Mask
+}
+
+func protection(protected bool) string {
+	if protected {
+		return "protected"
+	}
+	return "unprotected"
+}
+
+func attachmentSize(attachment *Attachment) string {
+	if attachment == nil {
+		return ""
+	}
+	return fmt.Sprintf("%d bytes", len(attachment.Content))
+}
+
+func fieldNames(secrets ...*Secret) []string {
+	names := []string{}
+	seen := map[string]bool{}
+	for _, secret := range secrets {
+		for _, field := range secret.Fields {
+			if !seen[field.Name] {
+				seen[field.Name] = true
+				names = append(names, field.Name)
+			}
+		}
+	}
+	return names
+}
+
+func attachmentNames(secrets ...*Secret) []string {
+	names := []string{}
+	seen := map[string]bool{}
+	for _, secret := range secrets {
+		for _, attachment := range secret.Attachments {
+			if !seen[attachment.Name] {
+				seen[attachment.Name] = true
+				names = append(names, attachment.Name)
+			}
+		}
+	}
+	return names
+}
@@ -0,0 +1,306 @@
+// Copyright (C) 2018 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package alan
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_Sync(t *testing.T) {
+	from := newMemoryProvider(map[string]Secret{
+		"Dev/Github":    {Title: "Github", Password: "turing"},
+		"Dev/Gitlab":    {Title: "Gitlab", Password: "enigma"},
+		"Social/a%2Fb":  {Title: "a/b", Password: "bombe"},
+		"Social/Empty":  {},
+		"Perso/Twitter": {Title: "Twitter", Password: "colossus"},
+	})
+	from.CreateGroup("Work")
+	to := newMemoryProvider(map[string]Secret{
+		"Dev/Github":     {Title: "Github", Password: "turing"},
+		"Dev/Gitlab":     {Title: "Gitlab", Password: "old"},
+		"Perso/Mastodon": {Title: "Mastodon"},
+	})
+
+	plan, err := Sync(from, to, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	actions := map[string]Action{}
+	for _, change := range plan.Changes {
+		actions[change.Path] = change.Action
+	}
+	expected := map[string]Action{
+		"Dev/Github":    ActionUnchanged,
+		"Dev/Gitlab":    ActionUpdate,
+		"Social/a%2Fb":  ActionCreate,
+		"Perso/Twitter": ActionCreate,
+		"Work":          ActionCreateGroup,
+	}
+	if len(actions) != len(expected) || plan.Pending() != 4 {
+		t.Fatalf("Invalid changes: %v", actions)
+	}
+	for path, action := range expected {
+		if actions[path] != action {
+			t.Fatalf("Invalid action for %s: %v", path, actions)
+		}
+	}
+	if len(to.secrets) != 5 || to.secrets["Dev/Gitlab"].Password != "enigma" || !to.groups["Work"] {
+		t.Fatalf("Invalid destination: %v %v", to.secrets, to.groups)
+	}
+
+	plan, err = Sync(from, to, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.Pending() != 0 || len(plan.Changes) != 4 {
+		t.Fatalf("Invalid second sync: %#v", plan)
+	}
+
+	plan, err = Sync(from, to, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.Pending() != 1 || plan.Changes[len(plan.Changes)-1].Path != "Perso/Mastodon" {
+		t.Fatalf("Invalid prune: %#v", plan)
+	}
+	if _, ok := to.secrets["Perso/Mastodon"]; ok {
+		t.Fatalf("Secret not deleted: %v", to.secrets)
+	}
+}
+
+func Test_SyncDuplicates(t *testing.T) {
+	from := newMemoryProvider(map[string]Secret{
+		"Dev/Github":      {Title: "Github", Password: "turing"},
+		"Dev/Github (2)":  {Title: "Github", Password: "enigma"},
+		"Perso/Bitbucket": {Title: "Bitbucket"},
+	})
+	to := newMemoryProvider(map[string]Secret{})
+	if _, err := Sync(from, to, false); err == nil || !strings.Contains(err.Error(), "Dev/Github") {
+		t.Fatalf("Expected a duplicate error: %v", err)
+	}
+	if len(to.secrets) != 0 {
+		t.Fatalf("Secrets written: %v", to.secrets)
+	}
+	tree, _ := from.Load()
+	if _, err := NewIncrementalPlan(tree, to, NewState("from", "to"), false); err == nil {
+		t.Fatal("Expected a duplicate error")
+	}
+}
+
+func Test_Diff(t *testing.T) {
+	old := &Secret{
+		Title:    "AWS",
+		Password: "turing",
+		URL:      "https://aws.amazon.com",
+		Fields:   []Field{{Name: "API key", Value: "AKIA"}, {Name: "PIN", Value: "1234", Protected: true}},
+	}
+	new := &Secret{
+		Title:       "AWS",
+		Password:    "enigma",
+		URL:         "https://console.aws.amazon.com",
+		Fields:      []Field{{Name: "API key", Value: "AKIA"}, {Name: "PIN", Value: "5678", Protected: true}},
+		Attachments: []Attachment{{Name: "key.pem", Content: []byte("key")}},
+	}
+	expected := []FieldChange{
+		{Name: Password, Old: Mask, New: Mask},
+		{Name: URL, Old: "https://aws.amazon.com", New: "https://console.aws.amazon.com"},
+		{Name: "PIN", Old: Mask, New: Mask},
+		{Name: "Attachment key.pem", Old: "", New: "3 bytes"},
+	}
+	changes := Diff(old, new)
+	if len(changes) != len(expected) {
+		t.Fatalf("Invalid changes: %v", changes)
+	}
+	for i, change := range expected {
+		if changes[i] != change {
+			t.Fatalf("Invalid change %d: %v", i, changes[i])
+		}
+	}
+	if changes := Diff(new, new); len(changes) != 0 {
+		t.Fatalf("Unexpected changes: %v", changes)
+	}
+}
+
+func Test_IncrementalSync(t *testing.T) {
+	from := newMemoryProvider(map[string]Secret{
+		"Dev/Github": {Title: "Github", Password: "turing"},
+		"Dev/Gitlab": {Title: "Gitlab", Password: "enigma"},
+	})
+	to := newMemoryProvider(map[string]Secret{})
+	state := NewState("from", "to")
+	plan, err := PlanIncrementalSync(from, to, state, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := plan.Apply(to); err != nil {
+		t.Fatal(err)
+	}
+	plan.Record(state)
+	if len(state.Secrets) != 2 {
+		t.Fatalf("Invalid state: %v", state.Secrets)
+	}
+
+	// Secrets unchanged since the state are not read from the destination
+	to.secrets["Dev/Github"] = Secret{Title: "Github", Password: "modified"}
+	from.secrets["Dev/Gitlab"] = Secret{Title: "Gitlab", Password: "bombe"}
+	from.secrets["Dev/Bitbucket"] = Secret{Title: "Bitbucket"}
+	delete(from.secrets, "Dev/Github")
+	plan, err = PlanIncrementalSync(from, to, state, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	actions := map[string]Action{}
+	for _, change := range plan.Changes {
+		actions[change.Path] = change.Action
+	}
+	if len(actions) != 3 || actions["Dev/Gitlab"] != ActionUpdate || actions["Dev/Bitbucket"] != ActionCreate || actions["Dev/Github"] != ActionDelete {
+		t.Fatalf("Invalid incremental changes: %v", actions)
+	}
+
+	tree, _ := from.Load()
+	statuses, err := state.OutOfDate(tree, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []SecretStatus{
+		{Path: "Dev/Bitbucket", Status: StatusNew},
+		{Path: "Dev/Github", Status: StatusDeleted},
+		{Path: "Dev/Gitlab", Status: StatusModified},
+	}
+	if len(statuses) != len(expected) {
+		t.Fatalf("Invalid status: %v", statuses)
+	}
+	for i := range expected {
+		if statuses[i] != expected[i] {
+			t.Fatalf("Invalid status: %v", statuses)
+		}
+	}
+}
+
+func Test_IncrementalSyncRename(t *testing.T) {
+	from := newMemoryProvider(map[string]Secret{
+		"Dev/Github": {UUID: "1", Title: "Github", Password: "turing"},
+		"Dev/Gitlab": {UUID: "2", Title: "Gitlab", Password: "enigma"},
+	})
+	to := newMemoryProvider(map[string]Secret{})
+	state := NewState("from", "to")
+	plan, err := PlanIncrementalSync(from, to, state, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := plan.Apply(to); err != nil {
+		t.Fatal(err)
+	}
+	plan.Record(state)
+
+	// the secrets are matched by UUID once renamed or moved
+	delete(from.secrets, "Dev/Github")
+	delete(from.secrets, "Dev/Gitlab")
+	from.secrets["Dev/GitHub"] = Secret{UUID: "1", Title: "GitHub", Password: "turing"}
+	from.secrets["Archive/Gitlab"] = Secret{UUID: "2", Title: "Gitlab", Password: "enigma"}
+	tree, _ := from.Load()
+	statuses, err := state.OutOfDate(tree, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []SecretStatus{
+		{Path: "Archive/Gitlab", Status: StatusMoved},
+		{Path: "Dev/GitHub", Status: StatusModified},
+	}
+	if len(statuses) != len(expected) || statuses[0] != expected[0] || statuses[1] != expected[1] {
+		t.Fatalf("Invalid status: %v", statuses)
+	}
+	plan, err = PlanIncrementalSync(from, to, state, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, change := range plan.Changes {
+		if change.Action != ActionUpdate || len(change.From) == 0 {
+			t.Fatalf("Invalid incremental change: %v", change)
+		}
+	}
+	if err := plan.Apply(to); err != nil {
+		t.Fatal(err)
+	}
+	plan.Record(state)
+	if len(to.secrets) != 2 || to.secrets["Dev/GitHub"].Title != "GitHub" || to.secrets["Archive/Gitlab"].Password != "enigma" {
+		t.Fatalf("Invalid renamed secrets: %v", to.secrets)
+	}
+	if len(state.Secrets) != 2 || state.Secrets["2"].Path != "Archive/Gitlab" {
+		t.Fatalf("Invalid state: %v", state.Secrets)
+	}
+}
+
+func Test_LoadPathState(t *testing.T) {
+	dir, err := ioutil.TempDir("", "alan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "state.json")
+	data := `{"secrets":{"Dev/Github":{"uuid":"1","hash":"a"},"Dev/Gitlab":{"hash":"b"}}}`
+	if err := ioutil.WriteFile(filename, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	state, err := LoadState(filename, "from", "to")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Secrets["1"].Path != "Dev/Github" || state.Secrets["Dev/Gitlab"].Path != "Dev/Gitlab" {
+		t.Fatalf("Invalid state: %v", state.Secrets)
+	}
+}
+
+type recyclingProvider struct {
+	*memoryProvider
+	recycled []RecycledSecret
+}
+
+func (provider *recyclingProvider) Recycled() []RecycledSecret { return provider.recycled }
+
+func (provider *recyclingProvider) Recycle(path string) error {
+	provider.recycled = append(provider.recycled, RecycledSecret{Path: path})
+	return provider.Delete(path)
+}
+
+func Test_SyncRecycle(t *testing.T) {
+	from := &recyclingProvider{
+		memoryProvider: newMemoryProvider(map[string]Secret{"Dev/Github": {Title: "Github"}}),
+		recycled:       []RecycledSecret{{Path: "Recycle Bin/Gitlab", UUID: "2"}},
+	}
+	to := &recyclingProvider{memoryProvider: newMemoryProvider(map[string]Secret{
+		"Dev/Github":  {Title: "Github"},
+		"Dev/Gitlab":  {UUID: "2", Title: "Gitlab"},
+		"Dev/Twitter": {UUID: "3", Title: "Twitter"},
+	})}
+	plan, err := Sync(from, to, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	actions := map[string]Action{}
+	for _, change := range plan.Changes {
+		actions[change.Path] = change.Action
+	}
+	if actions["Dev/Gitlab"] != ActionRecycle || actions["Dev/Twitter"] != ActionDelete {
+		t.Fatalf("Invalid prune: %v", actions)
+	}
+	if len(to.secrets) != 1 || len(to.recycled) != 1 || to.recycled[0].Path != "Dev/Gitlab" {
+		t.Fatalf("Invalid destination: %v %v", to.secrets, to.recycled)
+	}
+}
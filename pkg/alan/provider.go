@@ -0,0 +1,122 @@
+// Copyright (C) 2018 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package alan
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/golang/glog"
+)
+
+// Provider define a password manager storage.
+// Secrets are identified by their path: the path of their group and their escaped title.
+type Provider interface {
+	// Open connects to the storage
+	Open() error
+	// Load returns the tree of groups and secrets
+	Load() (*Group, error)
+	// Read returns the secret with the given path, or nil if it doesn't exist
+	Read(path string) (*Secret, error)
+	// Write creates or updates the secret with the given path
+	Write(path string, secret Secret) error
+	// Delete removes the secret with the given path
+	Delete(path string) error
+	// CreateGroup creates an empty group
+	CreateGroup(path string) error
+	// Close saves the changes and releases the storage
+	Close() error
+}
+
+// VersionedProvider is a provider which keeps the versions of its secrets
+type VersionedProvider interface {
+	Provider
+	// Version returns the current version of a secret, 0 if it doesn't exist or isn't versioned
+	Version(path string) (int, error)
+}
+
+// DiscardingProvider is a provider which keeps its changes until it is closed
+type DiscardingProvider interface {
+	Provider
+	// Discard drops the changes not saved yet: Close then only releases the storage
+	Discard()
+}
+
+// Release closes a provider without saving its changes, after a dry run or
+// a failure. It does nothing more once the provider is saved and closed.
+func Release(provider Provider) {
+	if discarding, ok := provider.(DiscardingProvider); ok {
+		discarding.Discard()
+	}
+	if err := provider.Close(); err != nil {
+		glog.Warningf("Can't close provider: %s", err)
+	}
+}
+
+// RecycledSecret define a secret deleted into a recycle bin
+type RecycledSecret struct {
+	Path string
+	UUID string
+}
+
+// RecyclingProvider is a provider with a recycle bin, which keeps the deleted secrets
+type RecyclingProvider interface {
+	Provider
+	// Recycled returns the secrets of the recycle bin found by Load
+	Recycled() []RecycledSecret
+	// Recycle moves a secret into the recycle bin
+	Recycle(path string) error
+}
+
+// ProviderFactory creates a provider from its location
+type ProviderFactory func(location string) (Provider, error)
+
+var providers = map[string]ProviderFactory{}
+
+// RegisterProvider makes a provider available with the given name
+func RegisterProvider(name string, factory ProviderFactory) {
+	providers[name] = factory
+}
+
+// Providers returns the names of the registered providers
+func Providers() []string {
+	names := []string{}
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewProvider creates a provider from an URI: <name>:<location>
+func NewProvider(uri string) (Provider, error) {
+	parts := strings.SplitN(uri, ":", 2)
+	factory, ok := providers[parts[0]]
+	if !ok {
+		return nil, fmt.Errorf("Unknown provider %s. Available providers: %s",
+			parts[0], strings.Join(Providers(), ", "))
+	}
+	location := ""
+	if len(parts) == 2 {
+		location = parts[1]
+	}
+	return factory(location)
+}
+
+// SecretPath returns the path of a secret into a group
+func SecretPath(groupPath string, secret Secret) string {
+	return JoinPath(groupPath, EscapeName(secret.Title))
+}
@@ -0,0 +1,135 @@
+// Copyright (C) 2018 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package alan
+
+import (
+	"fmt"
+	"testing"
+)
+
+// memoryProvider stores the secrets by path
+type memoryProvider struct {
+	secrets map[string]Secret
+	groups  map[string]bool
+}
+
+func newMemoryProvider(secrets map[string]Secret) *memoryProvider {
+	return &memoryProvider{secrets: secrets, groups: map[string]bool{}}
+}
+
+func (provider *memoryProvider) Open() error  { return nil }
+func (provider *memoryProvider) Close() error { return nil }
+
+func (provider *memoryProvider) Load() (*Group, error) {
+	tree := &Group{Name: "Root"}
+	groups := map[string]*Group{"": tree}
+	var mkGroup func(path string) *Group
+	mkGroup = func(path string) *Group {
+		if group, ok := groups[path]; ok {
+			return group
+		}
+		names := SplitPath(path)
+		parent := mkGroup(JoinPath(names[:len(names)-1]...))
+		group := NewGroup(parent.Path, names[len(names)-1])
+		parent.Groups = append(parent.Groups, group)
+		groups[path] = group
+		return group
+	}
+	for path := range provider.groups {
+		mkGroup(path)
+	}
+	for path, secret := range provider.secrets {
+		names := SplitPath(path)
+		group := mkGroup(JoinPath(names[:len(names)-1]...))
+		group.Secrets = append(group.Secrets, secret)
+	}
+	return tree, nil
+}
+
+func (provider *memoryProvider) Read(path string) (*Secret, error) {
+	if secret, ok := provider.secrets[path]; ok {
+		return &secret, nil
+	}
+	return nil, nil
+}
+
+func (provider *memoryProvider) Write(path string, secret Secret) error {
+	provider.secrets[path] = secret
+	return nil
+}
+
+func (provider *memoryProvider) Delete(path string) error {
+	if _, ok := provider.secrets[path]; !ok {
+		return fmt.Errorf("No secret for path %s", path)
+	}
+	delete(provider.secrets, path)
+	return nil
+}
+
+func (provider *memoryProvider) CreateGroup(path string) error {
+	provider.groups[path] = true
+	return nil
+}
+
+func Test_NewProvider(t *testing.T) {
+	RegisterProvider("memory", func(location string) (Provider, error) {
+		if location != "./secrets" {
+			return nil, fmt.Errorf("Invalid location: %s", location)
+		}
+		return newMemoryProvider(map[string]Secret{}), nil
+	})
+	defer delete(providers, "memory")
+
+	if _, err := NewProvider("memory:./secrets"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewProvider("unknown:./secrets"); err == nil {
+		t.Fatal("Expected an error for an unknown provider")
+	}
+}
+
+func Test_MappedProvider(t *testing.T) {
+	memory := newMemoryProvider(map[string]Secret{
+		"infra/db01":    {Title: "db01"},
+		"Perso/Twitter": {Title: "Twitter"},
+	})
+	provider := NewMappedProvider(memory, []MappingRule{
+		{Path: "Work/Infra", Target: "infra"},
+		{Path: "Work", Target: "team"},
+	})
+	tree, err := provider.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, secrets := tree.Index()
+	if len(secrets) != 2 || secrets["Work/Infra/db01"] == nil || secrets["Perso/Twitter"] == nil {
+		t.Fatalf("Invalid mapped secrets: %v", secrets)
+	}
+	if err := provider.Write("Work/Infra/db02", Secret{Title: "db02"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := provider.Write("Work/Gitlab", Secret{Title: "Gitlab"}); err != nil {
+		t.Fatal(err)
+	}
+	if secret, err := provider.Read("Work/Infra/db02"); err != nil || secret == nil {
+		t.Fatalf("Invalid mapped secret: %v %v", secret, err)
+	}
+	if _, ok := memory.secrets["infra/db02"]; !ok {
+		t.Fatalf("Invalid mapped write: %v", memory.secrets)
+	}
+	if _, ok := memory.secrets["team/Gitlab"]; !ok {
+		t.Fatalf("Invalid mapped write: %v", memory.secrets)
+	}
+}
@@ -0,0 +1,246 @@
+// Copyright (C) 2018 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package alan
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ryanuber/go-glob"
+)
+
+const (
+	// SearchFuzzy matches the characters of the query in order, ranking the closest matches first
+	SearchFuzzy = "fuzzy"
+
+	// SearchGlob matches the fields using a glob pattern
+	SearchGlob = "glob"
+
+	// SearchRegex matches the fields using a regular expression
+	SearchRegex = "regex"
+)
+
+// SearchModes are the available search modes
+var SearchModes = []string{SearchFuzzy, SearchGlob, SearchRegex}
+
+// SearchFields are the fields searched by default. Passwords are never searched.
+var SearchFields = []string{"title", "username", "url", "tags", "notes"}
+
+// fieldWeights ranks a match in the title before a match in the notes
+var fieldWeights = map[string]int{
+	"title":    5,
+	"username": 4,
+	"url":      3,
+	"tags":     3,
+	"notes":    1,
+}
+
+// matcher returns the score of a value, 0 if it doesn't match
+type matcher func(value string) int
+
+// Query searches the secrets of a tree
+type Query struct {
+	match   matcher
+	fields  []string
+	filters map[string]matcher
+}
+
+// SearchResult is a secret matching a query
+type SearchResult struct {
+	Path     string `json:"path"`
+	Title    string `json:"title"`
+	Username string `json:"username"`
+	URL      string `json:"url"`
+	Score    int    `json:"score"`
+}
+
+// NewQuery creates a query. A filter "name=value" only keeps the secrets
+// whose field matches the value, a filter "name" restricts the fields
+// searched by the query.
+func NewQuery(text string, mode string, filters []string) (*Query, error) {
+	query := &Query{filters: map[string]matcher{}}
+	for _, filter := range filters {
+		parts := strings.SplitN(filter, "=", 2)
+		name := strings.ToLower(strings.TrimSpace(parts[0]))
+		if len(name) == 0 || name == strings.ToLower(Password) {
+			return nil, fmt.Errorf("Invalid field filter: %s", filter)
+		}
+		if len(parts) == 1 {
+			query.fields = append(query.fields, name)
+			continue
+		}
+		match, err := newMatcher(parts[1], mode)
+		if err != nil {
+			return nil, err
+		}
+		query.filters[name] = match
+	}
+	if len(text) == 0 && len(query.filters) == 0 {
+		return nil, fmt.Errorf("Missing query")
+	}
+	if len(query.fields) == 0 {
+		query.fields = SearchFields
+	}
+	if len(text) > 0 {
+		match, err := newMatcher(text, mode)
+		if err != nil {
+			return nil, err
+		}
+		query.match = match
+	}
+	return query, nil
+}
+
+// Search returns the secrets of the tree matching the query, best matches first
+func (query *Query) Search(tree *Group) []SearchResult {
+	results := []SearchResult{}
+	tree.Walk(func(group *Group) error {
+		for _, secret := range group.Secrets {
+			if score, ok := query.score(secret); ok {
+				results = append(results, SearchResult{
+					Path:     SecretPath(group.Path, secret),
+					Title:    secret.Title,
+					Username: secret.Username,
+					URL:      secret.URL,
+					Score:    score,
+				})
+			}
+		}
+		return nil
+	})
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].Path < results[j].Path
+	})
+	return results
+}
+
+func (query *Query) score(secret Secret) (int, bool) {
+	for name, match := range query.filters {
+		if match(searchValue(secret, name)) == 0 {
+			return 0, false
+		}
+	}
+	if query.match == nil {
+		return 0, true
+	}
+	best := 0
+	for _, name := range query.fields {
+		weight, ok := fieldWeights[name]
+		if !ok {
+			weight = 1
+		}
+		if score := query.match(searchValue(secret, name)) * weight; score > best {
+			best = score
+		}
+	}
+	return best, best > 0
+}
+
+// searchValue returns the value of a field, protected fields are never searched
+func searchValue(secret Secret, name string) string {
+	switch name {
+	case "title":
+		return secret.Title
+	case "username":
+		return secret.Username
+	case "url":
+		return secret.URL
+	case "tags":
+		return strings.Join(secret.Tags, " ")
+	case "notes":
+		return secret.Notes
+	}
+	for _, field := range secret.Fields {
+		if strings.ToLower(field.Name) == name && !field.Protected {
+			return field.Value
+		}
+	}
+	return ""
+}
+
+func newMatcher(text string, mode string) (matcher, error) {
+	switch mode {
+	case SearchFuzzy, "":
+		return fuzzyMatcher(strings.ToLower(text)), nil
+	case SearchGlob:
+		pattern := strings.ToLower(text)
+		return func(value string) int {
+			if len(value) > 0 && glob.Glob(pattern, strings.ToLower(value)) {
+				return 1
+			}
+			return 0
+		}, nil
+	case SearchRegex:
+		re, err := regexp.Compile("(?i)" + text)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid regular expression %s: %s", text, err)
+		}
+		return func(value string) int {
+			if len(value) > 0 && re.MatchString(value) {
+				return 1
+			}
+			return 0
+		}, nil
+	}
+	return nil, fmt.Errorf("Invalid search mode %s. Available modes: %s", mode, strings.Join(SearchModes, ", "))
+}
+
+// fuzzyMatcher scores a substring match above a match of the characters in
+// order, and a match at the start of the value or of a word above the others.
+func fuzzyMatcher(text string) matcher {
+	return func(value string) int {
+		value = strings.ToLower(value)
+		if len(value) == 0 {
+			return 0
+		}
+		if value == text {
+			return 100
+		}
+		if index := strings.Index(value, text); index >= 0 {
+			if index == 0 {
+				return 80
+			}
+			if isWordStart(value, index) {
+				return 70
+			}
+			return 60
+		}
+		// characters in order, each gap between them lowers the score
+		gaps, last := 0, -1
+		for _, r := range text {
+			index := strings.IndexRune(value[last+1:], r)
+			if index < 0 {
+				return 0
+			}
+			if last >= 0 && index > 0 {
+				gaps++
+			}
+			last += index + len(string(r))
+		}
+		if score := 40 - 5*gaps; score > 1 {
+			return score
+		}
+		return 1
+	}
+}
+
+func isWordStart(value string, index int) bool {
+	return strings.ContainsAny(value[index-1:index], " -_./:@")
+}
@@ -0,0 +1,76 @@
+// Copyright (C) 2018 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package alan
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_Search(t *testing.T) {
+	provider := newMemoryProvider(map[string]Secret{
+		"Dev/Github":     {Title: "Github", Username: "alan", Password: "gitlab", URL: "https://github.com", Tags: []string{"code"}},
+		"Dev/Gitlab":     {Title: "Gitlab", Username: "turing", Password: "secret", URL: "https://gitlab.com"},
+		"Social/Twitter": {Title: "Twitter", Username: "alan", Notes: "see github profile"},
+		"Mail/Gmail":     {Title: "Gmail", Username: "alan", Fields: []Field{{Name: "PIN", Value: "1234", Protected: true}}},
+	})
+	tree, _ := provider.Load()
+	paths := func(results []SearchResult) []string {
+		result := []string{}
+		for _, r := range results {
+			result = append(result, r.Path)
+		}
+		return result
+	}
+	for _, test := range []struct {
+		query   string
+		mode    string
+		filters []string
+		paths   []string
+	}{
+		{"github", SearchFuzzy, nil, []string{"Dev/Github", "Social/Twitter"}},
+		{"gtlb", SearchFuzzy, nil, []string{"Dev/Gitlab"}},
+		{"gitlab", SearchFuzzy, nil, []string{"Dev/Gitlab"}},
+		{"code", SearchFuzzy, nil, []string{"Dev/Github"}},
+		{"1234", SearchFuzzy, nil, []string{}},
+		{"git*", SearchGlob, nil, []string{"Dev/Github", "Dev/Gitlab"}},
+		{"^g.*(hub|lab)$", SearchRegex, nil, []string{"Dev/Github", "Dev/Gitlab"}},
+		{"", SearchFuzzy, []string{"username=alan"}, []string{"Dev/Github", "Mail/Gmail", "Social/Twitter"}},
+		{"github", SearchFuzzy, []string{"title"}, []string{"Dev/Github"}},
+		{"git", SearchFuzzy, []string{"username=turing"}, []string{"Dev/Gitlab"}},
+	} {
+		query, err := NewQuery(test.query, test.mode, test.filters)
+		if err != nil {
+			t.Fatalf("Can't create query %s: %s", test.query, err)
+		}
+		if got := paths(query.Search(tree)); !reflect.DeepEqual(got, test.paths) {
+			t.Fatalf("Invalid results for %s %v: %v", test.query, test.filters, got)
+		}
+	}
+	for _, test := range []struct {
+		query   string
+		mode    string
+		filters []string
+	}{
+		{"", SearchFuzzy, nil},
+		{"a", "exact", nil},
+		{"(", SearchRegex, nil},
+		{"a", SearchFuzzy, []string{"password=secret"}},
+	} {
+		if _, err := NewQuery(test.query, test.mode, test.filters); err == nil {
+			t.Fatalf("Expected an error for %s %s %v", test.query, test.mode, test.filters)
+		}
+	}
+}
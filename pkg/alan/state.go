@@ -0,0 +1,256 @@
+// Copyright (C) 2018 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package alan
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// State records the secrets of the last synchronization between two providers.
+// The secrets are keyed by UUID, so that a renamed or moved secret is still
+// matched, or by path for the providers without UUIDs.
+type State struct {
+	Source      string                 `json:"source"`
+	Destination string                 `json:"destination"`
+	Updated     time.Time              `json:"updated"`
+	Secrets     map[string]SecretState `json:"secrets"`
+	Groups      []string               `json:"groups,omitempty"`
+}
+
+// SecretState define a secret when it was last synchronized
+type SecretState struct {
+	UUID string `json:"uuid,omitempty"`
+	Path string `json:"path"`
+	Hash string `json:"hash"`
+	// Version is the version of the secret into a versioned destination
+	Version int `json:"version,omitempty"`
+}
+
+// Status define how a secret differs from the last synchronization
+type Status string
+
+const (
+	// StatusNew is a secret never synchronized
+	StatusNew Status = "new"
+	// StatusModified is a secret modified into the source
+	StatusModified Status = "modified"
+	// StatusMoved is a secret renamed or moved into the source, without other changes
+	StatusMoved Status = "moved"
+	// StatusDeleted is a secret deleted from the source
+	StatusDeleted Status = "deleted"
+	// StatusModifiedDestination is a secret modified into the destination
+	StatusModifiedDestination Status = "modified in destination"
+)
+
+// SecretStatus define a secret out of date
+type SecretStatus struct {
+	Path   string `json:"path"`
+	Status Status `json:"status"`
+}
+
+// NewState creates an empty state for the providers
+func NewState(source string, destination string) *State {
+	return &State{
+		Source:      source,
+		Destination: destination,
+		Secrets:     map[string]SecretState{},
+	}
+}
+
+// StateFilename returns the name of the state file of two providers into the directory
+func StateFilename(dir string, source string, destination string) string {
+	hash := sha256.Sum256([]byte(source + "\n" + destination))
+	return filepath.Join(dir, hex.EncodeToString(hash[:8])+".json")
+}
+
+// LoadState reads a state file. A missing file returns an empty state.
+func LoadState(filename string, source string, destination string) (*State, error) {
+	data, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		glog.V(1).Infof("No sync state: %s", filename)
+		return NewState(source, destination), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	state := NewState(source, destination)
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, err
+	}
+	// the previous states are keyed by path
+	secrets := state.Secrets
+	state.Secrets = map[string]SecretState{}
+	for key, synced := range secrets {
+		if len(synced.Path) == 0 {
+			synced.Path = key
+		}
+		state.Secrets[stateKey(synced.Path, synced.UUID)] = synced
+	}
+	return state, nil
+}
+
+// Save writes the state file
+func (state *State) Save(filename string) error {
+	if err := os.MkdirAll(filepath.Dir(filename), 0700); err != nil {
+		return err
+	}
+	state.Updated = time.Now()
+	return WriteFile(filename, 0, func(w io.Writer) error {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(state)
+	})
+}
+
+// Record stores the content of a synchronized secret
+func (state *State) Record(path string, secret *Secret) {
+	state.Secrets[stateKey(path, secret.UUID)] = newSecretState(state, path, secret)
+}
+
+// lookup returns the state of a secret, matched by UUID, then by path
+func (state *State) lookup(path string, secret *Secret) (SecretState, bool) {
+	if synced, ok := state.Secrets[stateKey(path, secret.UUID)]; ok {
+		return synced, true
+	}
+	synced, ok := state.Secrets[path]
+	return synced, ok && len(synced.UUID) == 0
+}
+
+// find returns the state of the secret synchronized at a path
+func (state *State) find(path string) (SecretState, bool) {
+	if synced, ok := state.Secrets[path]; ok && synced.Path == path {
+		return synced, true
+	}
+	for _, synced := range state.Secrets {
+		if synced.Path == path {
+			return synced, true
+		}
+	}
+	return SecretState{}, false
+}
+
+// stateKey returns the key of a secret into the state: its UUID, or its path
+func stateKey(path string, uuid string) string {
+	if len(uuid) > 0 {
+		return uuid
+	}
+	return path
+}
+
+// newSecretState returns the state of a secret, keeping its version if it is
+// unchanged at the same path
+func newSecretState(previous *State, path string, secret *Secret) SecretState {
+	current := SecretState{UUID: secret.UUID, Path: path, Hash: Hash(secret)}
+	if synced, ok := previous.lookup(path, secret); ok && synced.Hash == current.Hash && synced.Path == path {
+		current.Version = synced.Version
+	}
+	return current
+}
+
+func (state *State) hasGroup(path string) bool {
+	for _, group := range state.Groups {
+		if group == path {
+			return true
+		}
+	}
+	return false
+}
+
+// OutOfDate returns the secrets changed since the last synchronization, sorted by path.
+// Using a versioned destination, the secrets modified into the destination are returned too.
+func (state *State) OutOfDate(source *Group, to Provider) ([]SecretStatus, error) {
+	statuses := []SecretStatus{}
+	sources := map[string]bool{}
+	err := source.Walk(func(group *Group) error {
+		for i := range group.Secrets {
+			secret := &group.Secrets[i]
+			if len(secret.Title) == 0 {
+				continue
+			}
+			path := SecretPath(group.Path, *secret)
+			synced, ok := state.lookup(path, secret)
+			if ok {
+				sources[stateKey(synced.Path, synced.UUID)] = true
+			}
+			switch {
+			case !ok:
+				statuses = append(statuses, SecretStatus{Path: path, Status: StatusNew})
+			case synced.Hash != Hash(secret):
+				statuses = append(statuses, SecretStatus{Path: path, Status: StatusModified})
+			case synced.Path != path:
+				statuses = append(statuses, SecretStatus{Path: path, Status: StatusMoved})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	versioned, _ := to.(VersionedProvider)
+	for key, synced := range state.Secrets {
+		if !sources[key] {
+			statuses = append(statuses, SecretStatus{Path: synced.Path, Status: StatusDeleted})
+			continue
+		}
+		if versioned == nil || synced.Version == 0 {
+			continue
+		}
+		version, err := versioned.Version(synced.Path)
+		if err != nil {
+			return nil, err
+		}
+		if version != synced.Version {
+			statuses = append(statuses, SecretStatus{Path: synced.Path, Status: StatusModifiedDestination})
+		}
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Path < statuses[j].Path
+	})
+	return statuses, nil
+}
+
+// Hash returns a hash of the content of a secret, ignoring its UUID and its modification time
+func Hash(secret *Secret) string {
+	hash := sha256.New()
+	write := func(values ...string) {
+		for _, value := range values {
+			// Length prefixed, to avoid collisions between concatenated values
+			fmt.Fprintf(hash, "%d:%s", len(value), value)
+		}
+	}
+	write(secret.Title, secret.Username, secret.Password, secret.URL, secret.Notes)
+	if len(secret.Tags) > 0 {
+		write(append([]string{"tags"}, secret.Tags...)...)
+	}
+	for _, field := range secret.Fields {
+		write("field", field.Name, field.Value, strconv.FormatBool(field.Protected))
+	}
+	for _, attachment := range secret.Attachments {
+		write("attachment", attachment.Name, string(attachment.Content))
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
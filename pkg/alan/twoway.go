@@ -0,0 +1,307 @@
+// Copyright (C) 2018 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package alan
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// Conflict strategies, used when a secret is modified on both sides
+const (
+	// ConflictNewest keeps the most recently modified version
+	ConflictNewest = "newest"
+	// ConflictSource keeps the source version
+	ConflictSource = "source"
+	// ConflictDestination keeps the destination version
+	ConflictDestination = "destination"
+	// ConflictPrompt asks the user
+	ConflictPrompt = "prompt"
+	// ConflictBoth keeps both versions, the destination one as a duplicate secret
+	ConflictBoth = "both"
+)
+
+// ConflictStrategies are the available conflict strategies
+var ConflictStrategies = []string{ConflictNewest, ConflictSource, ConflictDestination, ConflictPrompt, ConflictBoth}
+
+// Resolution define the version kept for a conflict
+type Resolution int
+
+const (
+	// ResolveSource keeps the source version
+	ResolveSource Resolution = iota
+	// ResolveDestination keeps the destination version
+	ResolveDestination
+	// ResolveBoth keeps both versions
+	ResolveBoth
+)
+
+// ConflictResolver chooses the version to keep when a secret is modified on both sides
+type ConflictResolver func(path string, source *Secret, destination *Secret) (Resolution, error)
+
+// NewConflictResolver returns the resolver of a strategy. The prompt
+// resolver is used to ask the user.
+func NewConflictResolver(strategy string, prompt ConflictResolver) (ConflictResolver, error) {
+	switch strategy {
+	case ConflictNewest:
+		return resolveNewest, nil
+	case ConflictSource:
+		return resolveWith(ResolveSource), nil
+	case ConflictDestination:
+		return resolveWith(ResolveDestination), nil
+	case ConflictBoth:
+		return resolveWith(ResolveBoth), nil
+	case ConflictPrompt:
+		if prompt == nil {
+			return nil, fmt.Errorf("No prompt available to resolve conflicts")
+		}
+		return prompt, nil
+	}
+	return nil, fmt.Errorf("Invalid conflict strategy %s. Available strategies: %s",
+		strategy, strings.Join(ConflictStrategies, ", "))
+}
+
+// resolveNewest keeps the most recently modified version, the source one if unknown
+func resolveNewest(path string, source *Secret, destination *Secret) (Resolution, error) {
+	if destination.Modified.After(source.Modified) {
+		return ResolveDestination, nil
+	}
+	return ResolveSource, nil
+}
+
+func resolveWith(resolution Resolution) ConflictResolver {
+	return func(path string, source *Secret, destination *Secret) (Resolution, error) {
+		return resolution, nil
+	}
+}
+
+// BidirectionalPlan define the changes needed to synchronize two providers with each other
+type BidirectionalPlan struct {
+	// Source are the changes to apply to the source
+	Source *Plan `json:"source"`
+	// Destination are the changes to apply to the destination
+	Destination *Plan `json:"destination"`
+	// State is the state of the providers once synchronized
+	State *State `json:"-"`
+}
+
+// Pending returns the number of changes to apply
+func (plan *BidirectionalPlan) Pending() int {
+	return plan.Source.Pending() + plan.Destination.Pending()
+}
+
+type locatedSecret struct {
+	path   string
+	secret *Secret
+}
+
+// locateSecrets returns the secrets of the tree with their path. Several
+// secrets with the same path are refused.
+func locateSecrets(tree *Group) ([]locatedSecret, error) {
+	secrets := []locatedSecret{}
+	paths := map[string]bool{}
+	err := tree.Walk(func(group *Group) error {
+		for i := range group.Secrets {
+			if len(group.Secrets[i].Title) == 0 {
+				glog.Warningf("Skipping secret without title into %s", group.Path)
+				continue
+			}
+			path := SecretPath(group.Path, group.Secrets[i])
+			if paths[path] {
+				return duplicateError(path)
+			}
+			paths[path] = true
+			secrets = append(secrets, locatedSecret{path, &group.Secrets[i]})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return secrets, nil
+}
+
+// NewBidirectionalPlan compares the source and the destination trees.
+// Secrets are matched by UUID, then by path. A secret modified on one side
+// only, compared to the state of the last synchronization, is copied to the
+// other side. Otherwise, the conflict is resolved using the resolver.
+// Using prune, an unmodified secret deleted from one side is recycled on the other side.
+func NewBidirectionalPlan(source *Group, destination *Group, state *State, resolve ConflictResolver, prune bool) (*BidirectionalPlan, error) {
+	plan := &BidirectionalPlan{
+		Source:      &Plan{Changes: []Change{}},
+		Destination: &Plan{Changes: []Change{}},
+		State:       NewState(state.Source, state.Destination),
+	}
+	sources, err := locateSecrets(source)
+	if err != nil {
+		return nil, err
+	}
+	destinations, err := locateSecrets(destination)
+	if err != nil {
+		return nil, err
+	}
+	byUUID := map[string]int{}
+	byPath := map[string]int{}
+	for i, located := range destinations {
+		if len(located.secret.UUID) > 0 {
+			byUUID[located.secret.UUID] = i
+		}
+		byPath[located.path] = i
+	}
+
+	paired := map[int]bool{}
+	for _, located := range sources {
+		index, ok := -1, false
+		if i, found := byUUID[located.secret.UUID]; found && len(located.secret.UUID) > 0 && !paired[i] {
+			index, ok = i, true
+		}
+		if i, found := byPath[located.path]; !ok && found && !paired[i] {
+			index, ok = i, true
+		}
+		if !ok {
+			plan.addUnpaired(plan.Destination, plan.Source, located, state, prune)
+			continue
+		}
+		paired[index] = true
+		if err := plan.merge(located, destinations[index], state, resolve); err != nil {
+			return nil, err
+		}
+	}
+	for i, located := range destinations {
+		if !paired[i] {
+			plan.addUnpaired(plan.Source, plan.Destination, located, state, prune)
+		}
+	}
+
+	sourceGroups, _ := source.Index()
+	destinationGroups, _ := destination.Index()
+	plan.Destination.addGroups(sourceGroups, destinationGroups)
+	plan.Source.addGroups(destinationGroups, sourceGroups)
+	return plan, nil
+}
+
+// addUnpaired plans the creation of a secret missing from the other side, or
+// its deletion if it was deleted from the other side since the last synchronization
+func (plan *BidirectionalPlan) addUnpaired(other *Plan, side *Plan, located locatedSecret, state *State, prune bool) {
+	if synced, ok := state.lookup(located.path, located.secret); ok && prune && synced.Hash == Hash(located.secret) {
+		side.Changes = append(side.Changes, Change{Action: ActionRecycle, Path: located.path})
+		return
+	}
+	other.add(ActionCreate, located.path, "", &Secret{}, located.secret)
+	plan.State.Record(located.path, located.secret)
+}
+
+// merge plans the synchronization of a secret existing on both sides
+func (plan *BidirectionalPlan) merge(source locatedSecret, destination locatedSecret, state *State, resolve ConflictResolver) error {
+	if source.secret.Equal(destination.secret) {
+		switch {
+		case source.path == destination.path:
+			plan.Destination.add(ActionUnchanged, source.path, "", destination.secret, source.secret)
+			plan.State.Record(source.path, source.secret)
+		case state.syncedAt(source.path, source.secret):
+			// Moved into the destination
+			plan.Source.add(ActionUpdate, destination.path, source.path, source.secret, destination.secret)
+			plan.State.Record(destination.path, destination.secret)
+		default:
+			plan.Destination.add(ActionUpdate, source.path, destination.path, destination.secret, source.secret)
+			plan.State.Record(source.path, source.secret)
+		}
+		return nil
+	}
+
+	base, ok := state.lookup(source.path, source.secret)
+	if !ok {
+		base, ok = state.lookup(destination.path, destination.secret)
+	}
+	var resolution Resolution
+	switch {
+	case ok && Hash(source.secret) == base.Hash:
+		resolution = ResolveDestination
+	case ok && Hash(destination.secret) == base.Hash:
+		resolution = ResolveSource
+	default:
+		glog.V(1).Infof("Conflict for %s", source.path)
+		var err error
+		if resolution, err = resolve(source.path, source.secret, destination.secret); err != nil {
+			return err
+		}
+	}
+
+	switch resolution {
+	case ResolveSource:
+		plan.Destination.add(ActionUpdate, source.path, destination.path, destination.secret, source.secret)
+		plan.State.Record(source.path, source.secret)
+	case ResolveDestination:
+		plan.Source.add(ActionUpdate, destination.path, source.path, source.secret, destination.secret)
+		plan.State.Record(destination.path, destination.secret)
+	case ResolveBoth:
+		duplicate := *destination.secret
+		duplicate.UUID = ""
+		duplicate.Title = fmt.Sprintf("%s (conflict %s)", duplicate.Title, time.Now().Format("2006-01-02"))
+		duplicatePath := SecretPath(parentPath(destination.path), duplicate)
+		plan.Source.add(ActionCreate, duplicatePath, "", &Secret{}, &duplicate)
+		plan.Destination.add(ActionUpdate, source.path, destination.path, destination.secret, source.secret)
+		plan.Destination.add(ActionCreate, duplicatePath, "", &Secret{}, &duplicate)
+		plan.State.Record(source.path, source.secret)
+		plan.State.Record(duplicatePath, &duplicate)
+	}
+	return nil
+}
+
+// add appends a change, from the old content to the new one
+func (plan *Plan) add(action Action, path string, from string, old *Secret, new *Secret) {
+	if from == path {
+		from = ""
+	}
+	plan.Changes = append(plan.Changes, Change{
+		Action: action,
+		Path:   path,
+		From:   from,
+		Fields: Diff(old, new),
+		Secret: new,
+	})
+}
+
+// addGroups plans the creation of the empty groups missing from the destination
+func (plan *Plan) addGroups(groups map[string]*Group, existing map[string]*Group) {
+	paths := []string{}
+	for path, group := range groups {
+		if _, ok := existing[path]; !ok && group.IsEmpty() && len(path) > 0 {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		plan.Changes = append(plan.Changes, Change{Action: ActionCreateGroup, Path: path})
+	}
+}
+
+// syncedAt returns true if the secret was synchronized at the path
+func (state *State) syncedAt(path string, secret *Secret) bool {
+	synced, ok := state.lookup(path, secret)
+	return ok && synced.Path == path
+}
+
+// parentPath returns the path of the group of a secret path
+func parentPath(path string) string {
+	if i := strings.LastIndex(path, PathSeparator); i >= 0 {
+		return path[:i]
+	}
+	return ""
+}
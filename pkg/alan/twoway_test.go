@@ -0,0 +1,194 @@
+// Copyright (C) 2018 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package alan
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func twoWayTree(secrets map[string]Secret) *Group {
+	tree, _ := newMemoryProvider(secrets).Load()
+	return tree
+}
+
+func pendingPaths(plan *Plan) map[string]Action {
+	actions := map[string]Action{}
+	for _, change := range plan.Changes {
+		if change.Action != ActionUnchanged {
+			actions[change.Path] = change.Action
+		}
+	}
+	return actions
+}
+
+func Test_NewBidirectionalPlan(t *testing.T) {
+	base := map[string]Secret{
+		"Dev/Github": {Title: "Github", Password: "turing"},
+		"Dev/Gitlab": {Title: "Gitlab", Password: "enigma"},
+	}
+	state := NewState("a", "b")
+	for path, secret := range base {
+		secret := secret
+		state.Record(path, &secret)
+	}
+
+	source := twoWayTree(map[string]Secret{
+		"Dev/Github":     {Title: "Github", Password: "changed"},
+		"Dev/Gitlab":     {Title: "Gitlab", Password: "enigma"},
+		"Social/Twitter": {Title: "Twitter"},
+	})
+	destination := twoWayTree(map[string]Secret{
+		"Dev/Github":     {Title: "Github", Password: "turing"},
+		"Dev/Gitlab":     {Title: "Gitlab", Password: "bombe"},
+		"Perso/Mastodon": {Title: "Mastodon"},
+	})
+	plan, err := NewBidirectionalPlan(source, destination, state, resolveWith(ResolveSource), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	toDestination := pendingPaths(plan.Destination)
+	toSource := pendingPaths(plan.Source)
+	if len(toDestination) != 2 || toDestination["Dev/Github"] != ActionUpdate || toDestination["Social/Twitter"] != ActionCreate {
+		t.Fatalf("Invalid destination changes: %v", toDestination)
+	}
+	if len(toSource) != 2 || toSource["Dev/Gitlab"] != ActionUpdate || toSource["Perso/Mastodon"] != ActionCreate {
+		t.Fatalf("Invalid source changes: %v", toSource)
+	}
+	if len(plan.State.Secrets) != 4 {
+		t.Fatalf("Invalid state: %v", plan.State.Secrets)
+	}
+}
+
+func Test_BidirectionalConflicts(t *testing.T) {
+	now := time.Now()
+	state := NewState("a", "b")
+	state.Record("Dev/Github", &Secret{Title: "Github", Password: "turing"})
+	source := twoWayTree(map[string]Secret{
+		"Dev/Github": {Title: "Github", Password: "source", Modified: now.Add(-time.Hour)},
+	})
+	destination := twoWayTree(map[string]Secret{
+		"Dev/Github": {Title: "Github", Password: "destination", Modified: now},
+	})
+
+	resolve, _ := NewConflictResolver(ConflictNewest, nil)
+	plan, err := NewBidirectionalPlan(source, destination, state, resolve, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.Destination.Pending() != 0 || plan.Source.Pending() != 1 || plan.Source.Changes[0].Secret.Password != "destination" {
+		t.Fatalf("Invalid newest resolution: %v %v", plan.Source.Changes, plan.Destination.Changes)
+	}
+
+	resolve, _ = NewConflictResolver(ConflictBoth, nil)
+	plan, err = NewBidirectionalPlan(source, destination, state, resolve, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	toDestination := pendingPaths(plan.Destination)
+	if plan.Source.Pending() != 1 || len(toDestination) != 2 || toDestination["Dev/Github"] != ActionUpdate {
+		t.Fatalf("Invalid both resolution: %v %v", plan.Source.Changes, toDestination)
+	}
+	if duplicate := plan.Source.Changes[0]; !strings.HasPrefix(duplicate.Path, "Dev/Github (conflict ") || duplicate.Secret.Password != "destination" {
+		t.Fatalf("Invalid conflict copy: %v", duplicate)
+	}
+
+	if _, err := NewConflictResolver(ConflictPrompt, nil); err == nil {
+		t.Fatalf("Prompt strategy without prompt")
+	}
+	if _, err := NewConflictResolver("oldest", nil); err == nil {
+		t.Fatalf("Invalid strategy accepted")
+	}
+}
+
+func Test_BidirectionalMove(t *testing.T) {
+	state := NewState("a", "b")
+	state.Record("Dev/Github", &Secret{UUID: "1", Title: "Github", Password: "turing"})
+	source := twoWayTree(map[string]Secret{
+		"Dev/Github": {UUID: "1", Title: "Github", Password: "turing"},
+	})
+	destination := twoWayTree(map[string]Secret{
+		"Archive/Github": {UUID: "1", Title: "Github", Password: "turing"},
+	})
+	plan, err := NewBidirectionalPlan(source, destination, state, resolveWith(ResolveSource), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.Destination.Pending() != 0 || plan.Source.Pending() != 1 {
+		t.Fatalf("Invalid move: %v %v", plan.Source.Changes, plan.Destination.Changes)
+	}
+	if change := plan.Source.Changes[0]; change.Path != "Archive/Github" || change.From != "Dev/Github" {
+		t.Fatalf("Invalid move: %v", change)
+	}
+
+	to := newMemoryProvider(map[string]Secret{"Dev/Github": {UUID: "1", Title: "Github", Password: "turing"}})
+	if err := plan.Source.Apply(to); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := to.secrets["Dev/Github"]; ok || to.secrets["Archive/Github"].Password != "turing" {
+		t.Fatalf("Invalid moved secrets: %v", to.secrets)
+	}
+}
+
+func Test_BidirectionalDuplicates(t *testing.T) {
+	duplicates := twoWayTree(map[string]Secret{
+		"Dev/Github":     {Title: "Github", Password: "turing"},
+		"Dev/Github (2)": {Title: "Github", Password: "enigma"},
+	})
+	other := twoWayTree(map[string]Secret{
+		"Perso/Bitbucket": {Title: "Bitbucket"},
+	})
+	if _, err := NewBidirectionalPlan(duplicates, other, NewState("a", "b"), resolveWith(ResolveSource), false); err == nil || !strings.Contains(err.Error(), "Dev/Github") {
+		t.Fatalf("Expected a duplicate error for the source: %v", err)
+	}
+	if _, err := NewBidirectionalPlan(other, duplicates, NewState("a", "b"), resolveWith(ResolveSource), false); err == nil || !strings.Contains(err.Error(), "Dev/Github") {
+		t.Fatalf("Expected a duplicate error for the destination: %v", err)
+	}
+}
+
+func Test_Hash(t *testing.T) {
+	secret := &Secret{Title: "Github", Password: "turing"}
+	if Hash(secret) != Hash(&Secret{Title: "Github", Password: "turing", Fields: []Field{}, Modified: time.Now()}) {
+		t.Fatalf("Hash depends on empty fields or modification time")
+	}
+	if Hash(secret) == Hash(&Secret{Title: "Github", Password: "turin", Notes: "g"}) {
+		t.Fatalf("Hash collision between fields")
+	}
+}
+
+func Test_BidirectionalPrune(t *testing.T) {
+	state := NewState("a", "b")
+	state.Record("Dev/Github", &Secret{Title: "Github", Password: "turing"})
+	state.Record("Dev/Gitlab", &Secret{Title: "Gitlab", Password: "enigma"})
+	source := twoWayTree(map[string]Secret{
+		"Dev/Github": {Title: "Github", Password: "turing"},
+		"Dev/Gitlab": {Title: "Gitlab", Password: "bombe"},
+	})
+	destination := twoWayTree(map[string]Secret{})
+	plan, err := NewBidirectionalPlan(source, destination, state, resolveWith(ResolveSource), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	toSource := pendingPaths(plan.Source)
+	toDestination := pendingPaths(plan.Destination)
+	if len(toSource) != 1 || toSource["Dev/Github"] != ActionRecycle {
+		t.Fatalf("Invalid source changes: %v", toSource)
+	}
+	// Modified since the last synchronization: restored
+	if len(toDestination) != 1 || toDestination["Dev/Gitlab"] != ActionCreate {
+		t.Fatalf("Invalid destination changes: %v", toDestination)
+	}
+}
@@ -0,0 +1,168 @@
+// Copyright (C) 2018 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bitwarden
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const (
+	// KDFPBKDF2 is the PBKDF2-SHA256 key derivation
+	KDFPBKDF2 = 0
+	// KDFArgon2id is the Argon2id key derivation
+	KDFArgon2id = 1
+
+	// encTypeAesCbcHmac is the type of the encrypted strings: AES-256-CBC with a HMAC-SHA256
+	encTypeAesCbcHmac = "2"
+)
+
+// KDF define the key derivation of a password-protected export
+type KDF struct {
+	Type       int
+	Iterations int
+	// Memory is the Argon2id memory in MiB
+	Memory      int
+	Parallelism int
+}
+
+// KDFNames are the names of the key derivations
+var KDFNames = []string{"pbkdf2", "argon2id"}
+
+// NewKDF returns a key derivation by name, with the default parameters of Bitwarden
+func NewKDF(name string) (*KDF, error) {
+	switch name {
+	case "pbkdf2":
+		return &KDF{Type: KDFPBKDF2, Iterations: 600000}, nil
+	case "argon2id":
+		return &KDF{Type: KDFArgon2id, Iterations: 3, Memory: 64, Parallelism: 4}, nil
+	}
+	return nil, fmt.Errorf("Unknown key derivation %s. Available: %s", name, strings.Join(KDFNames, ", "))
+}
+
+// cipherKey define the keys of the encrypted strings
+type cipherKey struct {
+	encKey []byte
+	macKey []byte
+}
+
+// newCipherKey derives the keys from a password, as Bitwarden does for
+// the PIN and the password-protected exports: the master key is derived
+// from the password and the salt, then stretched using HKDF.
+func newCipherKey(password string, salt string, kdf *KDF) (*cipherKey, error) {
+	var key []byte
+	switch kdf.Type {
+	case KDFPBKDF2:
+		if kdf.Iterations <= 0 {
+			return nil, fmt.Errorf("Invalid PBKDF2 iterations: %d", kdf.Iterations)
+		}
+		key = pbkdf2.Key([]byte(password), []byte(salt), kdf.Iterations, 32, sha256.New)
+	case KDFArgon2id:
+		if kdf.Iterations <= 0 || kdf.Memory <= 0 || kdf.Parallelism <= 0 {
+			return nil, fmt.Errorf("Invalid Argon2id parameters: %d iterations, %d MiB, %d threads",
+				kdf.Iterations, kdf.Memory, kdf.Parallelism)
+		}
+		hash := sha256.Sum256([]byte(salt))
+		key = argon2.IDKey([]byte(password), hash[:], uint32(kdf.Iterations), uint32(kdf.Memory*1024), uint8(kdf.Parallelism), 32)
+	default:
+		return nil, fmt.Errorf("Unsupported key derivation: %d", kdf.Type)
+	}
+	return &cipherKey{
+		encKey: hkdfExpand(key, "enc"),
+		macKey: hkdfExpand(key, "mac"),
+	}, nil
+}
+
+// hkdfExpand returns the first block of the HKDF-SHA256 expansion of a key
+func hkdfExpand(key []byte, info string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(info))
+	mac.Write([]byte{1})
+	return mac.Sum(nil)
+}
+
+// encrypt returns the encrypted string of a text: 2.<iv>|<data>|<mac>
+func (key *cipherKey) encrypt(plaintext []byte) (string, error) {
+	block, err := aes.NewCipher(key.encKey)
+	if err != nil {
+		return "", err
+	}
+	iv := make([]byte, aes.BlockSize)
+	if _, err := rand.Read(iv); err != nil {
+		return "", err
+	}
+	padding := aes.BlockSize - len(plaintext)%aes.BlockSize
+	data := append(append([]byte{}, plaintext...), bytes.Repeat([]byte{byte(padding)}, padding)...)
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(data, data)
+	return fmt.Sprintf("%s.%s|%s|%s", encTypeAesCbcHmac,
+		base64.StdEncoding.EncodeToString(iv),
+		base64.StdEncoding.EncodeToString(data),
+		base64.StdEncoding.EncodeToString(key.mac(iv, data))), nil
+}
+
+// decrypt returns the text of an encrypted string. A wrong key is
+// detected by the MAC.
+func (key *cipherKey) decrypt(text string) ([]byte, error) {
+	parts := strings.SplitN(text, ".", 2)
+	if len(parts) != 2 || parts[0] != encTypeAesCbcHmac {
+		return nil, fmt.Errorf("Unsupported encrypted string")
+	}
+	values := strings.Split(parts[1], "|")
+	if len(values) != 3 {
+		return nil, fmt.Errorf("Invalid encrypted string")
+	}
+	decoded := make([][]byte, len(values))
+	for i, value := range values {
+		var err error
+		if decoded[i], err = base64.StdEncoding.DecodeString(value); err != nil {
+			return nil, fmt.Errorf("Invalid encrypted string: %s", err)
+		}
+	}
+	iv, data, mac := decoded[0], decoded[1], decoded[2]
+	if !hmac.Equal(mac, key.mac(iv, data)) {
+		return nil, fmt.Errorf("Invalid password")
+	}
+	if len(iv) != aes.BlockSize || len(data) == 0 || len(data)%aes.BlockSize != 0 {
+		return nil, fmt.Errorf("Invalid encrypted string")
+	}
+	block, err := aes.NewCipher(key.encKey)
+	if err != nil {
+		return nil, err
+	}
+	plaintext := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plaintext, data)
+	padding := int(plaintext[len(plaintext)-1])
+	if padding == 0 || padding > aes.BlockSize {
+		return nil, fmt.Errorf("Invalid padding")
+	}
+	return plaintext[:len(plaintext)-padding], nil
+}
+
+func (key *cipherKey) mac(iv []byte, data []byte) []byte {
+	mac := hmac.New(sha256.New, key.macKey)
+	mac.Write(iv)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
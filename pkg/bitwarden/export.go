@@ -0,0 +1,216 @@
+// Copyright (C) 2018 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bitwarden
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"time"
+)
+
+// Types of the items
+const (
+	ItemLogin      = 1
+	ItemSecureNote = 2
+	ItemCard       = 3
+	ItemIdentity   = 4
+)
+
+// Types of the custom fields
+const (
+	FieldText    = 0
+	FieldHidden  = 1
+	FieldBoolean = 2
+	FieldLinked  = 3
+)
+
+// Export define the content of a Bitwarden JSON export. The personal
+// exports have folders, the organization ones collections.
+type Export struct {
+	Encrypted   bool      `json:"encrypted"`
+	Folders     []*Folder `json:"folders,omitempty"`
+	Collections []*Folder `json:"collections,omitempty"`
+	Items       []*Item   `json:"items"`
+}
+
+// Folder define a folder or a collection. The levels of the nested ones are separated by /.
+type Folder struct {
+	ID             string `json:"id"`
+	OrganizationID string `json:"organizationId,omitempty"`
+	Name           string `json:"name"`
+}
+
+// Item define a login, a secure note, a card or an identity
+type Item struct {
+	ID              string             `json:"id"`
+	OrganizationID  string             `json:"organizationId,omitempty"`
+	FolderID        string             `json:"folderId,omitempty"`
+	Type            int                `json:"type"`
+	Name            string             `json:"name"`
+	Notes           string             `json:"notes,omitempty"`
+	Favorite        bool               `json:"favorite"`
+	Fields          []Field            `json:"fields,omitempty"`
+	Login           *Login             `json:"login,omitempty"`
+	SecureNote      *SecureNote        `json:"secureNote,omitempty"`
+	Card            map[string]*string `json:"card,omitempty"`
+	Identity        map[string]*string `json:"identity,omitempty"`
+	PasswordHistory []PasswordHistory  `json:"passwordHistory,omitempty"`
+	RevisionDate    *time.Time         `json:"revisionDate,omitempty"`
+	CollectionIDs   []string           `json:"collectionIds,omitempty"`
+}
+
+// Field define a custom field of an item
+type Field struct {
+	Name  string  `json:"name"`
+	Value *string `json:"value"`
+	Type  int     `json:"type"`
+}
+
+// Login define the credentials of a login item
+type Login struct {
+	URIs     []URI  `json:"uris,omitempty"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	TOTP     string `json:"totp,omitempty"`
+}
+
+// URI define a website of a login item
+type URI struct {
+	Match *int   `json:"match"`
+	URI   string `json:"uri"`
+}
+
+// SecureNote define the type of a secure note, always 0
+type SecureNote struct {
+	Type int `json:"type"`
+}
+
+// PasswordHistory define a previous password of an item
+type PasswordHistory struct {
+	LastUsedDate time.Time `json:"lastUsedDate"`
+	Password     string    `json:"password"`
+}
+
+// encryptedExport define a password-protected export, its data being the encrypted export
+type encryptedExport struct {
+	Encrypted         bool   `json:"encrypted"`
+	PasswordProtected bool   `json:"passwordProtected"`
+	Salt              string `json:"salt"`
+	KDFType           int    `json:"kdfType"`
+	KDFIterations     int    `json:"kdfIterations"`
+	KDFMemory         *int   `json:"kdfMemory"`
+	KDFParallelism    *int   `json:"kdfParallelism"`
+	EncKeyValidation  string `json:"encKeyValidation_DO_NOT_EDIT"`
+	Data              string `json:"data"`
+}
+
+// NewExport creates an empty export
+func NewExport() *Export {
+	return &Export{Folders: []*Folder{}, Items: []*Item{}}
+}
+
+// Decode reads an export. The password function is only called for the
+// password-protected exports, whose key derivation is returned.
+func Decode(r io.Reader, password func() (string, error)) (*Export, *KDF, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	envelope := &encryptedExport{}
+	if err := json.Unmarshal(data, envelope); err != nil {
+		return nil, nil, err
+	}
+	var kdf *KDF
+	if envelope.Encrypted {
+		if !envelope.PasswordProtected {
+			return nil, nil, fmt.Errorf("Account restricted exports can't be decrypted, use a password-protected one")
+		}
+		kdf = &KDF{Type: envelope.KDFType, Iterations: envelope.KDFIterations}
+		if envelope.KDFMemory != nil {
+			kdf.Memory = *envelope.KDFMemory
+		}
+		if envelope.KDFParallelism != nil {
+			kdf.Parallelism = *envelope.KDFParallelism
+		}
+		text, err := password()
+		if err != nil {
+			return nil, nil, err
+		}
+		key, err := newCipherKey(text, envelope.Salt, kdf)
+		if err != nil {
+			return nil, nil, err
+		}
+		if _, err := key.decrypt(envelope.EncKeyValidation); err != nil {
+			return nil, nil, err
+		}
+		if data, err = key.decrypt(envelope.Data); err != nil {
+			return nil, nil, err
+		}
+	}
+	export := NewExport()
+	if err := json.Unmarshal(data, export); err != nil {
+		return nil, nil, err
+	}
+	return export, kdf, nil
+}
+
+// Encode writes the export. Using a key derivation, the export is
+// encrypted with the password, with a new salt.
+func (export *Export) Encode(w io.Writer, password string, kdf *KDF) error {
+	export.Encrypted = false
+	data, err := json.MarshalIndent(export, "", "  ")
+	if err != nil {
+		return err
+	}
+	if kdf != nil {
+		if data, err = encrypt(data, password, kdf); err != nil {
+			return err
+		}
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+func encrypt(data []byte, password string, kdf *KDF) ([]byte, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	envelope := &encryptedExport{
+		Encrypted:         true,
+		PasswordProtected: true,
+		Salt:              base64.StdEncoding.EncodeToString(salt),
+		KDFType:           kdf.Type,
+		KDFIterations:     kdf.Iterations,
+	}
+	if kdf.Type == KDFArgon2id {
+		envelope.KDFMemory, envelope.KDFParallelism = &kdf.Memory, &kdf.Parallelism
+	}
+	key, err := newCipherKey(password, envelope.Salt, kdf)
+	if err != nil {
+		return nil, err
+	}
+	if envelope.EncKeyValidation, err = key.encrypt([]byte(newID())); err != nil {
+		return nil, err
+	}
+	if envelope.Data, err = key.encrypt(data); err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(envelope, "", "  ")
+}
@@ -0,0 +1,288 @@
+// Copyright (C) 2018 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bitwarden
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+
+	pkgalan "github.com/nlamirault/alan/pkg/alan"
+)
+
+const (
+	// ItemTypeField is the name of the field of the type of the cards and identities
+	ItemTypeField = "ItemType"
+
+	cardType     = "card"
+	identityType = "identity"
+
+	// historySize is the number of previous passwords kept by Bitwarden
+	historySize = 5
+)
+
+// itemField define a value of a card or an identity, kept as a custom field
+type itemField struct {
+	key       string
+	name      string
+	protected bool
+}
+
+var cardFields = []itemField{
+	{"cardholderName", "Cardholder Name", false},
+	{"brand", "Brand", false},
+	{"number", "Number", true},
+	{"expMonth", "Expiration Month", false},
+	{"expYear", "Expiration Year", false},
+	{"code", "Security Code", true},
+}
+
+var identityFields = []itemField{
+	{"title", "Title", false},
+	{"firstName", "First Name", false},
+	{"middleName", "Middle Name", false},
+	{"lastName", "Last Name", false},
+	{"address1", "Address 1", false},
+	{"address2", "Address 2", false},
+	{"address3", "Address 3", false},
+	{"city", "City", false},
+	{"state", "State", false},
+	{"postalCode", "Postal Code", false},
+	{"country", "Country", false},
+	{"company", "Company", false},
+	{"email", "Email", false},
+	{"phone", "Phone", false},
+	{"ssn", "SSN", true},
+	{"passportNumber", "Passport Number", true},
+	{"licenseNumber", "License Number", true},
+}
+
+func toSecret(item *Item) pkgalan.Secret {
+	secret := pkgalan.Secret{
+		UUID:  encodeUUID(item.ID),
+		Title: item.Name,
+		Notes: item.Notes,
+	}
+	if item.Favorite {
+		secret.Tags = []string{pkgalan.FavoriteTag}
+	}
+	if item.RevisionDate != nil {
+		secret.Modified = *item.RevisionDate
+	}
+	switch item.Type {
+	case ItemCard:
+		addItemFields(&secret, cardType, item.Card, cardFields)
+	case ItemIdentity:
+		addItemFields(&secret, identityType, item.Identity, identityFields)
+		if username := item.Identity["username"]; username != nil {
+			secret.Username = *username
+		}
+	}
+	if login := item.Login; login != nil {
+		secret.Username, secret.Password = login.Username, login.Password
+		for i, uri := range login.URIs {
+			if i == 0 {
+				secret.URL = uri.URI
+			} else {
+				addField(&secret, fmt.Sprintf("%s %d", pkgalan.URLField, i+1), uri.URI, false)
+			}
+		}
+		if len(login.TOTP) > 0 {
+			addField(&secret, pkgalan.OTPField, login.TOTP, true)
+		}
+	}
+	for _, field := range item.Fields {
+		if field.Type == FieldLinked {
+			continue
+		}
+		value := ""
+		if field.Value != nil {
+			value = *field.Value
+		}
+		secret.Fields = append(secret.Fields, pkgalan.Field{Name: field.Name, Value: value, Protected: field.Type == FieldHidden})
+	}
+	for i := len(item.PasswordHistory) - 1; i >= 0; i-- {
+		secret.PasswordHistory = append(secret.PasswordHistory, pkgalan.PasswordChange{
+			Password: item.PasswordHistory[i].Password,
+			Changed:  item.PasswordHistory[i].LastUsedDate,
+		})
+	}
+	sort.SliceStable(secret.PasswordHistory, func(i, j int) bool {
+		return secret.PasswordHistory[i].Changed.Before(secret.PasswordHistory[j].Changed)
+	})
+	return secret
+}
+
+// addItemFields adds the type and the values of a card or an identity as custom fields
+func addItemFields(secret *pkgalan.Secret, itemType string, values map[string]*string, fields []itemField) {
+	addField(secret, ItemTypeField, itemType, false)
+	for _, field := range fields {
+		if value := values[field.key]; value != nil {
+			addField(secret, field.name, *value, field.protected)
+		}
+	}
+}
+
+func addField(secret *pkgalan.Secret, name string, value string, protected bool) {
+	if len(value) > 0 {
+		secret.Fields = append(secret.Fields, pkgalan.Field{Name: name, Value: value, Protected: protected})
+	}
+}
+
+// updateItem sets an item from a secret. The secrets with an item type
+// become cards or identities, the ones without credentials secure notes.
+// The previous password is added to the history.
+func updateItem(item *Item, secret pkgalan.Secret) {
+	previous := ""
+	if item.Login != nil {
+		previous = item.Login.Password
+	}
+	item.Name, item.Notes = secret.Title, secret.Notes
+	item.Favorite = false
+	for _, tag := range secret.Tags {
+		item.Favorite = item.Favorite || tag == pkgalan.FavoriteTag
+	}
+	item.Fields, item.Login, item.SecureNote, item.Card, item.Identity = nil, nil, nil, nil, nil
+	if len(secret.Attachments) > 0 {
+		glog.Warningf("Bitwarden exports can't contain attachments: %s", secret.Title)
+	}
+
+	used := map[string]bool{ItemTypeField: true}
+	itemType := secret.Field(ItemTypeField)
+	otp := secret.Field(pkgalan.OTPField)
+	switch {
+	case itemType != nil && itemType.Value == cardType:
+		item.Type, item.Card = ItemCard, itemValues(secret, cardFields, used)
+	case itemType != nil && itemType.Value == identityType:
+		item.Type, item.Identity = ItemIdentity, itemValues(secret, identityFields, used)
+		item.Identity["username"] = stringValue(secret.Username)
+	case len(secret.URL) == 0 && len(secret.Username) == 0 && len(secret.Password) == 0 && otp == nil:
+		item.Type, item.SecureNote = ItemSecureNote, &SecureNote{}
+	default:
+		item.Type = ItemLogin
+		item.Login = &Login{Username: secret.Username, Password: secret.Password}
+		if len(secret.URL) > 0 {
+			item.Login.URIs = append(item.Login.URIs, URI{URI: secret.URL})
+		}
+		for _, field := range secret.Fields {
+			if isURLField(field.Name) {
+				item.Login.URIs = append(item.Login.URIs, URI{URI: field.Value})
+				used[field.Name] = true
+			}
+		}
+		if otp != nil {
+			item.Login.TOTP = otp.Value
+			used[pkgalan.OTPField] = true
+		}
+	}
+	for _, field := range secret.Fields {
+		if used[field.Name] {
+			continue
+		}
+		fieldType := FieldText
+		if field.Protected {
+			fieldType = FieldHidden
+		}
+		item.Fields = append(item.Fields, Field{Name: field.Name, Value: stringValue(field.Value), Type: fieldType})
+	}
+
+	if len(secret.PasswordHistory) > 0 {
+		item.PasswordHistory = nil
+		for _, change := range secret.PasswordHistory {
+			item.PasswordHistory = append([]PasswordHistory{{LastUsedDate: change.Changed, Password: change.Password}}, item.PasswordHistory...)
+		}
+	}
+	if len(previous) > 0 && previous != secret.Password &&
+		(len(item.PasswordHistory) == 0 || item.PasswordHistory[0].Password != previous) {
+		item.PasswordHistory = append([]PasswordHistory{{LastUsedDate: time.Now().UTC(), Password: previous}}, item.PasswordHistory...)
+	}
+	if len(item.PasswordHistory) > historySize {
+		item.PasswordHistory = item.PasswordHistory[:historySize]
+	}
+	modified := secret.Modified
+	if modified.IsZero() {
+		modified = time.Now().UTC()
+	}
+	item.RevisionDate = &modified
+}
+
+// itemValues returns the values of a card or an identity, from the custom fields
+func itemValues(secret pkgalan.Secret, fields []itemField, used map[string]bool) map[string]*string {
+	values := map[string]*string{}
+	for _, field := range fields {
+		values[field.key] = nil
+		if value := secret.Field(field.name); value != nil {
+			values[field.key] = stringValue(value.Value)
+			used[field.name] = true
+		}
+	}
+	return values
+}
+
+// isURLField returns true for the fields of the additional URIs: URL <n>
+func isURLField(name string) bool {
+	if !strings.HasPrefix(name, pkgalan.URLField+" ") {
+		return false
+	}
+	_, err := strconv.Atoi(strings.TrimPrefix(name, pkgalan.URLField+" "))
+	return err == nil
+}
+
+// stringValue returns a JSON string, null if empty
+func stringValue(value string) *string {
+	if len(value) == 0 {
+		return nil
+	}
+	return &value
+}
+
+// encodeUUID returns the alan UUID of an item id, or "" if it isn't a GUID
+func encodeUUID(id string) string {
+	data, err := hex.DecodeString(strings.Replace(id, "-", "", -1))
+	if err != nil || len(data) != 16 {
+		return ""
+	}
+	return base64.StdEncoding.EncodeToString(data)
+}
+
+// decodeUUID returns the item id of an alan UUID, or a new one
+func decodeUUID(uuid string) string {
+	data, err := base64.StdEncoding.DecodeString(uuid)
+	if err != nil || len(data) != 16 {
+		return newID()
+	}
+	return formatID(data)
+}
+
+// newID returns a random GUID
+func newID() string {
+	data := make([]byte, 16)
+	rand.Read(data)
+	data[6] = data[6]&0x0f | 0x40
+	data[8] = data[8]&0x3f | 0x80
+	return formatID(data)
+}
+
+func formatID(data []byte) string {
+	text := hex.EncodeToString(data)
+	return strings.Join([]string{text[:8], text[8:12], text[12:16], text[16:20], text[20:]}, "-")
+}
@@ -0,0 +1,304 @@
+// Copyright (C) 2018 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bitwarden
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/golang/glog"
+
+	pkgalan "github.com/nlamirault/alan/pkg/alan"
+)
+
+// folderSeparator separates the levels of the nested folders
+const folderSeparator = "/"
+
+// Provider exposes a Bitwarden JSON export as a password manager storage.
+// The folders, or the collections of an organization export, are the
+// groups. Written items are matched by UUID, then by path.
+type Provider struct {
+	filename  string
+	password  func() (string, error)
+	unlocked  string
+	overwrite bool
+	backups   int
+	kdf       *KDF
+	export    *Export
+	folders   map[string]*Folder
+	modified  bool
+}
+
+// NewProvider creates a provider for a JSON export. The password function
+// is called once, for the password-protected exports.
+// Using overwrite, an existing export is replaced by a new one.
+func NewProvider(filename string, password func() (string, error), overwrite bool) *Provider {
+	return &Provider{
+		filename:  filename,
+		password:  password,
+		overwrite: overwrite,
+		backups:   pkgalan.DefaultBackups,
+	}
+}
+
+// SetBackups defines the number of backup copies kept when the export is saved
+func (provider *Provider) SetBackups(backups int) {
+	provider.backups = backups
+}
+
+// SetEncryption protects the saved export with the password, using the
+// key derivation. Otherwise, an existing export keeps its encryption.
+func (provider *Provider) SetEncryption(kdf *KDF) {
+	provider.kdf = kdf
+}
+
+// Open reads the export, or starts a new one if it doesn't exist
+func (provider *Provider) Open() error {
+	glog.V(2).Infof("Open Bitwarden export: %s", provider.filename)
+	file, err := os.Open(provider.filename)
+	if os.IsNotExist(err) || (err == nil && provider.overwrite) {
+		if file != nil {
+			file.Close()
+		}
+		glog.V(1).Infof("Create Bitwarden export: %s", provider.filename)
+		provider.setExport(NewExport())
+		provider.modified = true
+		if provider.kdf != nil {
+			_, err := provider.unlock()
+			return err
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	export, kdf, err := Decode(file, provider.unlock)
+	if err != nil {
+		return fmt.Errorf("Invalid Bitwarden export %s: %s", provider.filename, err)
+	}
+	if provider.kdf == nil {
+		provider.kdf = kdf
+	}
+	provider.setExport(export)
+	if provider.kdf != nil {
+		_, err := provider.unlock()
+		return err
+	}
+	return nil
+}
+
+// unlock returns the password, asked once
+func (provider *Provider) unlock() (string, error) {
+	if len(provider.unlocked) == 0 {
+		password, err := provider.password()
+		if err != nil {
+			return "", err
+		}
+		provider.unlocked = password
+	}
+	return provider.unlocked, nil
+}
+
+func (provider *Provider) setExport(export *Export) {
+	provider.export = export
+	provider.folders = map[string]*Folder{}
+	for _, folder := range append(append([]*Folder{}, export.Folders...), export.Collections...) {
+		provider.folders[folder.ID] = folder
+	}
+}
+
+// Load returns the tree of folders of the export
+func (provider *Provider) Load() (*pkgalan.Group, error) {
+	tree := pkgalan.NewGroupTree()
+	for _, folder := range provider.containers() {
+		tree.Group(splitFolder(folder.Name))
+	}
+	for _, item := range provider.export.Items {
+		if len(item.Name) == 0 {
+			glog.Infof("Skipping item: %s", item.ID)
+			continue
+		}
+		group := tree.Group(provider.itemGroup(item))
+		group.Secrets = append(group.Secrets, toSecret(item))
+	}
+	return tree.Root, nil
+}
+
+// Read returns the secret of an item, or nil if it doesn't exist
+func (provider *Provider) Read(path string) (*pkgalan.Secret, error) {
+	index := provider.findItem(path, "")
+	if index < 0 {
+		return nil, nil
+	}
+	secret := toSecret(provider.export.Items[index])
+	return &secret, nil
+}
+
+// Write creates or updates an item
+func (provider *Provider) Write(path string, secret pkgalan.Secret) error {
+	names := pkgalan.SplitPath(path)
+	if len(names) == 0 {
+		return fmt.Errorf("Invalid path: %s", path)
+	}
+	var item *Item
+	if index := provider.findItem(path, secret.UUID); index >= 0 {
+		item = provider.export.Items[index]
+	} else {
+		item = &Item{ID: decodeUUID(secret.UUID)}
+		provider.export.Items = append(provider.export.Items, item)
+	}
+	glog.V(1).Infof("Write item: %s", path)
+	updateItem(item, secret)
+	provider.setGroup(item, names[:len(names)-1])
+	provider.modified = true
+	return nil
+}
+
+// Delete removes an item
+func (provider *Provider) Delete(path string) error {
+	index := provider.findItem(path, "")
+	if index < 0 {
+		return fmt.Errorf("No item for path %s", path)
+	}
+	glog.V(1).Infof("Delete item: %s", path)
+	items := provider.export.Items
+	provider.export.Items = append(items[:index], items[index+1:]...)
+	provider.modified = true
+	return nil
+}
+
+// CreateGroup creates a folder, or a collection
+func (provider *Provider) CreateGroup(path string) error {
+	names := pkgalan.SplitPath(path)
+	if len(names) > 0 {
+		provider.mkFolder(names)
+	}
+	return nil
+}
+
+// Discard drops the changes not saved yet
+func (provider *Provider) Discard() {
+	provider.modified = false
+}
+
+// Close saves the export if it was modified
+func (provider *Provider) Close() error {
+	if provider.modified {
+		glog.V(2).Infof("Output file for Bitwarden export: %s", provider.filename)
+		err := pkgalan.WriteFile(provider.filename, provider.backups, func(w io.Writer) error {
+			return provider.export.Encode(w, provider.unlocked, provider.kdf)
+		})
+		if err != nil {
+			return err
+		}
+		provider.modified = false
+	}
+	provider.unlocked = ""
+	return nil
+}
+
+// isOrganization returns true for the exports of an organization, which use collections
+func (provider *Provider) isOrganization() bool {
+	return len(provider.export.Collections) > 0 && len(provider.export.Folders) == 0
+}
+
+// containers returns the folders, or the collections of an organization export
+func (provider *Provider) containers() []*Folder {
+	if provider.isOrganization() {
+		return provider.export.Collections
+	}
+	return provider.export.Folders
+}
+
+// itemGroup returns the names of the folder of an item, or else of its first collection
+func (provider *Provider) itemGroup(item *Item) []string {
+	id := item.FolderID
+	if len(id) == 0 && len(item.CollectionIDs) > 0 {
+		id = item.CollectionIDs[0]
+	}
+	if folder, ok := provider.folders[id]; ok {
+		return splitFolder(folder.Name)
+	}
+	return []string{}
+}
+
+// setGroup moves an item into the folder, or the collection, of the group
+func (provider *Provider) setGroup(item *Item, group []string) {
+	item.FolderID, item.CollectionIDs = "", nil
+	if len(group) == 0 {
+		return
+	}
+	folder := provider.mkFolder(group)
+	if provider.isOrganization() {
+		item.CollectionIDs, item.OrganizationID = []string{folder.ID}, folder.OrganizationID
+	} else {
+		item.FolderID = folder.ID
+	}
+}
+
+// mkFolder returns the folder of the group, created with its parents if needed
+func (provider *Provider) mkFolder(group []string) *Folder {
+	name := strings.Join(group, folderSeparator)
+	containers := provider.containers()
+	for _, folder := range containers {
+		if folder.Name == name {
+			return folder
+		}
+	}
+	if len(group) > 1 {
+		provider.mkFolder(group[:len(group)-1])
+	}
+	folder := &Folder{ID: newID(), Name: name}
+	if provider.isOrganization() {
+		folder.OrganizationID = containers[0].OrganizationID
+		provider.export.Collections = append(provider.export.Collections, folder)
+	} else {
+		provider.export.Folders = append(provider.export.Folders, folder)
+	}
+	provider.folders[folder.ID] = folder
+	provider.modified = true
+	return folder
+}
+
+// findItem returns the index of the item with the UUID, or else with the path, or -1
+func (provider *Provider) findItem(path string, uuid string) int {
+	if len(uuid) > 0 {
+		for i, item := range provider.export.Items {
+			if encodeUUID(item.ID) == uuid {
+				return i
+			}
+		}
+	}
+	for i, item := range provider.export.Items {
+		if pkgalan.GroupPath(append(provider.itemGroup(item), item.Name)) == path {
+			return i
+		}
+	}
+	return -1
+}
+
+// splitFolder returns the levels of the name of a nested folder
+func splitFolder(name string) []string {
+	names := []string{}
+	for _, level := range strings.Split(name, folderSeparator) {
+		if len(level) > 0 {
+			names = append(names, level)
+		}
+	}
+	return names
+}
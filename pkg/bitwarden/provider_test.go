@@ -0,0 +1,230 @@
+// Copyright (C) 2018 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bitwarden
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	pkgalan "github.com/nlamirault/alan/pkg/alan"
+)
+
+const testExport = `{
+  "encrypted": false,
+  "folders": [
+    {"id": "0a3f8d1e-2b4c-4d5e-8f60-718293a4b5c6", "name": "Dev"},
+    {"id": "1b4f8d1e-2b4c-4d5e-8f60-718293a4b5c6", "name": "Dev/Tools"}
+  ],
+  "items": [{
+    "id": "c1b2a3d4-e5f6-4a7b-8c9d-0e1f2a3b4c5d", "organizationId": null,
+    "folderId": "1b4f8d1e-2b4c-4d5e-8f60-718293a4b5c6", "type": 1, "reprompt": 0,
+    "name": "Github", "notes": "work account", "favorite": true,
+    "fields": [
+      {"name": "team", "value": "enigma", "type": 0, "linkedId": null},
+      {"name": "recovery", "value": "1234", "type": 1, "linkedId": null},
+      {"name": "admin", "value": "true", "type": 2, "linkedId": null},
+      {"name": "user", "value": null, "type": 3, "linkedId": 100}
+    ],
+    "login": {
+      "uris": [{"match": null, "uri": "https://github.com"}, {"match": 1, "uri": "https://gist.github.com"}],
+      "username": "alan", "password": "enigma", "totp": "otpauth://totp/github?secret=ABC"
+    },
+    "passwordHistory": [
+      {"lastUsedDate": "2018-04-01T10:00:00.000Z", "password": "bombe"},
+      {"lastUsedDate": "2018-03-01T10:00:00.000Z", "password": "turing"}
+    ],
+    "revisionDate": "2018-05-02T10:12:45.000Z", "collectionIds": null
+  }, {
+    "id": "d1b2a3d4-e5f6-4a7b-8c9d-0e1f2a3b4c5d", "folderId": null, "type": 2,
+    "name": "Note", "notes": "just a note", "favorite": false, "secureNote": {"type": 0}
+  }, {
+    "id": "e1b2a3d4-e5f6-4a7b-8c9d-0e1f2a3b4c5d", "folderId": "0a3f8d1e-2b4c-4d5e-8f60-718293a4b5c6", "type": 3,
+    "name": "Visa", "notes": null, "favorite": false,
+    "card": {"cardholderName": "Alan Turing", "brand": "Visa", "number": "4111111111111111",
+      "expMonth": "12", "expYear": "2025", "code": "123"}
+  }, {
+    "id": "f1b2a3d4-e5f6-4a7b-8c9d-0e1f2a3b4c5d", "type": 4, "name": "Identity", "favorite": false,
+    "identity": {"title": "Dr", "firstName": "Alan", "middleName": null, "lastName": "Turing",
+      "city": "Bletchley", "email": "alan@example.com", "ssn": "078-05-1120", "username": "aturing"}
+  }]
+}`
+
+func Test_Encryption(t *testing.T) {
+	// RFC 5869, test case 1
+	prk, _ := hex.DecodeString("077709362c2e32df0ddc3f0dc47bba6390b6c73bb50f9c3122ec844ad7c2b3e5")
+	info, _ := hex.DecodeString("f0f1f2f3f4f5f6f7f8f9")
+	if okm := hex.EncodeToString(hkdfExpand(prk, string(info))); okm != "3cb25f25faacd57a90434f64d0362f2a2d2d0a90cf1a5a4c5db02d56ecc4c5bf" {
+		t.Fatalf("Invalid HKDF: %s", okm)
+	}
+
+	password := func(text string) func() (string, error) {
+		return func() (string, error) { return text, nil }
+	}
+	for _, kdf := range []*KDF{
+		{Type: KDFPBKDF2, Iterations: 1000},
+		{Type: KDFArgon2id, Iterations: 2, Memory: 1, Parallelism: 2},
+	} {
+		export := NewExport()
+		export.Items = append(export.Items, &Item{ID: newID(), Type: ItemSecureNote, Name: "Note", Notes: "enigma"})
+		var buffer bytes.Buffer
+		if err := export.Encode(&buffer, "turing", kdf); err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(buffer.String(), "enigma") {
+			t.Fatalf("Export not encrypted: %s", buffer.String())
+		}
+		decoded, decodedKDF, err := Decode(bytes.NewReader(buffer.Bytes()), password("turing"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *decodedKDF != *kdf || len(decoded.Items) != 1 || decoded.Items[0].Notes != "enigma" {
+			t.Fatalf("Invalid export: %v %v", decodedKDF, decoded.Items)
+		}
+		if _, _, err := Decode(bytes.NewReader(buffer.Bytes()), password("bombe")); err == nil {
+			t.Fatalf("Decrypted with a wrong password")
+		}
+	}
+	if _, _, err := Decode(strings.NewReader(`{"encrypted": true, "encKeyValidation_DO_NOT_EDIT": "2.a|b|c"}`), password("turing")); err == nil {
+		t.Fatalf("Decoded an account restricted export")
+	}
+}
+
+func Test_Provider(t *testing.T) {
+	dir, err := ioutil.TempDir("", "alan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "bitwarden.json")
+	if err := ioutil.WriteFile(filename, []byte(testExport), 0600); err != nil {
+		t.Fatal(err)
+	}
+	password := func() (string, error) { return "turing", nil }
+
+	provider := NewProvider(filename, password, false)
+	if err := provider.Open(); err != nil {
+		t.Fatal(err)
+	}
+	tree, _ := provider.Load()
+	groups, secrets := tree.Index()
+	if len(secrets) != 4 || len(groups) != 3 {
+		t.Fatalf("Invalid tree: %v %v", groups, secrets)
+	}
+	github := secrets["Dev/Tools/Github"]
+	if github.Username != "alan" || github.Password != "enigma" || github.URL != "https://github.com" ||
+		github.Notes != "work account" || github.Tags[0] != pkgalan.FavoriteTag || github.Modified.Unix() != 1525255965 ||
+		github.UUID != encodeUUID("c1b2a3d4-e5f6-4a7b-8c9d-0e1f2a3b4c5d") {
+		t.Fatalf("Invalid login: %#v", github)
+	}
+	expected := []pkgalan.Field{
+		{Name: "URL 2", Value: "https://gist.github.com"},
+		{Name: pkgalan.OTPField, Value: "otpauth://totp/github?secret=ABC", Protected: true},
+		{Name: "team", Value: "enigma"},
+		{Name: "recovery", Value: "1234", Protected: true},
+		{Name: "admin", Value: "true"},
+	}
+	if len(github.Fields) != len(expected) {
+		t.Fatalf("Invalid fields: %v", github.Fields)
+	}
+	for i, field := range expected {
+		if github.Fields[i] != field {
+			t.Fatalf("Invalid field: %v", github.Fields[i])
+		}
+	}
+	if history := github.PasswordHistory; len(history) != 2 || history[0].Password != "turing" {
+		t.Fatalf("Invalid history: %v", history)
+	}
+	if visa := secrets["Dev/Visa"]; visa.Field(ItemTypeField).Value != cardType ||
+		!visa.Field("Number").Protected || visa.Field("Expiration Year").Value != "2025" {
+		t.Fatalf("Invalid card: %v", visa.Fields)
+	}
+	if identity := secrets["Identity"]; identity.Username != "aturing" || identity.Field("City").Value != "Bletchley" ||
+		!identity.Field("SSN").Protected || identity.Field("Middle Name") != nil {
+		t.Fatalf("Invalid identity: %#v", identity)
+	}
+
+	// Write the secrets into a new encrypted export and read them again
+	exported := NewProvider(filepath.Join(dir, "encrypted.json"), password, false)
+	exported.SetEncryption(&KDF{Type: KDFArgon2id, Iterations: 2, Memory: 1, Parallelism: 1})
+	if err := exported.Open(); err != nil {
+		t.Fatal(err)
+	}
+	for path, secret := range secrets {
+		if err := exported.Write(path, *secret); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := exported.CreateGroup("Empty/Folder"); err != nil {
+		t.Fatal(err)
+	}
+	if err := exported.Close(); err != nil {
+		t.Fatal(err)
+	}
+	exported = NewProvider(filepath.Join(dir, "encrypted.json"), password, false)
+	if err := exported.Open(); err != nil {
+		t.Fatal(err)
+	}
+	tree, _ = exported.Load()
+	copies, copied := tree.Index()
+	if len(copied) != len(secrets) || len(copies) != len(groups)+2 {
+		t.Fatalf("Invalid copy: %v %v", copies, copied)
+	}
+	for path, secret := range secrets {
+		if !secret.Equal(copied[path]) || copied[path].UUID != secret.UUID {
+			t.Fatalf("Invalid copy of %s: %#v", path, copied[path])
+		}
+	}
+	if history := copied["Dev/Tools/Github"].PasswordHistory; len(history) != 2 || history[1].Password != "bombe" {
+		t.Fatalf("Invalid history: %v", history)
+	}
+
+	// A new password is added to the history
+	github.Password = "colossus"
+	if err := exported.Write("Dev/Tools/Github", *github); err != nil {
+		t.Fatal(err)
+	}
+	if item := exported.export.Items[exported.findItem("Dev/Tools/Github", "")]; len(item.PasswordHistory) != 3 ||
+		item.PasswordHistory[0].Password != "enigma" {
+		t.Fatalf("Invalid history: %v", item.PasswordHistory)
+	}
+}
+
+func Test_Organization(t *testing.T) {
+	export, _, err := Decode(strings.NewReader(`{"encrypted": false,
+	  "collections": [{"id": "c1", "organizationId": "o1", "name": "Shared/Ops"}],
+	  "items": [{"id": "i1", "organizationId": "o1", "type": 2, "name": "Runbook", "notes": "restart",
+	    "secureNote": {"type": 0}, "collectionIds": ["c1"]}]}`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider := NewProvider("", nil, false)
+	provider.setExport(export)
+	if secret, _ := provider.Read("Shared/Ops/Runbook"); secret == nil || secret.Notes != "restart" {
+		t.Fatalf("Invalid secret: %v", secret)
+	}
+	if err := provider.Write("Shared/Dev/Wiki", pkgalan.Secret{Title: "Wiki", Notes: "docs"}); err != nil {
+		t.Fatal(err)
+	}
+	item := export.Items[1]
+	if len(export.Folders) != 0 || len(export.Collections) != 3 || item.OrganizationID != "o1" ||
+		len(item.CollectionIDs) != 1 || provider.folders[item.CollectionIDs[0]].Name != "Shared/Dev" {
+		t.Fatalf("Invalid collections: %v %v", export.Collections, item)
+	}
+}
@@ -15,9 +15,23 @@
 package cmd
 
 import (
+	"os"
+
 	"github.com/fatih/color"
 )
 
+func init() {
+	// https://no-color.org
+	if len(os.Getenv("NO_COLOR")) > 0 {
+		color.NoColor = true
+	}
+}
+
+// DisableColors removes the colors of the output
+func DisableColors() {
+	color.NoColor = true
+}
+
 var (
 	BlueOut   = color.New(color.FgBlue).SprintFunc()
 	GreenOut  = color.New(color.FgGreen).SprintFunc()
@@ -0,0 +1,132 @@
+// Copyright (C) 2018 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/hashicorp/hcl"
+	"github.com/mitchellh/go-homedir"
+)
+
+// DefaultConfigFile is the default configuration file
+const DefaultConfigFile = "~/.alan/config.hcl"
+
+// Config define the configuration file
+type Config struct {
+	// DefaultProfile is the profile used if none is selected
+	DefaultProfile string     `hcl:"default_profile"`
+	Profiles       []*Profile `hcl:"profile"`
+}
+
+// Profile define a named set of settings
+type Profile struct {
+	Name      string          `hcl:",key"`
+	Vault     *VaultProfile   `hcl:"vault"`
+	KeepassXC *KeepassProfile `hcl:"keepassxc"`
+	// Mappings map the KeepassXC groups to Vault paths
+	Mappings []*Mapping `hcl:"mapping"`
+}
+
+// VaultProfile define the Vault server settings
+type VaultProfile struct {
+	Address       string       `hcl:"address"`
+	Mount         string       `hcl:"mount"`
+	Prefix        string       `hcl:"prefix"`
+	CACert        string       `hcl:"ca_cert"`
+	CAPath        string       `hcl:"ca_path"`
+	ClientCert    string       `hcl:"client_cert"`
+	ClientKey     string       `hcl:"client_key"`
+	TLSServerName string       `hcl:"tls_server_name"`
+	TLSSkipVerify bool         `hcl:"tls_skip_verify"`
+	Auth          *AuthProfile `hcl:"auth"`
+}
+
+// AuthProfile define the Vault authentication settings
+type AuthProfile struct {
+	Method          string `hcl:"method"`
+	Mount           string `hcl:"mount"`
+	Username        string `hcl:"username"`
+	PasswordFile    string `hcl:"password_file"`
+	RoleID          string `hcl:"role_id"`
+	RoleIDFile      string `hcl:"role_id_file"`
+	SecretIDFile    string `hcl:"secret_id_file"`
+	SecretIDWrapped bool   `hcl:"secret_id_wrapped"`
+	CertName        string `hcl:"cert_name"`
+	Role            string `hcl:"role"`
+	JWTFile         string `hcl:"jwt_file"`
+}
+
+// KeepassProfile define the KeepassXC database settings
+type KeepassProfile struct {
+	Database        string `hcl:"database"`
+	KeyFile         string `hcl:"key_file"`
+	PasswordFile    string `hcl:"password_file"`
+	PasswordCommand string `hcl:"password_command"`
+}
+
+// Mapping stores the secrets of a KeepassXC group under another Vault path
+type Mapping struct {
+	KeepassXC string `hcl:",key"`
+	Vault     string `hcl:"vault"`
+}
+
+// LoadConfig reads a configuration file. A missing file returns an empty configuration.
+func LoadConfig(filename string) (*Config, error) {
+	filename, err := homedir.Expand(filename)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		glog.V(1).Infof("No configuration file: %s", filename)
+		return &Config{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	config := &Config{}
+	if err := hcl.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("Invalid configuration file %s: %s", filename, err)
+	}
+	return config, nil
+}
+
+// Profile returns the profile with the given name, or the default one if the name is empty.
+// Without default profile, nil is returned.
+func (config *Config) Profile(name string) (*Profile, error) {
+	if len(name) == 0 {
+		name = config.DefaultProfile
+		if len(name) == 0 {
+			return nil, nil
+		}
+	}
+	for _, profile := range config.Profiles {
+		if profile.Name == name {
+			return profile, nil
+		}
+	}
+	names := []string{}
+	for _, profile := range config.Profiles {
+		names = append(names, profile.Name)
+	}
+	sort.Strings(names)
+	return nil, fmt.Errorf("Unknown profile %s. Available profiles: %s", name, strings.Join(names, ", "))
+}
@@ -0,0 +1,83 @@
+// Copyright (C) 2018 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_LoadConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "alan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "config.hcl")
+	data := `
+default_profile = "work"
+
+profile "work" {
+  vault {
+    address = "https://vault.example.com:8200"
+    mount   = "team-kv"
+    auth {
+      method   = "userpass"
+      username = "alan"
+    }
+  }
+  keepassxc {
+    database = "~/work.kdbx"
+  }
+  mapping "Work/Infra" {
+    vault = "infra"
+  }
+}
+
+profile "home" {
+  vault {
+    tls_skip_verify = true
+  }
+}
+`
+	if err := ioutil.WriteFile(filename, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	config, err := LoadConfig(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	profile, err := config.Profile("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if profile.Name != "work" || profile.Vault.Mount != "team-kv" || profile.Vault.Auth.Username != "alan" ||
+		profile.KeepassXC.Database != "~/work.kdbx" || len(profile.Mappings) != 1 || profile.Mappings[0].KeepassXC != "Work/Infra" || profile.Mappings[0].Vault != "infra" {
+		t.Fatalf("Invalid profile: %#v", profile)
+	}
+	if profile, err := config.Profile("home"); err != nil || !profile.Vault.TLSSkipVerify || profile.KeepassXC != nil {
+		t.Fatalf("Invalid profile: %#v %v", profile, err)
+	}
+	if _, err := config.Profile("unknown"); err == nil {
+		t.Fatalf("Unknown profile found")
+	}
+
+	config, err = LoadConfig(filepath.Join(dir, "missing.hcl"))
+	if err != nil || len(config.Profiles) != 0 {
+		t.Fatalf("Invalid missing configuration: %#v %v", config, err)
+	}
+}
@@ -0,0 +1,50 @@
+// Copyright (C) 2018 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+)
+
+const (
+	// DefaultPasswordLength is the length of the generated passwords
+	DefaultPasswordLength = 24
+
+	letters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	symbols = "!#$%&()*+,-./:;<=>?@[]^_{}~"
+)
+
+// GeneratePassword returns a random password, using letters, digits and,
+// if withSymbols, symbols.
+func GeneratePassword(length int, withSymbols bool) (string, error) {
+	if length < 8 {
+		return "", fmt.Errorf("password length must be at least 8: %d", length)
+	}
+	alphabet := letters
+	if withSymbols {
+		alphabet += symbols
+	}
+	password := make([]byte, length)
+	for i := range password {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(alphabet))))
+		if err != nil {
+			return "", err
+		}
+		password[i] = alphabet[n.Int64()]
+	}
+	return string(password), nil
+}
@@ -0,0 +1,36 @@
+// Copyright (C) 2018 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"strings"
+	"testing"
+)
+
+func Test_GeneratePassword(t *testing.T) {
+	password, err := GeneratePassword(32, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(password) != 32 || strings.ContainsAny(password, symbols) {
+		t.Fatalf("Invalid password: %s", password)
+	}
+	if other, _ := GeneratePassword(32, false); other == password {
+		t.Fatalf("Same passwords generated: %s", password)
+	}
+	if _, err := GeneratePassword(4, true); err == nil {
+		t.Fatalf("Generated a short password")
+	}
+}
@@ -15,6 +15,8 @@
 package cmd
 
 import (
+	"bufio"
+	"errors"
 	"fmt"
 	"os"
 	"strings"
@@ -23,11 +25,19 @@ import (
 	"golang.org/x/crypto/ssh/terminal"
 )
 
-// ReadPassword ask the user to enter a password
+// ErrNoTerminal is returned when a password must be asked but the standard
+// input is not a terminal. Callers wrap it with the alternatives they support.
+var ErrNoTerminal = errors.New("No terminal available to ask the password")
+
+// ReadPassword ask the user to enter a password.
+// It fails with ErrNoTerminal if the standard input is not a terminal.
 func ReadPassword(prompt string) (passwd string, err error) {
-	fmt.Fprint(os.Stdout, prompt)
+	if !terminal.IsTerminal(int(syscall.Stdin)) {
+		return "", ErrNoTerminal
+	}
+	fmt.Fprint(os.Stderr, prompt)
 	buf, err := terminal.ReadPassword(int(syscall.Stdin))
-	fmt.Fprint(os.Stdout, "\n")
+	fmt.Fprint(os.Stderr, "\n")
 	if err != nil {
 		return "", err
 	}
@@ -35,3 +45,17 @@ func ReadPassword(prompt string) (passwd string, err error) {
 	passwd = strings.TrimSpace(string(buf))
 	return
 }
+
+// Ask displays a question and returns the answer of the user.
+// It fails if the standard input is not a terminal.
+func Ask(question string) (string, error) {
+	if !terminal.IsTerminal(int(syscall.Stdin)) {
+		return "", fmt.Errorf("No terminal available to ask: %s", question)
+	}
+	fmt.Fprint(os.Stderr, question)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(answer), nil
+}
@@ -0,0 +1,266 @@
+// Copyright (C) 2018 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// Output formats
+const (
+	// OutputTable is the human readable output
+	OutputTable = "table"
+	// OutputJSON is an indented JSON document
+	OutputJSON = "json"
+	// OutputYAML is a YAML document
+	OutputYAML = "yaml"
+	// OutputEnv are shell variable assignments
+	OutputEnv = "env"
+	// OutputTemplate uses a Go template
+	OutputTemplate = "template"
+)
+
+// OutputFormats are the available output formats
+var OutputFormats = []string{OutputTable, OutputJSON, OutputYAML, OutputEnv, OutputTemplate}
+
+// Printer writes the result of a command using an output format
+type Printer struct {
+	out      io.Writer
+	format   string
+	template *template.Template
+}
+
+// NewPrinter creates a printer. The template is required by the template format.
+func NewPrinter(out io.Writer, format string, text string) (*Printer, error) {
+	printer := &Printer{
+		out:    out,
+		format: format,
+	}
+	switch format {
+	case OutputTable, OutputJSON, OutputYAML, OutputEnv:
+	case OutputTemplate:
+		if len(text) == 0 {
+			return nil, fmt.Errorf("A template is required by the template output")
+		}
+		tmpl, err := template.New("output").Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid template: %s", err)
+		}
+		printer.template = tmpl
+	default:
+		return nil, fmt.Errorf("Invalid output %s. Available outputs: %s", format, strings.Join(OutputFormats, ", "))
+	}
+	return printer, nil
+}
+
+// IsTable returns true if the output is human readable
+func (printer *Printer) IsTable() bool {
+	return printer.format == OutputTable
+}
+
+// Print writes the value. The table output is written by the table function.
+func (printer *Printer) Print(value interface{}, table func(out io.Writer) error) error {
+	switch printer.format {
+	case OutputJSON:
+		encoder := json.NewEncoder(printer.out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(value)
+	case OutputYAML:
+		document, err := toDocument(value)
+		if err != nil {
+			return err
+		}
+		return writeYAML(printer.out, document, 0)
+	case OutputEnv:
+		document, err := toDocument(value)
+		if err != nil {
+			return err
+		}
+		return writeEnv(printer.out, "", document)
+	case OutputTemplate:
+		if err := printer.template.Execute(printer.out, value); err != nil {
+			return err
+		}
+		_, err := fmt.Fprintln(printer.out)
+		return err
+	}
+	return table(printer.out)
+}
+
+// toDocument converts a value to its JSON representation: maps, slices and scalars
+func toDocument(value interface{}) (interface{}, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var document interface{}
+	if err := json.Unmarshal(data, &document); err != nil {
+		return nil, err
+	}
+	return document, nil
+}
+
+func sortedKeys(object map[string]interface{}) []string {
+	keys := []string{}
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// writeYAML writes a document as YAML, with sorted keys
+func writeYAML(out io.Writer, document interface{}, depth int) error {
+	indent := strings.Repeat("  ", depth)
+	switch value := document.(type) {
+	case map[string]interface{}:
+		if len(value) == 0 {
+			_, err := fmt.Fprintf(out, "%s{}\n", indent)
+			return err
+		}
+		for _, key := range sortedKeys(value) {
+			if err := writeYAMLEntry(out, indent+yamlScalar(key)+":", value[key], depth); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		if len(value) == 0 {
+			_, err := fmt.Fprintf(out, "%s[]\n", indent)
+			return err
+		}
+		for _, item := range value {
+			if err := writeYAMLEntry(out, indent+"-", item, depth); err != nil {
+				return err
+			}
+		}
+	default:
+		_, err := fmt.Fprintf(out, "%s%s\n", indent, yamlScalar(value))
+		return err
+	}
+	return nil
+}
+
+// writeYAMLEntry writes a value after a key or a list marker
+func writeYAMLEntry(out io.Writer, prefix string, value interface{}, depth int) error {
+	switch item := value.(type) {
+	case map[string]interface{}:
+		if len(item) == 0 {
+			_, err := fmt.Fprintf(out, "%s {}\n", prefix)
+			return err
+		}
+		if !strings.HasSuffix(prefix, "-") {
+			fmt.Fprintln(out, prefix)
+			return writeYAML(out, item, depth+1)
+		}
+		// The first key of a list item follows the marker
+		var buffer bytes.Buffer
+		if err := writeYAML(&buffer, item, depth+1); err != nil {
+			return err
+		}
+		_, err := fmt.Fprint(out, prefix+" "+strings.TrimPrefix(buffer.String(), strings.Repeat("  ", depth+1)))
+		return err
+	case []interface{}:
+		if len(item) > 0 {
+			fmt.Fprintln(out, prefix)
+			return writeYAML(out, item, depth+1)
+		}
+		_, err := fmt.Fprintf(out, "%s []\n", prefix)
+		return err
+	}
+	_, err := fmt.Fprintf(out, "%s %s\n", prefix, yamlScalar(value))
+	return err
+}
+
+var (
+	yamlPlain = regexp.MustCompile(`^[A-Za-z_./][A-Za-z0-9_./ @()-]*$`)
+	// yamlFloat matches the plain strings read as floats, such as .5
+	yamlFloat = regexp.MustCompile(`^\.[0-9]`)
+)
+
+// yamlScalar formats a scalar, quoting the strings which aren't plain
+func yamlScalar(value interface{}) string {
+	switch scalar := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return strconv.FormatBool(scalar)
+	case float64:
+		return strconv.FormatFloat(scalar, 'f', -1, 64)
+	case string:
+		switch strings.ToLower(scalar) {
+		case "true", "false", "yes", "no", "on", "off", "null", "~",
+			".inf", "-.inf", "+.inf", ".nan":
+			return strconv.Quote(scalar)
+		}
+		if yamlPlain.MatchString(scalar) && !yamlFloat.MatchString(scalar) && !strings.HasSuffix(scalar, " ") {
+			return scalar
+		}
+		return strconv.Quote(scalar)
+	}
+	return strconv.Quote(fmt.Sprint(value))
+}
+
+var envInvalid = regexp.MustCompile(`[^A-Z0-9_]+`)
+
+// writeEnv writes a document as shell variables. Nested keys and indexes are joined with _.
+func writeEnv(out io.Writer, prefix string, document interface{}) error {
+	name := func(key string) string {
+		key = envInvalid.ReplaceAllString(strings.ToUpper(key), "_")
+		if len(prefix) == 0 && len(key) > 0 && (key[0] < '0' || key[0] > '9') {
+			return key
+		}
+		if len(prefix) == 0 {
+			return "VALUE_" + key
+		}
+		return prefix + "_" + key
+	}
+	switch value := document.(type) {
+	case map[string]interface{}:
+		for _, key := range sortedKeys(value) {
+			if err := writeEnv(out, name(key), value[key]); err != nil {
+				return err
+			}
+		}
+		return nil
+	case []interface{}:
+		for i, item := range value {
+			if err := writeEnv(out, name(strconv.Itoa(i)), item); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if len(prefix) == 0 {
+		prefix = "VALUE"
+	}
+	text := ""
+	switch scalar := document.(type) {
+	case nil:
+	case float64:
+		text = strconv.FormatFloat(scalar, 'f', -1, 64)
+	default:
+		text = fmt.Sprint(scalar)
+	}
+	_, err := fmt.Fprintf(out, "%s='%s'\n", prefix, strings.Replace(text, "'", `'\''`, -1))
+	return err
+}
@@ -0,0 +1,94 @@
+// Copyright (C) 2018 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+type outputValue struct {
+	Title  string
+	Fields []map[string]interface{}
+	Empty  []string
+	Quoted string
+}
+
+func Test_Printer(t *testing.T) {
+	value := outputValue{
+		Title:  "Github",
+		Fields: []map[string]interface{}{{"Name": "PIN", "Value": "1234", "Protected": true}},
+		Empty:  []string{},
+		Quoted: "it's: yes",
+	}
+	expected := map[string]string{
+		OutputYAML: `Empty: []
+Fields:
+  - Name: PIN
+    Protected: true
+    Value: "1234"
+Quoted: "it's: yes"
+Title: Github
+`,
+		OutputEnv: `FIELDS_0_NAME='PIN'
+FIELDS_0_PROTECTED='true'
+FIELDS_0_VALUE='1234'
+QUOTED='it'\''s: yes'
+TITLE='Github'
+`,
+		OutputTemplate: "Github\n",
+		OutputTable:    "table\n",
+	}
+	for format, text := range expected {
+		var out bytes.Buffer
+		printer, err := NewPrinter(&out, format, "{{.Title}}")
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = printer.Print(value, func(out io.Writer) error {
+			_, err := io.WriteString(out, "table\n")
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != text {
+			t.Fatalf("Invalid %s output:\n%s", format, out.String())
+		}
+	}
+	if _, err := NewPrinter(nil, OutputTemplate, ""); err == nil {
+		t.Fatalf("Template output without template")
+	}
+	if _, err := NewPrinter(nil, "xml", ""); err == nil {
+		t.Fatalf("Invalid output accepted")
+	}
+}
+
+func Test_YAMLScalar(t *testing.T) {
+	for value, expected := range map[string]string{
+		"Github": "Github",
+		".inf":   `".inf"`,
+		".Inf":   `".Inf"`,
+		"-.inf":  `"-.inf"`,
+		".NaN":   `".NaN"`,
+		".5":     `".5"`,
+		".ssh":   ".ssh",
+	} {
+		if scalar := yamlScalar(value); scalar != expected {
+			t.Fatalf("Invalid YAML scalar for %s: %s", value, scalar)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright (C) 2018 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/golang/glog"
+)
+
+// PasswordSource define where a password is read from.
+// The first source set is used: File, Stdin, Command, then the environment
+// variable. If none is available, the password is asked using Prompt.
+type PasswordSource struct {
+	// File is a file which contains the password
+	File string
+	// Stdin reads the password from the first line of the standard input
+	Stdin bool
+	// Command is a shell command which writes the password on its standard output
+	Command string
+	// EnvVar is an environment variable which contains the password
+	EnvVar string
+	// Prompt is the message displayed to ask the password
+	Prompt string
+}
+
+// Read retrieve the password
+func (source *PasswordSource) Read() (string, error) {
+	switch {
+	case len(source.File) > 0:
+		glog.V(2).Infof("Read password from file: %s", source.File)
+		data, err := ioutil.ReadFile(source.File)
+		if err != nil {
+			return "", err
+		}
+		return trimNewline(string(data)), nil
+
+	case source.Stdin:
+		glog.V(2).Info("Read password from standard input")
+		return readLine(os.Stdin)
+
+	case len(source.Command) > 0:
+		glog.V(2).Infof("Read password from command: %s", source.Command)
+		return runPasswordCommand(source.Command)
+	}
+	if len(source.EnvVar) > 0 {
+		if password, ok := os.LookupEnv(source.EnvVar); ok {
+			glog.V(2).Infof("Read password from environment: %s", source.EnvVar)
+			return password, nil
+		}
+	}
+	password, err := ReadPassword(source.Prompt)
+	if err == ErrNoTerminal {
+		return "", fmt.Errorf("%s: use a password file, the standard input, a password command or an environment variable", err)
+	}
+	return password, err
+}
+
+func readLine(reader io.Reader) (string, error) {
+	line, err := bufio.NewReader(reader).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	if err == io.EOF && len(line) == 0 {
+		return "", fmt.Errorf("No password on standard input")
+	}
+	return trimNewline(line), nil
+}
+
+func runPasswordCommand(command string) (string, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	} else {
+		cmd = exec.Command("sh", "-c", command)
+	}
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("Password command failed: %s", err)
+	}
+	output := stdout.String()
+	if i := strings.IndexAny(output, "\r\n"); i >= 0 {
+		output = output[:i]
+	}
+	return output, nil
+}
+
+func trimNewline(text string) string {
+	return strings.TrimRight(text, "\r\n")
+}
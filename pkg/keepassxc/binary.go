@@ -0,0 +1,98 @@
+// Copyright (C) 2018 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package keepassxc
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/tobischo/gokeepasslib"
+
+	pkgalan "github.com/nlamirault/alan/pkg/alan"
+)
+
+// loadAttachments retrieve the content of the binaries referenced by an entry
+func loadAttachments(entry gokeepasslib.Entry, binaries gokeepasslib.Binaries) ([]pkgalan.Attachment, error) {
+	attachments := []pkgalan.Attachment{}
+	for _, reference := range entry.Binaries {
+		binary := reference.Find(binaries)
+		if binary == nil {
+			return nil, fmt.Errorf("Missing binary %d for attachment %s", reference.Value.ID, reference.Name)
+		}
+		content, err := binaryContent(binary)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid binary for attachment %s: %s", reference.Name, err)
+		}
+		attachments = append(attachments, pkgalan.Attachment{
+			Name:    reference.Name,
+			Content: content,
+		})
+	}
+	return attachments, nil
+}
+
+// addAttachments stores the attachments into the binaries and references them into the entry
+func addAttachments(entry *gokeepasslib.Entry, attachments []pkgalan.Attachment, binaries *gokeepasslib.Binaries) error {
+	for _, attachment := range attachments {
+		binary, err := mkBinary(*binaries, attachment.Content)
+		if err != nil {
+			return err
+		}
+		*binaries = append(*binaries, binary)
+		entry.Binaries = append(entry.Binaries, binary.CreateReference(attachment.Name))
+	}
+	return nil
+}
+
+// binaryContent decodes a binary.
+// gokeepasslib.Binary.GetContent doesn't handle the base64 padding of compressed binaries.
+func binaryContent(binary *gokeepasslib.Binary) ([]byte, error) {
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(binary.Content)))
+	if err != nil {
+		return nil, err
+	}
+	if !binary.Compressed {
+		return decoded, nil
+	}
+	reader, err := gzip.NewReader(bytes.NewReader(decoded))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return ioutil.ReadAll(reader)
+}
+
+// mkBinary creates a compressed binary with the next identifier.
+// gokeepasslib.Binary.SetContent doesn't flush the base64 encoder of compressed binaries.
+func mkBinary(binaries gokeepasslib.Binaries, content []byte) (gokeepasslib.Binary, error) {
+	binary := gokeepasslib.Binary{Compressed: true}
+	if len(binaries) > 0 {
+		binary.ID = binaries[len(binaries)-1].ID + 1
+	}
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	if _, err := writer.Write(content); err != nil {
+		return binary, err
+	}
+	if err := writer.Close(); err != nil {
+		return binary, err
+	}
+	binary.Content = []byte(base64.StdEncoding.EncodeToString(buf.Bytes()))
+	return binary, nil
+}
@@ -16,6 +16,7 @@ package keepassxc
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"strings"
 
@@ -23,22 +24,26 @@ import (
 	"github.com/tobischo/gokeepasslib"
 
 	pkgalan "github.com/nlamirault/alan/pkg/alan"
-	pkgcmd "github.com/nlamirault/alan/pkg/cmd"
 )
 
 // Client define a client to manage KeepassXC database
 type Client struct {
-	filename string
-	db       *gokeepasslib.Database
+	filename    string
+	credentials *Credentials
+	backups     int
+	db          *gokeepasslib.Database
 }
 
 // NewClient create a new KeepassXC database client
-func NewClient(filename string) (*Client, error) {
+func NewClient(filename string, credentials *Credentials) (*Client, error) {
 	return &Client{
-		filename: filename,
+		filename:    filename,
+		credentials: credentials,
+		backups:     pkgalan.DefaultBackups,
 	}, nil
 }
 
+// Open decodes the database and unlocks its entries
 func (client *Client) Open() error {
 	glog.V(2).Infof("Open database from file: %s", client.filename)
 	if _, err := os.Stat(client.filename); os.IsNotExist(err) {
@@ -48,13 +53,14 @@ func (client *Client) Open() error {
 	if err != nil {
 		return err
 	}
+	defer file.Close()
 	client.db = gokeepasslib.NewDatabase()
 
-	password, err := pkgcmd.ReadPassword("Please input your password: ")
+	credentials, err := client.credentials.dbCredentials()
 	if err != nil {
 		return err
 	}
-	client.db.Credentials = gokeepasslib.NewPasswordCredentials(password)
+	client.db.Credentials = credentials
 	if err := gokeepasslib.NewDecoder(file).Decode(client.db); err != nil {
 		return err
 	}
@@ -65,17 +71,22 @@ func (client *Client) Open() error {
 	return client.db.UnlockProtectedEntries()
 }
 
+// Save encodes the database into its file.
+// The file is replaced atomically, after a backup of the previous one.
+// The protected values are locked while encoding, gokeepasslib doesn't do it.
 func (client *Client) Save() error {
 	glog.V(2).Infof("Output file for database: %s", client.filename)
 
-	file, err := os.Create(client.filename)
-	if err != nil {
+	if err := client.db.LockProtectedEntries(); err != nil {
 		return err
 	}
-	defer file.Close()
-
-	keepassEncoder := gokeepasslib.NewEncoder(file)
-	if err := keepassEncoder.Encode(client.db); err != nil {
+	err := pkgalan.WriteFile(client.filename, client.backups, func(w io.Writer) error {
+		return gokeepasslib.NewEncoder(w).Encode(client.db)
+	})
+	if unlockErr := client.db.UnlockProtectedEntries(); err == nil {
+		err = unlockErr
+	}
+	if err != nil {
 		return err
 	}
 
@@ -83,74 +94,97 @@ func (client *Client) Save() error {
 	return nil
 }
 
+// SetBackups defines the number of backup copies kept when the database is saved
+func (client *Client) SetBackups(backups int) {
+	client.backups = backups
+}
+
+// Close locks the protected values of the database. The database must be
+// opened again to be used.
 func (client *Client) Close() error {
+	if client.db == nil {
+		return nil
+	}
 	glog.V(2).Infof("Close KeepassXC database: %s", client.filename)
-	return client.db.LockProtectedEntries()
+	err := client.db.LockProtectedEntries()
+	client.db = nil
+	return err
 }
 
-func (client *Client) Load() (map[string][]pkgalan.Secret, error) {
-	secrets := map[string][]pkgalan.Secret{}
+// Load returns the tree of groups of the database.
+// The database root group is the returned group, with an empty path. The recycle bin is skipped.
+func (client *Client) Load() (*pkgalan.Group, error) {
 	root := client.db.Content.Root
-	if len(root.Groups) == 0 {
-		return secrets, nil
+	tree := pkgalan.NewGroup("", "")
+	if len(root.Groups) == 1 {
+		tree.Name = root.Groups[0].Name
+		if err := client.loadGroup(tree, root.Groups[0]); err != nil {
+			return nil, err
+		}
+		return tree, nil
 	}
 	for _, group := range root.Groups {
-		groupSecrets, err := client.manageGroupEntries(group)
-		if err != nil {
+		if client.isRecycleBin(&group) {
+			continue
+		}
+		subgroup := pkgalan.NewGroup(tree.Path, group.Name)
+		if err := client.loadGroup(subgroup, group); err != nil {
 			return nil, err
 		}
-		secrets[group.Name] = groupSecrets
-		for _, subgroup := range group.Groups {
-			glog.V(2).Infof("Manage group: %s", subgroup.Name)
-			subgroupSecrets, err := client.manageGroupEntries(subgroup)
-			if err != nil {
-				return nil, err
-			}
-			secrets[subgroup.Name] = subgroupSecrets
+		tree.Groups = append(tree.Groups, subgroup)
+	}
+	return tree, nil
+}
+
+func (client *Client) loadGroup(tree *pkgalan.Group, group gokeepasslib.Group) error {
+	glog.V(2).Infof("Manage group: %s", tree.Path)
+	secrets, err := client.manageGroupEntries(group)
+	if err != nil {
+		return err
+	}
+	tree.Secrets = secrets
+	for _, child := range group.Groups {
+		if client.isRecycleBin(&child) {
+			continue
+		}
+		subgroup := pkgalan.NewGroup(tree.Path, child.Name)
+		if err := client.loadGroup(subgroup, child); err != nil {
+			return err
 		}
+		tree.Groups = append(tree.Groups, subgroup)
 	}
-	return secrets, nil
+	return nil
 }
 
-func (client *Client) Create(secrets map[string][]*pkgalan.Secret) error {
+// Create creates a new database from the groups tree.
+// The tree is the root group of the database.
+func (client *Client) Create(tree *pkgalan.Group) error {
 	glog.V(2).Infof("Add secrets to database")
 
-	rootGroup := gokeepasslib.NewGroup()
-	rootGroup.Name = "Root"
-	// rootGroup.EnableSearching = "true"
-	// rootGroup.EnableAutoType = "true"
-	for groupName, groupSecrets := range secrets {
-		glog.V(2).Infof("Add group secrets: %s %s", groupName, groupSecrets)
-		subGroup := gokeepasslib.NewGroup()
-		subGroup.Name = strings.Replace(groupName, "/", "", -1)
-		// subGroup.EnableSearching = "true"
-		// subGroup.EnableAutoType = "true"
-		for _, secret := range groupSecrets {
-			entry := gokeepasslib.NewEntry()
-			entry.Values = append(entry.Values, mkValue(pkgalan.Title, secret.Title))
-			entry.Values = append(entry.Values, mkValue(pkgalan.Username, secret.Username))
-			entry.Values = append(entry.Values, mkValue(pkgalan.URL, secret.URL))
-			entry.Values = append(entry.Values, mkProtectedValue(pkgalan.Password, secret.Password))
-			subGroup.Entries = append(subGroup.Entries, entry)
-		}
-		rootGroup.Groups = append(rootGroup.Groups, subGroup)
+	meta := gokeepasslib.NewMetaData()
+	rootGroup, err := mkGroup(tree, &meta.Binaries)
+	if err != nil {
+		return err
+	}
+	if len(tree.Name) == 0 {
+		rootGroup.Name = "Root"
 	}
 
 	glog.V(2).Info("Create a new database")
-	password, err := pkgcmd.ReadPassword("Please input your password: ")
+	credentials, err := client.credentials.dbCredentials()
 	if err != nil {
 		return err
 	}
 
-	meta := gokeepasslib.NewMetaData()
 	meta.Generator = pkgalan.Generator
 	meta.HistoryMaxItems = 10
+	meta.RecycleBinEnabled = true
 	// meta.MaintenanceHistoryDays = "365"
 	// meta.HistoryMaxSize = 6291456
 	client.db = &gokeepasslib.Database{
 		Signature:   &gokeepasslib.DefaultSig,
 		Headers:     gokeepasslib.NewFileHeaders(),
-		Credentials: gokeepasslib.NewPasswordCredentials(password),
+		Credentials: credentials,
 		Content: &gokeepasslib.DBContent{
 			Meta: meta,
 			Root: &gokeepasslib.RootData{
@@ -168,18 +202,103 @@ func (client *Client) manageGroupEntries(group gokeepasslib.Group) ([]pkgalan.Se
 			glog.Infof("Skipping entry: %s", entry.GetContent(pkgalan.URL))
 		} else {
 			glog.V(1).Infof("Add entry: %s %s", entry.GetTitle(), entry.GetContent(pkgalan.URL))
-			secret := pkgalan.Secret{
-				Title:    entry.GetTitle(),
-				Username: entry.GetContent(pkgalan.Username),
-				Password: entry.GetContent(pkgalan.Password),
-				URL:      entry.GetContent(pkgalan.URL),
+			secret, err := client.entrySecret(entry)
+			if err != nil {
+				return nil, err
 			}
-			secrets = append(secrets, secret)
+			secrets = append(secrets, *secret)
 		}
 	}
 	return secrets, nil
 }
 
+func mkGroup(group *pkgalan.Group, binaries *gokeepasslib.Binaries) (gokeepasslib.Group, error) {
+	glog.V(2).Infof("Add group secrets: %s", group.Path)
+	keepassGroup := gokeepasslib.NewGroup()
+	keepassGroup.Name = group.Name
+	for _, secret := range group.Secrets {
+		entry := gokeepasslib.NewEntry()
+		if len(secret.UUID) > 0 {
+			if err := entry.UUID.UnmarshalText([]byte(secret.UUID)); err != nil {
+				return keepassGroup, fmt.Errorf("Invalid UUID for %s: %s", secret.Title, err)
+			}
+		}
+		entry.Values = mkValues(secret)
+		entry.Tags = strings.Join(secret.Tags, pkgalan.TagSeparator)
+		if err := addAttachments(&entry, secret.Attachments, binaries); err != nil {
+			return keepassGroup, err
+		}
+		keepassGroup.Entries = append(keepassGroup.Entries, entry)
+	}
+	for _, subgroup := range group.Groups {
+		keepassSubgroup, err := mkGroup(subgroup, binaries)
+		if err != nil {
+			return keepassGroup, err
+		}
+		keepassGroup.Groups = append(keepassGroup.Groups, keepassSubgroup)
+	}
+	return keepassGroup, nil
+}
+
+func toSecret(entry gokeepasslib.Entry) pkgalan.Secret {
+	uuid, _ := entry.UUID.MarshalText()
+	secret := pkgalan.Secret{
+		UUID:     string(uuid),
+		Title:    entry.GetTitle(),
+		Username: entry.GetContent(pkgalan.Username),
+		Password: entry.GetContent(pkgalan.Password),
+		URL:      entry.GetContent(pkgalan.URL),
+		Notes:    entry.GetContent(pkgalan.Notes),
+		Tags:     splitTags(entry.Tags),
+	}
+	if entry.Times.LastModificationTime != nil {
+		secret.Modified = *entry.Times.LastModificationTime
+	}
+	for _, value := range entry.Values {
+		if pkgalan.IsStandardField(value.Key) {
+			continue
+		}
+		secret.Fields = append(secret.Fields, pkgalan.Field{
+			Name:      value.Key,
+			Value:     value.Value.Content,
+			Protected: bool(value.Value.Protected),
+		})
+	}
+	return secret
+}
+
+// splitTags splits the tags of an entry, KeepassXC separates them with
+// semicolons and older databases with commas.
+func splitTags(tags string) []string {
+	var result []string
+	for _, tag := range strings.FieldsFunc(tags, func(r rune) bool { return r == ';' || r == ',' }) {
+		if tag = strings.TrimSpace(tag); len(tag) > 0 {
+			result = append(result, tag)
+		}
+	}
+	return result
+}
+
+func mkValues(secret pkgalan.Secret) []gokeepasslib.ValueData {
+	values := []gokeepasslib.ValueData{
+		mkValue(pkgalan.Title, secret.Title),
+		mkValue(pkgalan.Username, secret.Username),
+		mkValue(pkgalan.URL, secret.URL),
+		mkProtectedValue(pkgalan.Password, secret.Password),
+	}
+	if len(secret.Notes) > 0 {
+		values = append(values, mkValue(pkgalan.Notes, secret.Notes))
+	}
+	for _, field := range secret.Fields {
+		if field.Protected {
+			values = append(values, mkProtectedValue(field.Name, field.Value))
+		} else {
+			values = append(values, mkValue(field.Name, field.Value))
+		}
+	}
+	return values
+}
+
 func mkValue(key string, value string) gokeepasslib.ValueData {
 	return gokeepasslib.ValueData{Key: key, Value: gokeepasslib.V{Content: value}}
 }
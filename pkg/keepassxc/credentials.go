@@ -0,0 +1,105 @@
+// Copyright (C) 2018 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package keepassxc
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/tobischo/gokeepasslib"
+)
+
+// Credentials define the composite key used to unlock a database
+type Credentials struct {
+	// Password returns the master password. Without it, only the key file is used.
+	// It is called once, the hashed password is kept for the next uses.
+	Password func() (string, error)
+	// KeyFile is the key file, if any
+	KeyFile string
+
+	passphrase []byte
+}
+
+// dbCredentials builds the database credentials from the password and the key file
+func (credentials *Credentials) dbCredentials() (*gokeepasslib.DBCredentials, error) {
+	if credentials == nil || (credentials.Password == nil && len(credentials.KeyFile) == 0) {
+		return nil, fmt.Errorf("No password nor key file to unlock the database")
+	}
+	dbCredentials := &gokeepasslib.DBCredentials{}
+	if credentials.Password != nil {
+		if credentials.passphrase == nil {
+			password, err := credentials.Password()
+			if err != nil {
+				return nil, err
+			}
+			hashed := sha256.Sum256([]byte(password))
+			credentials.passphrase = hashed[:]
+		}
+		dbCredentials.Passphrase = credentials.passphrase
+	}
+	if len(credentials.KeyFile) > 0 {
+		glog.V(2).Infof("Use key file: %s", credentials.KeyFile)
+		key, err := parseKeyFile(credentials.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid key file %s: %s", credentials.KeyFile, err)
+		}
+		dbCredentials.Key = key
+	}
+	return dbCredentials, nil
+}
+
+type xmlKeyFile struct {
+	Meta struct {
+		Version string `xml:"Version"`
+	} `xml:"Meta"`
+	Key struct {
+		Data string `xml:"Data"`
+	} `xml:"Key"`
+}
+
+// parseKeyFile returns the key of a key file, as KeePass does:
+// XML key files (version 1.0 and 2.0), 32 bytes binary files,
+// 64 hexadecimal characters files, or the SHA-256 of any other file.
+// gokeepasslib.ParseKeyFile only handles a subset of these formats.
+func parseKeyFile(filename string) ([]byte, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var keyFile xmlKeyFile
+	if err := xml.Unmarshal(data, &keyFile); err == nil && len(keyFile.Key.Data) > 0 {
+		content := strings.Join(strings.Fields(keyFile.Key.Data), "")
+		if strings.HasPrefix(keyFile.Meta.Version, "2.") {
+			return hex.DecodeString(content)
+		}
+		return base64.StdEncoding.DecodeString(content)
+	}
+	switch len(data) {
+	case 32:
+		return data, nil
+	case 64:
+		if key, err := hex.DecodeString(string(data)); err == nil {
+			return key, nil
+		}
+	}
+	hashed := sha256.Sum256(data)
+	return hashed[:], nil
+}
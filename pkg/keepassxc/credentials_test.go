@@ -0,0 +1,100 @@
+// Copyright (C) 2018 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package keepassxc
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_OpenWithPassword(t *testing.T) {
+	calls := 0
+	client, err := NewClient("../../alan.kdbx", &Credentials{
+		Password: func() (string, error) {
+			calls++
+			return "turing", nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := client.Open(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := client.Load(); err != nil {
+			t.Fatal(err)
+		}
+		if err := client.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if calls != 1 {
+		t.Fatalf("Password read %d times", calls)
+	}
+
+	client, _ = NewClient("../../alan.kdbx", nil)
+	if err := client.Open(); err == nil {
+		t.Fatal("Expected an error without credentials")
+	}
+}
+
+func Test_ParseKeyFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "alan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	key := bytes.Repeat([]byte{0xab}, 32)
+	other := []byte("some random content")
+	hashed := sha256.Sum256(other)
+	files := map[string]struct {
+		content  string
+		expected []byte
+	}{
+		"v1.keyx": {
+			`<?xml version="1.0" encoding="utf-8"?><KeyFile><Meta><Version>1.00</Version></Meta><Key><Data>q6urq6urq6urq6urq6urq6urq6urq6urq6urq6urq6s=</Data></Key></KeyFile>`,
+			key,
+		},
+		"v2.keyx": {
+			`<?xml version="1.0" encoding="utf-8"?><KeyFile><Meta><Version>2.0</Version></Meta><Key><Data Hash="00000000">
+				ABABABAB ABABABAB ABABABAB ABABABAB
+				ABABABAB ABABABAB ABABABAB ABABABAB
+			</Data></Key></KeyFile>`,
+			key,
+		},
+		"binary.key": {string(key), key},
+		"hex.key":    {"abababababababababababababababababababababababababababababababab", key},
+		"other.key":  {string(other), hashed[:]},
+	}
+	for name, file := range files {
+		filename := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(filename, []byte(file.content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		result, err := parseKeyFile(filename)
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		if !bytes.Equal(result, file.expected) {
+			t.Fatalf("%s: invalid key %x", name, result)
+		}
+	}
+}
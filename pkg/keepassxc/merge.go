@@ -0,0 +1,210 @@
+// Copyright (C) 2018 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package keepassxc
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/tobischo/gokeepasslib"
+
+	pkgalan "github.com/nlamirault/alan/pkg/alan"
+)
+
+// withRoot calls fn with the root group of the database.
+// Several root groups are handled as the subgroups of an unnamed root, as Load does.
+func (client *Client) withRoot(fn func(rootGroup *gokeepasslib.Group) error) error {
+	if client.db == nil {
+		return fmt.Errorf("Database not opened")
+	}
+	root := client.db.Content.Root
+	if len(root.Groups) == 0 {
+		group := gokeepasslib.NewGroup()
+		group.Name = "Root"
+		root.Groups = []gokeepasslib.Group{group}
+	}
+	if len(root.Groups) == 1 {
+		return fn(&root.Groups[0])
+	}
+	rootGroup := gokeepasslib.Group{Groups: root.Groups}
+	err := fn(&rootGroup)
+	root.Groups = rootGroup.Groups
+	if err == nil && len(rootGroup.Entries) > 0 {
+		return fmt.Errorf("Can't add root entries into a database with several root groups")
+	}
+	return err
+}
+
+// findGroup returns the group with the given names under the root group, or nil
+func findGroup(group *gokeepasslib.Group, names []string) *gokeepasslib.Group {
+	for _, name := range names {
+		var found *gokeepasslib.Group
+		for i := range group.Groups {
+			if group.Groups[i].Name == name {
+				found = &group.Groups[i]
+				break
+			}
+		}
+		if found == nil {
+			return nil
+		}
+		group = found
+	}
+	return group
+}
+
+// mergeGroup returns the group with the given names under the root group, creating the missing ones
+func mergeGroup(group *gokeepasslib.Group, names []string) *gokeepasslib.Group {
+	for i, name := range names {
+		subgroup := findGroup(group, names[i:i+1])
+		if subgroup == nil {
+			glog.V(1).Infof("Add group: %s", name)
+			newGroup := gokeepasslib.NewGroup()
+			newGroup.Name = name
+			group.Groups = append(group.Groups, newGroup)
+			subgroup = &group.Groups[len(group.Groups)-1]
+		}
+		group = subgroup
+	}
+	return group
+}
+
+// findEntry returns the entry with the given path, or nil.
+// The returned group contains the entry.
+func findEntry(rootGroup *gokeepasslib.Group, path string) (*gokeepasslib.Group, int) {
+	names := pkgalan.SplitPath(path)
+	if len(names) == 0 {
+		return nil, -1
+	}
+	group := findGroup(rootGroup, names[:len(names)-1])
+	if group == nil {
+		return nil, -1
+	}
+	for i := range group.Entries {
+		if group.Entries[i].GetTitle() == names[len(names)-1] {
+			return group, i
+		}
+	}
+	return nil, -1
+}
+
+// findEntryByUUID returns the group containing the entry with the given UUID, or nil
+func findEntryByUUID(group *gokeepasslib.Group, uuid gokeepasslib.UUID) (*gokeepasslib.Group, int) {
+	for i := range group.Entries {
+		if group.Entries[i].UUID.Compare(uuid) {
+			return group, i
+		}
+	}
+	for i := range group.Groups {
+		if found, index := findEntryByUUID(&group.Groups[i], uuid); found != nil {
+			return found, index
+		}
+	}
+	return nil, -1
+}
+
+// mergeEntry updates the entry of the secret or adds it. The entry is
+// matched by UUID, then by path, and moved into the group of the path if
+// needed. It returns true if the database changed.
+func (client *Client) mergeEntry(rootGroup *gokeepasslib.Group, path string, secret pkgalan.Secret) (bool, error) {
+	names := pkgalan.SplitPath(path)
+	if len(names) == 0 {
+		return false, fmt.Errorf("Invalid path: %s", path)
+	}
+	group, index := findEntry(rootGroup, path)
+	if len(secret.UUID) > 0 {
+		var uuid gokeepasslib.UUID
+		if err := uuid.UnmarshalText([]byte(secret.UUID)); err != nil {
+			return false, fmt.Errorf("Invalid UUID for %s: %s", secret.Title, err)
+		}
+		if found, i := findEntryByUUID(rootGroup, uuid); found != nil {
+			group, index = found, i
+		}
+	}
+	if group != nil {
+		glog.V(1).Infof("Update entry: %s", path)
+		modified, err := client.updateEntry(&group.Entries[index], secret)
+		if err != nil || group == findGroup(rootGroup, names[:len(names)-1]) {
+			return modified, err
+		}
+		glog.V(1).Infof("Move entry: %s", path)
+		entry := group.Entries[index]
+		group.Entries = append(group.Entries[:index], group.Entries[index+1:]...)
+		group = mergeGroup(rootGroup, names[:len(names)-1])
+		group.Entries = append(group.Entries, entry)
+		return true, nil
+	}
+
+	glog.V(1).Infof("Add entry: %s", path)
+	entry := gokeepasslib.NewEntry()
+	if len(secret.UUID) > 0 {
+		if err := entry.UUID.UnmarshalText([]byte(secret.UUID)); err != nil {
+			return false, fmt.Errorf("Invalid UUID for %s: %s", secret.Title, err)
+		}
+	}
+	entry.Values = mkValues(secret)
+	if err := addAttachments(&entry, secret.Attachments, &client.db.Content.Meta.Binaries); err != nil {
+		return false, err
+	}
+	group = mergeGroup(rootGroup, names[:len(names)-1])
+	group.Entries = append(group.Entries, entry)
+	return true, nil
+}
+
+// updateEntry replaces the content of the entry if it differs from the secret.
+// The previous version is pushed into the entry history.
+func (client *Client) updateEntry(entry *gokeepasslib.Entry, secret pkgalan.Secret) (bool, error) {
+	current, err := client.entrySecret(*entry)
+	if err != nil {
+		return false, err
+	}
+	if current.Equal(&secret) {
+		return false, nil
+	}
+
+	previous := *entry
+	previous.Histories = nil
+	if len(entry.Histories) == 0 {
+		entry.Histories = []gokeepasslib.History{{}}
+	}
+	history := append(entry.Histories[0].Entries, previous)
+	if max := int(client.db.Content.Meta.HistoryMaxItems); max >= 0 && len(history) > max {
+		history = history[len(history)-max:]
+	}
+	entry.Histories[0].Entries = history
+
+	entry.Values = mkValues(secret)
+	entry.Tags = strings.Join(secret.Tags, pkgalan.TagSeparator)
+	entry.Binaries = nil
+	if err := addAttachments(entry, secret.Attachments, &client.db.Content.Meta.Binaries); err != nil {
+		return false, err
+	}
+	now := time.Now()
+	entry.Times.LastModificationTime = &now
+	return true, nil
+}
+
+// entrySecret returns the secret of an entry, with its attachments
+func (client *Client) entrySecret(entry gokeepasslib.Entry) (*pkgalan.Secret, error) {
+	secret := toSecret(entry)
+	attachments, err := loadAttachments(entry, client.db.Content.Meta.Binaries)
+	if err != nil {
+		return nil, err
+	}
+	secret.Attachments = attachments
+	return &secret, nil
+}
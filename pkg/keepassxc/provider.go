@@ -0,0 +1,141 @@
+// Copyright (C) 2018 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package keepassxc
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/golang/glog"
+	"github.com/tobischo/gokeepasslib"
+
+	pkgalan "github.com/nlamirault/alan/pkg/alan"
+)
+
+// Provider exposes a KeepassXC database as a password manager storage.
+// Written entries are matched by UUID, then by path. Updated entries keep
+// their previous version into their history.
+type Provider struct {
+	client    *Client
+	overwrite bool
+	modified  bool
+}
+
+// NewProvider creates a provider for the database of the client.
+// Using overwrite, an existing database is replaced by a new one.
+func NewProvider(client *Client, overwrite bool) *Provider {
+	return &Provider{
+		client:    client,
+		overwrite: overwrite,
+	}
+}
+
+// Open decodes the database, or creates a new one if it doesn't exist
+func (provider *Provider) Open() error {
+	if _, err := os.Stat(provider.client.filename); err == nil && !provider.overwrite {
+		return provider.client.Open()
+	}
+	glog.V(1).Infof("Create database: %s", provider.client.filename)
+	provider.modified = true
+	return provider.client.Create(&pkgalan.Group{})
+}
+
+// Load returns the tree of groups of the database
+func (provider *Provider) Load() (*pkgalan.Group, error) {
+	return provider.client.Load()
+}
+
+// Read returns the secret of an entry, or nil if it doesn't exist
+func (provider *Provider) Read(path string) (*pkgalan.Secret, error) {
+	var secret *pkgalan.Secret
+	err := provider.client.withRoot(func(rootGroup *gokeepasslib.Group) error {
+		group, index := findEntry(rootGroup, path)
+		if group == nil {
+			return nil
+		}
+		var err error
+		secret, err = provider.client.entrySecret(group.Entries[index])
+		return err
+	})
+	return secret, err
+}
+
+// Write creates or updates an entry
+func (provider *Provider) Write(path string, secret pkgalan.Secret) error {
+	return provider.client.withRoot(func(rootGroup *gokeepasslib.Group) error {
+		modified, err := provider.client.mergeEntry(rootGroup, path, secret)
+		provider.modified = provider.modified || modified
+		return err
+	})
+}
+
+// Delete removes an entry
+func (provider *Provider) Delete(path string) error {
+	return provider.client.withRoot(func(rootGroup *gokeepasslib.Group) error {
+		group, index := findEntry(rootGroup, path)
+		if group == nil {
+			return fmt.Errorf("No entry for path %s", path)
+		}
+		glog.V(1).Infof("Delete entry: %s", path)
+		group.Entries = append(group.Entries[:index], group.Entries[index+1:]...)
+		provider.modified = true
+		return nil
+	})
+}
+
+// Recycled returns the entries of the recycle bin
+func (provider *Provider) Recycled() []pkgalan.RecycledSecret {
+	return provider.client.Recycled()
+}
+
+// Recycle moves an entry into the recycle bin, or deletes it if the recycle bin is disabled
+func (provider *Provider) Recycle(path string) error {
+	if !bool(provider.client.db.Content.Meta.RecycleBinEnabled) {
+		return provider.Delete(path)
+	}
+	if err := provider.client.recycleEntry(path); err != nil {
+		return err
+	}
+	provider.modified = true
+	return nil
+}
+
+// CreateGroup creates a group and its parents
+func (provider *Provider) CreateGroup(path string) error {
+	return provider.client.withRoot(func(rootGroup *gokeepasslib.Group) error {
+		names := pkgalan.SplitPath(path)
+		if findGroup(rootGroup, names) == nil {
+			mergeGroup(rootGroup, names)
+			provider.modified = true
+		}
+		return nil
+	})
+}
+
+// Discard drops the changes not saved yet
+func (provider *Provider) Discard() {
+	provider.modified = false
+}
+
+// Close saves the database if it was modified
+func (provider *Provider) Close() error {
+	if provider.modified {
+		if err := provider.client.Save(); err != nil {
+			return err
+		}
+		provider.modified = false
+	}
+	return provider.client.Close()
+}
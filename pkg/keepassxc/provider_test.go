@@ -0,0 +1,206 @@
+// Copyright (C) 2018 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package keepassxc
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/tobischo/gokeepasslib"
+
+	pkgalan "github.com/nlamirault/alan/pkg/alan"
+)
+
+func Test_ProviderMerge(t *testing.T) {
+	dir, err := ioutil.TempDir("", "alan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	credentials := &Credentials{Password: func() (string, error) { return "turing", nil }}
+	db := newTestDatabase()
+	db.Credentials = gokeepasslib.NewPasswordCredentials("turing")
+	db.Content.Meta.HistoryMaxItems = 10
+	nas := db.Content.Root.Groups[0].Groups[1].Groups[0].Entries[0]
+	uuid, _ := nas.UUID.MarshalText()
+
+	client := &Client{filename: filepath.Join(dir, "alan.kdbx"), credentials: credentials, db: db}
+	provider := NewProvider(client, false)
+	writes := map[string]pkgalan.Secret{
+		"Work/Infra/Servers/db01": {Title: "db01", Username: "alan", Password: "enigma"},
+		"Work/Infra/Servers/db03": {Title: "db03", Username: "alan", Password: "bombe"},
+		"Home/nas01":              {UUID: string(uuid), Title: "nas01", Password: "turing"},
+	}
+	for path, secret := range writes {
+		if err := provider.Write(path, secret); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := provider.Delete("A%2FB/C"); err != nil {
+		t.Fatal(err)
+	}
+	if err := provider.CreateGroup("New/Empty"); err != nil {
+		t.Fatal(err)
+	}
+	if err := provider.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	client, _ = NewClient(client.filename, credentials)
+	provider = NewProvider(client, false)
+	if err := provider.Open(); err != nil {
+		t.Fatal(err)
+	}
+	root := client.db.Content.Root.Groups[0]
+	if len(root.Groups) != 6 || len(root.Entries) != 1 || len(root.Groups[3].Entries) != 0 {
+		t.Fatalf("Invalid groups: %#v", root)
+	}
+	entries := root.Groups[0].Groups[0].Groups[0].Entries
+	if len(entries) != 3 || entries[0].GetPassword() != "enigma" || entries[2].GetTitle() != "db03" {
+		t.Fatalf("Invalid merged entries: %#v", entries)
+	}
+	if len(entries[0].Histories) != 1 || entries[0].Histories[0].Entries[0].GetPassword() != "turing" {
+		t.Fatalf("Invalid history: %#v", entries[0].Histories)
+	}
+	if len(entries[1].Histories) != 0 {
+		t.Fatalf("Unchanged entry with history: %#v", entries[1].Histories)
+	}
+	// the entry matched by UUID is moved into the group of its path
+	if len(root.Groups[1].Groups[0].Entries) != 0 {
+		t.Fatalf("Entry not moved: %#v", root.Groups[1].Groups[0].Entries)
+	}
+	home := findGroup(&root, []string{"Home"})
+	if home == nil || len(home.Entries) != 1 {
+		t.Fatalf("Invalid moved entry: %#v", home)
+	}
+	nas = home.Entries[0]
+	if nas.GetTitle() != "nas01" || len(nas.Histories[0].Entries) != 1 {
+		t.Fatalf("Entry not matched by UUID: %#v", nas)
+	}
+	secret, err := provider.Read("Work/Infra/Servers/db03")
+	if err != nil || secret == nil || secret.Password != "bombe" {
+		t.Fatalf("Invalid secret: %#v %v", secret, err)
+	}
+	if secret, err := provider.Read("Work/db04"); err != nil || secret != nil {
+		t.Fatalf("Unexpected secret: %#v %v", secret, err)
+	}
+	if _, err := os.Stat(client.filename + ".bak.1"); !os.IsNotExist(err) {
+		t.Fatalf("Unexpected backup: %v", err)
+	}
+}
+
+func Test_ProviderMoveUnchanged(t *testing.T) {
+	db := newTestDatabase()
+	client := &Client{db: db}
+	provider := NewProvider(client, false)
+	secret, err := provider.Read("Perso/Servers/nas")
+	if err != nil || secret == nil {
+		t.Fatalf("Invalid secret: %#v %v", secret, err)
+	}
+	if err := provider.Write("Home/nas", *secret); err != nil {
+		t.Fatal(err)
+	}
+	if !provider.modified {
+		t.Fatal("Moved entry not saved")
+	}
+	if moved, err := provider.Read("Home/nas"); err != nil || moved == nil || moved.UUID != secret.UUID {
+		t.Fatalf("Entry not moved: %#v %v", moved, err)
+	}
+	if previous, err := provider.Read("Perso/Servers/nas"); err != nil || previous != nil {
+		t.Fatalf("Entry left in its previous group: %#v %v", previous, err)
+	}
+}
+
+func Test_ProviderBidirectionalMove(t *testing.T) {
+	db := newTestDatabase()
+	db.Content.Meta.RecycleBinEnabled = true
+	client := &Client{db: db}
+	provider := NewProvider(client, false)
+	tree, err := provider.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	nas, err := provider.Read("Perso/Servers/nas")
+	if err != nil || nas == nil {
+		t.Fatalf("Invalid secret: %#v %v", nas, err)
+	}
+	state := pkgalan.NewState("keepassxc", "other")
+	state.Record("Perso/Servers/nas", nas)
+
+	// the secret was moved on the other side
+	other := pkgalan.NewGroupTree()
+	home := other.Group([]string{"Home"})
+	home.Secrets = append(home.Secrets, *nas)
+	resolve, err := pkgalan.NewConflictResolver(pkgalan.ConflictNewest, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err := pkgalan.NewBidirectionalPlan(tree, other.Root, state, resolve, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := plan.Source.Apply(provider); err != nil {
+		t.Fatal(err)
+	}
+	if moved, err := provider.Read("Home/nas"); err != nil || moved == nil || moved.UUID != nas.UUID {
+		t.Fatalf("Secret not moved: %#v %v", moved, err)
+	}
+	if len(provider.Recycled()) != 0 {
+		t.Fatalf("Moved secret recycled: %v", provider.Recycled())
+	}
+}
+
+func Test_ProviderRecycle(t *testing.T) {
+	db := newTestDatabase()
+	db.Content.Meta.RecycleBinEnabled = true
+	client := &Client{db: db}
+	provider := NewProvider(client, false)
+	if err := provider.Write("Work/db04", pkgalan.Secret{Title: "db04"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := provider.Recycle("Work/Infra/Servers/db01"); err != nil {
+		t.Fatal(err)
+	}
+	if err := provider.Recycle("Work/db04"); err != nil {
+		t.Fatal(err)
+	}
+
+	tree, err := provider.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	groups, secrets := tree.Index()
+	if _, ok := groups[RecycleBinName]; ok {
+		t.Fatalf("Recycle bin loaded: %v", groups)
+	}
+	if _, ok := secrets["Work/Infra/Servers/db01"]; ok {
+		t.Fatalf("Recycled secret loaded: %v", secrets)
+	}
+	recycled := provider.Recycled()
+	if len(recycled) != 2 || recycled[0].Path != RecycleBinName+"/db01" || len(recycled[0].UUID) == 0 {
+		t.Fatalf("Invalid recycled secrets: %v", recycled)
+	}
+
+	db.Content.Meta.RecycleBinEnabled = false
+	if err := provider.Recycle("Work/Infra/Servers/db02"); err != nil {
+		t.Fatal(err)
+	}
+	if len(provider.Recycled()) != 0 {
+		t.Fatalf("Secret recycled into a disabled recycle bin")
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright (C) 2018 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package keepassxc
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/tobischo/gokeepasslib"
+
+	pkgalan "github.com/nlamirault/alan/pkg/alan"
+)
+
+// RecycleBinName is the name of the recycle bin group created by alan
+const RecycleBinName = "Recycle Bin"
+
+// isRecycleBin returns true if the group is the recycle bin of the database
+func (client *Client) isRecycleBin(group *gokeepasslib.Group) bool {
+	meta := client.db.Content.Meta
+	return bool(meta.RecycleBinEnabled) && meta.RecycleBinUUID != gokeepasslib.UUID{} &&
+		group.UUID.Compare(meta.RecycleBinUUID)
+}
+
+// findGroupByUUID returns the group with the given UUID, or nil
+func findGroupByUUID(group *gokeepasslib.Group, uuid gokeepasslib.UUID) *gokeepasslib.Group {
+	if group.UUID.Compare(uuid) {
+		return group
+	}
+	for i := range group.Groups {
+		if found := findGroupByUUID(&group.Groups[i], uuid); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// Recycled returns the entries of the recycle bin
+func (client *Client) Recycled() []pkgalan.RecycledSecret {
+	recycled := []pkgalan.RecycledSecret{}
+	meta := client.db.Content.Meta
+	if !bool(meta.RecycleBinEnabled) {
+		return recycled
+	}
+	var bin *gokeepasslib.Group
+	for i := range client.db.Content.Root.Groups {
+		if bin = findGroupByUUID(&client.db.Content.Root.Groups[i], meta.RecycleBinUUID); bin != nil {
+			break
+		}
+	}
+	if bin == nil {
+		return recycled
+	}
+	var walk func(path string, group *gokeepasslib.Group)
+	walk = func(path string, group *gokeepasslib.Group) {
+		for _, entry := range group.Entries {
+			uuid, _ := entry.UUID.MarshalText()
+			recycled = append(recycled, pkgalan.RecycledSecret{
+				Path: pkgalan.JoinPath(path, pkgalan.EscapeName(entry.GetTitle())),
+				UUID: string(uuid),
+			})
+		}
+		for i := range group.Groups {
+			walk(pkgalan.JoinPath(path, pkgalan.EscapeName(group.Groups[i].Name)), &group.Groups[i])
+		}
+	}
+	walk(pkgalan.EscapeName(bin.Name), bin)
+	return recycled
+}
+
+// recycleBin returns the recycle bin of the database, creating it under the root group if needed
+func (client *Client) recycleBin(rootGroup *gokeepasslib.Group) *gokeepasslib.Group {
+	meta := client.db.Content.Meta
+	if meta.RecycleBinUUID != (gokeepasslib.UUID{}) {
+		if bin := findGroupByUUID(rootGroup, meta.RecycleBinUUID); bin != nil {
+			return bin
+		}
+	}
+	glog.V(1).Infof("Add recycle bin")
+	bin := gokeepasslib.NewGroup()
+	bin.Name = RecycleBinName
+	rootGroup.Groups = append(rootGroup.Groups, bin)
+	now := time.Now()
+	meta.RecycleBinUUID = bin.UUID
+	meta.RecycleBinChanged = &now
+	return &rootGroup.Groups[len(rootGroup.Groups)-1]
+}
+
+// recycleEntry moves an entry into the recycle bin
+func (client *Client) recycleEntry(path string) error {
+	return client.withRoot(func(rootGroup *gokeepasslib.Group) error {
+		group, index := findEntry(rootGroup, path)
+		if group == nil {
+			return fmt.Errorf("No entry for path %s", path)
+		}
+		glog.V(1).Infof("Recycle entry: %s", path)
+		entry := group.Entries[index]
+		group.Entries = append(group.Entries[:index], group.Entries[index+1:]...)
+		now := time.Now()
+		entry.Times.LocationChanged = &now
+		bin := client.recycleBin(rootGroup)
+		bin.Entries = append(bin.Entries, entry)
+		return nil
+	})
+}
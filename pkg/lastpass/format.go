@@ -0,0 +1,173 @@
+// Copyright (C) 2018 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lastpass
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	// SecureNoteURL is the URL of the secure notes
+	SecureNoteURL = "http://sn"
+
+	// GroupURL is the URL of the entries which only define a folder
+	GroupURL = "http://group"
+
+	noteTypeKey = "NoteType"
+	notesKey    = "Notes"
+)
+
+// Columns are the columns of a LastPass CSV export, in order
+var Columns = []string{"url", "username", "password", "totp", "extra", "name", "grouping", "fav"}
+
+// Entry define a row of a LastPass CSV export
+type Entry struct {
+	URL      string
+	Username string
+	Password string
+	TOTP     string
+	Extra    string
+	Name     string
+	Grouping string
+	Fav      bool
+}
+
+// IsSecureNote returns true if the entry is a secure note
+func (entry *Entry) IsSecureNote() bool {
+	return entry.URL == SecureNoteURL
+}
+
+// IsGroup returns true if the entry only defines a folder
+func (entry *Entry) IsGroup() bool {
+	return entry.URL == GroupURL
+}
+
+// ReadCSV decodes the entries of a LastPass CSV export. The columns are
+// found by name, so older exports without totp are accepted.
+func ReadCSV(r io.Reader) ([]*Entry, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	header, err := reader.Read()
+	if err == io.EOF {
+		return []*Entry{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+	if _, ok := columns["name"]; !ok {
+		return nil, fmt.Errorf("Invalid LastPass CSV export: missing name column")
+	}
+	entries := []*Entry{}
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		value := func(column string) string {
+			if i, ok := columns[column]; ok && i < len(row) {
+				return row[i]
+			}
+			return ""
+		}
+		entries = append(entries, &Entry{
+			URL:      value("url"),
+			Username: value("username"),
+			Password: value("password"),
+			TOTP:     value("totp"),
+			Extra:    value("extra"),
+			Name:     value("name"),
+			Grouping: value("grouping"),
+			Fav:      value("fav") == "1",
+		})
+	}
+}
+
+// WriteCSV encodes the entries as a LastPass CSV export
+func WriteCSV(w io.Writer, entries []*Entry) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(Columns); err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		fav := "0"
+		if entry.Fav {
+			fav = "1"
+		}
+		row := []string{entry.URL, entry.Username, entry.Password, entry.TOTP,
+			entry.Extra, entry.Name, entry.Grouping, fav}
+		if err := writer.Write(row); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// NoteItem define a value of a structured secure note
+type NoteItem struct {
+	Name  string
+	Value string
+}
+
+// ParseNote splits the extra of a secure note of the form
+// "NoteType:<type>\n<name>:<value>\n...\nNotes:<text>". The lines without
+// a colon continue the previous value, and Notes is always the last one.
+// It returns an empty type for the plain secure notes.
+func ParseNote(extra string) (string, []NoteItem, string) {
+	if !strings.HasPrefix(extra, noteTypeKey+":") {
+		return "", nil, extra
+	}
+	noteType := ""
+	items := []NoteItem{}
+	lines := strings.Split(strings.Replace(extra, "\r\n", "\n", -1), "\n")
+	for i, line := range lines {
+		parts := strings.SplitN(line, ":", 2)
+		switch {
+		case len(parts) == 2 && parts[0] == notesKey:
+			return noteType, items, strings.Join(append([]string{parts[1]}, lines[i+1:]...), "\n")
+		case len(parts) == 2 && parts[0] == noteTypeKey:
+			noteType = parts[1]
+		case len(parts) == 2:
+			items = append(items, NoteItem{Name: parts[0], Value: parts[1]})
+		case len(items) > 0:
+			items[len(items)-1].Value += "\n" + line
+		}
+	}
+	return noteType, items, ""
+}
+
+// FormatNote is the reverse of ParseNote
+func FormatNote(noteType string, items []NoteItem, notes string) string {
+	if len(noteType) == 0 {
+		return notes
+	}
+	lines := []string{noteTypeKey + ":" + noteType}
+	for _, item := range items {
+		lines = append(lines, item.Name+":"+item.Value)
+	}
+	lines = append(lines, notesKey+":"+notes)
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,327 @@
+// Copyright (C) 2018 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lastpass
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/golang/glog"
+
+	pkgalan "github.com/nlamirault/alan/pkg/alan"
+)
+
+const (
+	// NoteTypeField is the name of the field of the type of a structured secure note
+	NoteTypeField = "NoteType"
+
+	// groupSeparator separates the levels of the grouping of an entry
+	groupSeparator = `\`
+)
+
+// protectedItems are the parts of the names of the protected values of the secure notes
+var protectedItems = []string{"password", "passphrase", "number", "security code", "private key"}
+
+// Provider exposes a LastPass CSV export as a password manager storage.
+// The groupings are the folders, and the secure notes keep their
+// structured values as custom fields. Attachments can't be exported.
+type Provider struct {
+	filename  string
+	overwrite bool
+	backups   int
+	entries   []*Entry
+	modified  bool
+}
+
+// NewProvider creates a provider for a CSV file.
+// Using overwrite, an existing file is replaced by a new one.
+func NewProvider(filename string, overwrite bool) *Provider {
+	return &Provider{
+		filename:  filename,
+		overwrite: overwrite,
+		backups:   pkgalan.DefaultBackups,
+	}
+}
+
+// SetBackups defines the number of backup copies kept when the file is saved
+func (provider *Provider) SetBackups(backups int) {
+	provider.backups = backups
+}
+
+// Open reads the CSV file, or starts a new one if it doesn't exist
+func (provider *Provider) Open() error {
+	glog.V(2).Infof("Open LastPass export: %s", provider.filename)
+	file, err := os.Open(provider.filename)
+	if os.IsNotExist(err) || (err == nil && provider.overwrite) {
+		if file != nil {
+			file.Close()
+		}
+		glog.V(1).Infof("Create LastPass export: %s", provider.filename)
+		provider.entries, provider.modified = []*Entry{}, true
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	entries, err := ReadCSV(file)
+	if err != nil {
+		return fmt.Errorf("Invalid LastPass export %s: %s", provider.filename, err)
+	}
+	provider.entries = entries
+	return nil
+}
+
+// Load returns the tree of folders of the export
+func (provider *Provider) Load() (*pkgalan.Group, error) {
+	tree := pkgalan.NewGroupTree()
+	for _, entry := range provider.entries {
+		group := tree.Group(splitGroup(entry.Grouping))
+		if entry.IsGroup() {
+			continue
+		}
+		if len(entry.Name) == 0 {
+			glog.Infof("Skipping entry: %s", entry.URL)
+			continue
+		}
+		group.Secrets = append(group.Secrets, toSecret(entry))
+	}
+	return tree.Root, nil
+}
+
+// Read returns the secret of an entry, or nil if it doesn't exist
+func (provider *Provider) Read(path string) (*pkgalan.Secret, error) {
+	index := provider.findEntry(path)
+	if index < 0 {
+		return nil, nil
+	}
+	secret := toSecret(provider.entries[index])
+	return &secret, nil
+}
+
+// Write creates or updates an entry
+func (provider *Provider) Write(path string, secret pkgalan.Secret) error {
+	names := pkgalan.SplitPath(path)
+	if len(names) == 0 {
+		return fmt.Errorf("Invalid path: %s", path)
+	}
+	entry := &Entry{}
+	if index := provider.findEntry(path); index >= 0 {
+		entry = provider.entries[index]
+	} else {
+		provider.entries = append(provider.entries, entry)
+	}
+	glog.V(1).Infof("Write entry: %s", path)
+	group := names[:len(names)-1]
+	updateEntry(entry, group, secret)
+	provider.removeGroupEntries(group)
+	provider.modified = true
+	return nil
+}
+
+// Delete removes an entry
+func (provider *Provider) Delete(path string) error {
+	index := provider.findEntry(path)
+	if index < 0 {
+		return fmt.Errorf("No entry for path %s", path)
+	}
+	glog.V(1).Infof("Delete entry: %s", path)
+	provider.entries = append(provider.entries[:index], provider.entries[index+1:]...)
+	provider.modified = true
+	return nil
+}
+
+// CreateGroup adds a folder entry for an empty group
+func (provider *Provider) CreateGroup(path string) error {
+	names := pkgalan.SplitPath(path)
+	if len(names) == 0 {
+		return nil
+	}
+	for _, entry := range provider.entries {
+		if isSubgroup(splitGroup(entry.Grouping), names) {
+			return nil
+		}
+	}
+	provider.entries = append(provider.entries, &Entry{URL: GroupURL, Grouping: joinGroup(names)})
+	provider.modified = true
+	return nil
+}
+
+// Discard drops the changes not saved yet
+func (provider *Provider) Discard() {
+	provider.modified = false
+}
+
+// Close saves the CSV file if it was modified
+func (provider *Provider) Close() error {
+	if !provider.modified {
+		return nil
+	}
+	glog.V(2).Infof("Output file for LastPass export: %s", provider.filename)
+	err := pkgalan.WriteFile(provider.filename, provider.backups, func(w io.Writer) error {
+		return WriteCSV(w, provider.entries)
+	})
+	if err != nil {
+		return err
+	}
+	provider.modified = false
+	return nil
+}
+
+// findEntry returns the index of the entry with the path, or -1
+func (provider *Provider) findEntry(path string) int {
+	for i, entry := range provider.entries {
+		if !entry.IsGroup() && entryPath(entry) == path {
+			return i
+		}
+	}
+	return -1
+}
+
+// removeGroupEntries removes the folder entries of the group and of its parents
+func (provider *Provider) removeGroupEntries(group []string) {
+	entries := []*Entry{}
+	for _, entry := range provider.entries {
+		if !entry.IsGroup() || !isSubgroup(group, splitGroup(entry.Grouping)) {
+			entries = append(entries, entry)
+		}
+	}
+	provider.entries = entries
+}
+
+func toSecret(entry *Entry) pkgalan.Secret {
+	secret := pkgalan.Secret{Title: entry.Name}
+	if entry.Fav {
+		secret.Tags = []string{pkgalan.FavoriteTag}
+	}
+	if !entry.IsSecureNote() {
+		secret.URL, secret.Username, secret.Password = entry.URL, entry.Username, entry.Password
+		secret.Notes = entry.Extra
+		if len(entry.TOTP) > 0 {
+			secret.Fields = append(secret.Fields, pkgalan.Field{Name: pkgalan.OTPField, Value: entry.TOTP, Protected: true})
+		}
+		return secret
+	}
+	noteType, items, notes := ParseNote(entry.Extra)
+	secret.Notes = notes
+	if len(noteType) > 0 {
+		secret.Fields = append(secret.Fields, pkgalan.Field{Name: NoteTypeField, Value: noteType})
+	}
+	for _, item := range items {
+		switch {
+		case len(item.Value) == 0:
+		case item.Name == "Username" && len(secret.Username) == 0:
+			secret.Username = item.Value
+		case item.Name == "Password" && len(secret.Password) == 0:
+			secret.Password = item.Value
+		default:
+			secret.Fields = append(secret.Fields, pkgalan.Field{
+				Name:      item.Name,
+				Value:     item.Value,
+				Protected: isProtected(item.Name),
+			})
+		}
+	}
+	return secret
+}
+
+// updateEntry sets an entry from a secret. The secrets with a note type
+// become structured secure notes, the ones with only notes plain secure notes.
+func updateEntry(entry *Entry, group []string, secret pkgalan.Secret) {
+	*entry = Entry{
+		Name:     secret.Title,
+		Grouping: joinGroup(group),
+	}
+	for _, tag := range secret.Tags {
+		entry.Fav = entry.Fav || tag == pkgalan.FavoriteTag
+	}
+	if len(secret.Attachments) > 0 {
+		glog.Warningf("LastPass exports can't contain attachments: %s", secret.Title)
+	}
+	if noteType := secret.Field(NoteTypeField); noteType != nil {
+		items := []NoteItem{}
+		if len(secret.Username) > 0 {
+			items = append(items, NoteItem{Name: "Username", Value: secret.Username})
+		}
+		if len(secret.Password) > 0 {
+			items = append(items, NoteItem{Name: "Password", Value: secret.Password})
+		}
+		for _, field := range secret.Fields {
+			if field.Name != NoteTypeField {
+				items = append(items, NoteItem{Name: field.Name, Value: field.Value})
+			}
+		}
+		entry.URL, entry.Extra = SecureNoteURL, FormatNote(noteType.Value, items, secret.Notes)
+		return
+	}
+	if len(secret.URL) == 0 && len(secret.Username) == 0 && len(secret.Password) == 0 && len(secret.Fields) == 0 {
+		entry.URL, entry.Extra = SecureNoteURL, secret.Notes
+		return
+	}
+	entry.URL, entry.Username, entry.Password, entry.Extra = secret.URL, secret.Username, secret.Password, secret.Notes
+	for _, field := range secret.Fields {
+		if field.Name == pkgalan.OTPField {
+			entry.TOTP = field.Value
+		} else {
+			glog.Warningf("LastPass logins can't contain custom fields: %s of %s", field.Name, secret.Title)
+		}
+	}
+}
+
+// isProtected returns true if the value of a secure note must be hidden
+func isProtected(name string) bool {
+	name = strings.ToLower(name)
+	for _, item := range protectedItems {
+		if strings.Contains(name, item) {
+			return true
+		}
+	}
+	for _, word := range strings.Fields(name) {
+		if word == "pin" {
+			return true
+		}
+	}
+	return false
+}
+
+// entryPath returns the alan path of an entry
+func entryPath(entry *Entry) string {
+	return pkgalan.GroupPath(append(splitGroup(entry.Grouping), entry.Name))
+}
+
+// splitGroup returns the names of the levels of a grouping
+func splitGroup(grouping string) []string {
+	names := []string{}
+	for _, name := range strings.Split(grouping, groupSeparator) {
+		if len(name) > 0 {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func joinGroup(names []string) string {
+	return strings.Join(names, groupSeparator)
+}
+
+// isSubgroup returns true if the group is the parent group or one of its subgroups
+func isSubgroup(group []string, parent []string) bool {
+	if len(group) < len(parent) {
+		return false
+	}
+	return strings.Join(group[:len(parent)], "\x00") == strings.Join(parent, "\x00")
+}
@@ -0,0 +1,129 @@
+// Copyright (C) 2018 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lastpass
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	pkgalan "github.com/nlamirault/alan/pkg/alan"
+)
+
+const testExport = "url,username,password,totp,extra,name,grouping,fav\n" +
+	"https://github.com,alan,enigma,ABCDEF,work account,Github,Dev\\Tools,1\n" +
+	"http://sn,,,,\"NoteType:Credit Card\nLanguage:en-US\nName on Card:Alan Turing\nNumber:4111111111111111\nSecurity Code:123\nStart Date:\nNotes:first line\nsecond line\",Visa,Bank,0\n" +
+	"http://sn,,,,\"NoteType:Server\nHostname:bombe.example.com\nUsername:root\nPassword:colossus\nNotes:\",Bombe,,0\n" +
+	"http://sn,,,,just a note,Note,,0\n" +
+	"http://group,,,,,,Empty\\Folder,0\n"
+
+func Test_ParseNote(t *testing.T) {
+	noteType, items, notes := ParseNote("NoteType:SSH Key\nPrivate Key:-----BEGIN KEY-----\nMIIE\n-----END KEY-----\nPassphrase:pass\nNotes:a\nb:c")
+	if noteType != "SSH Key" || notes != "a\nb:c" || len(items) != 2 ||
+		items[0].Value != "-----BEGIN KEY-----\nMIIE\n-----END KEY-----" || items[1].Name != "Passphrase" {
+		t.Fatalf("Invalid note: %s %v %s", noteType, items, notes)
+	}
+	if noteType, items, notes := ParseNote("Notes:a"); noteType != "" || items != nil || notes != "Notes:a" {
+		t.Fatalf("Invalid plain note: %s %v %s", noteType, items, notes)
+	}
+}
+
+func Test_Provider(t *testing.T) {
+	dir, err := ioutil.TempDir("", "alan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "lastpass.csv")
+	if err := ioutil.WriteFile(filename, []byte(testExport), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	provider := NewProvider(filename, false)
+	if err := provider.Open(); err != nil {
+		t.Fatal(err)
+	}
+	tree, _ := provider.Load()
+	groups, secrets := tree.Index()
+	if len(secrets) != 4 || len(groups) != 6 {
+		t.Fatalf("Invalid tree: %v %v", groups, secrets)
+	}
+	github := secrets["Dev/Tools/Github"]
+	if github.Username != "alan" || github.Password != "enigma" || github.URL != "https://github.com" ||
+		github.Notes != "work account" || github.Tags[0] != pkgalan.FavoriteTag || github.Field(pkgalan.OTPField).Value != "ABCDEF" {
+		t.Fatalf("Invalid login: %#v", github)
+	}
+	visa := secrets["Bank/Visa"]
+	expected := []pkgalan.Field{
+		{Name: NoteTypeField, Value: "Credit Card"},
+		{Name: "Language", Value: "en-US"},
+		{Name: "Name on Card", Value: "Alan Turing"},
+		{Name: "Number", Value: "4111111111111111", Protected: true},
+		{Name: "Security Code", Value: "123", Protected: true},
+	}
+	if visa.Notes != "first line\nsecond line" || len(visa.Fields) != len(expected) {
+		t.Fatalf("Invalid note: %#v", visa)
+	}
+	for i, field := range expected {
+		if visa.Fields[i] != field {
+			t.Fatalf("Invalid field: %v", visa.Fields[i])
+		}
+	}
+	if bombe := secrets["Bombe"]; bombe.Username != "root" || bombe.Password != "colossus" ||
+		bombe.Field("Hostname").Value != "bombe.example.com" {
+		t.Fatalf("Invalid server: %#v", bombe)
+	}
+
+	// Write the secrets into a new export and read them again
+	exported := NewProvider(filepath.Join(dir, "exported.csv"), false)
+	if err := exported.Open(); err != nil {
+		t.Fatal(err)
+	}
+	for path, secret := range secrets {
+		if err := exported.Write(path, *secret); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := exported.CreateGroup("Empty/Folder"); err != nil {
+		t.Fatal(err)
+	}
+	if err := exported.Write("Shared/Wifi", pkgalan.Secret{Title: "Wifi", Password: "bombe"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := exported.Delete("Shared/Wifi"); err != nil {
+		t.Fatal(err)
+	}
+	if err := exported.Close(); err != nil {
+		t.Fatal(err)
+	}
+	exported = NewProvider(filepath.Join(dir, "exported.csv"), false)
+	if err := exported.Open(); err != nil {
+		t.Fatal(err)
+	}
+	tree, _ = exported.Load()
+	copies, copied := tree.Index()
+	if len(copied) != len(secrets) || len(copies) != len(groups) {
+		t.Fatalf("Invalid copy: %v %v", copies, copied)
+	}
+	for path, secret := range secrets {
+		if !secret.Equal(copied[path]) {
+			t.Fatalf("Invalid copy of %s: %#v", path, copied[path])
+		}
+	}
+	if _, ok := copies["Empty/Folder"]; !ok {
+		t.Fatalf("Missing empty group: %v", copies)
+	}
+}
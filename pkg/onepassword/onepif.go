@@ -0,0 +1,194 @@
+// Copyright (C) 2018 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onepassword
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/golang/glog"
+
+	pkgalan "github.com/nlamirault/alan/pkg/alan"
+)
+
+// The 1PIF export is a file with one JSON item per line, separated by
+// lines starting with ***. The attachments of an item are into the
+// attachments/<item uuid> directory next to it.
+
+const (
+	pifFolderType   = "system.folder.Regular"
+	pifPasswordType = "passwords.Password"
+)
+
+type pifItem struct {
+	UUID           string `json:"uuid"`
+	UpdatedAt      int64  `json:"updatedAt"`
+	TypeName       string `json:"typeName"`
+	Title          string `json:"title"`
+	Location       string `json:"location"`
+	FolderUUID     string `json:"folderUuid"`
+	Trashed        bool   `json:"trashed"`
+	SecureContents struct {
+		Fields []struct {
+			Value       string `json:"value"`
+			Name        string `json:"name"`
+			Type        string `json:"type"`
+			Designation string `json:"designation"`
+		} `json:"fields"`
+		NotesPlain string `json:"notesPlain"`
+		Password   string `json:"password"`
+		URLs       []struct {
+			URL string `json:"url"`
+		} `json:"URLs"`
+		Sections []struct {
+			Title  string `json:"title"`
+			Fields []struct {
+				Kind  string      `json:"k"`
+				Name  string      `json:"n"`
+				Title string      `json:"t"`
+				Value interface{} `json:"v"`
+			} `json:"fields"`
+		} `json:"sections"`
+		PasswordHistory []struct {
+			Value string `json:"value"`
+			Time  int64  `json:"time"`
+		} `json:"passwordHistory"`
+	} `json:"secureContents"`
+	OpenContents struct {
+		Tags []string `json:"tags"`
+	} `json:"openContents"`
+}
+
+func load1PIF(filename string, vault string) (*pkgalan.Group, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	items := []*pifItem{}
+	folders := map[string]*pifItem{}
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) == 0 || strings.HasPrefix(line, "***") {
+			continue
+		}
+		item := &pifItem{}
+		if err := json.Unmarshal([]byte(line), item); err != nil {
+			return nil, err
+		}
+		if item.TypeName == pifFolderType {
+			folders[item.UUID] = item
+		} else {
+			items = append(items, item)
+		}
+	}
+	groups := newGroups()
+	groups.Group([]string{vault})
+	attachments := filepath.Join(filepath.Dir(filename), "attachments")
+	for _, item := range items {
+		if item.Trashed {
+			glog.V(1).Infof("Skipping trashed item: %s", item.Title)
+			continue
+		}
+		secret, err := item.toSecret(attachments)
+		if err != nil {
+			return nil, err
+		}
+		group := groups.Group(append([]string{vault}, folderNames(folders, item.FolderUUID)...))
+		group.Secrets = append(group.Secrets, secret)
+	}
+	return groups.Root, nil
+}
+
+// folderNames returns the names of a folder and of its parents, the top-level one first
+func folderNames(folders map[string]*pifItem, uuid string) []string {
+	names := []string{}
+	for seen := map[string]bool{}; len(uuid) > 0 && !seen[uuid]; {
+		seen[uuid] = true
+		folder, ok := folders[uuid]
+		if !ok {
+			break
+		}
+		names = append([]string{folder.Title}, names...)
+		uuid = folder.FolderUUID
+	}
+	return names
+}
+
+func (item *pifItem) toSecret(attachments string) (pkgalan.Secret, error) {
+	contents := item.SecureContents
+	secret := pkgalan.Secret{
+		Title:    item.Title,
+		Notes:    contents.NotesPlain,
+		Tags:     item.OpenContents.Tags,
+		Modified: toTime(item.UpdatedAt),
+	}
+	urls := []string{item.Location}
+	for _, url := range contents.URLs {
+		urls = append(urls, url.URL)
+	}
+	addURLs(&secret, urls)
+	for _, field := range contents.Fields {
+		switch {
+		case field.Designation == "username" && len(secret.Username) == 0:
+			secret.Username = field.Value
+		case field.Designation == "password" && len(secret.Password) == 0:
+			secret.Password = field.Value
+		case field.Type == "C" || field.Type == "B" || field.Type == "I":
+			// checkboxes, buttons and submit inputs of the web forms
+		default:
+			addField(&secret, "", field.Name, field.Value, field.Type == "P")
+		}
+	}
+	if item.TypeName == pifPasswordType && len(secret.Password) == 0 {
+		secret.Password = contents.Password
+	}
+	for _, section := range contents.Sections {
+		for _, field := range section.Fields {
+			name := field.Title
+			if len(name) == 0 {
+				name = field.Name
+			}
+			if strings.HasPrefix(field.Name, "TOTP_") {
+				text, _ := formatValue(field.Kind, field.Value)
+				addField(&secret, "", pkgalan.OTPField, text, true)
+				continue
+			}
+			text, protected := formatValue(field.Kind, field.Value)
+			addField(&secret, section.Title, name, text, protected)
+		}
+	}
+	for _, change := range contents.PasswordHistory {
+		addPasswordChange(&secret, change.Value, change.Time)
+	}
+	dir := filepath.Join(attachments, item.UUID)
+	files, err := ioutil.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return secret, err
+	}
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+		content, err := ioutil.ReadFile(filepath.Join(dir, file.Name()))
+		if err != nil {
+			return secret, err
+		}
+		secret.Attachments = append(secret.Attachments, pkgalan.Attachment{Name: file.Name(), Content: content})
+	}
+	return secret, nil
+}
@@ -0,0 +1,218 @@
+// Copyright (C) 2018 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onepassword
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/golang/glog"
+
+	pkgalan "github.com/nlamirault/alan/pkg/alan"
+)
+
+// The 1PUX export is a zip file with the items into export.data, and the
+// documents and attachments into files/<document id>__<file name>.
+
+const (
+	categoryPassword = "005"
+	categoryDocument = "006"
+)
+
+type puxExport struct {
+	Accounts []struct {
+		Vaults []struct {
+			Attrs struct {
+				Name string `json:"name"`
+			} `json:"attrs"`
+			Items []puxItem `json:"items"`
+		} `json:"vaults"`
+	} `json:"accounts"`
+}
+
+type puxItem struct {
+	UpdatedAt    int64  `json:"updatedAt"`
+	State        string `json:"state"`
+	CategoryUUID string `json:"categoryUuid"`
+	Details      struct {
+		LoginFields []struct {
+			Value       string `json:"value"`
+			Name        string `json:"name"`
+			FieldType   string `json:"fieldType"`
+			Designation string `json:"designation"`
+		} `json:"loginFields"`
+		NotesPlain string `json:"notesPlain"`
+		Password   string `json:"password"`
+		Sections   []struct {
+			Title  string `json:"title"`
+			Fields []struct {
+				Title string                 `json:"title"`
+				ID    string                 `json:"id"`
+				Value map[string]interface{} `json:"value"`
+			} `json:"fields"`
+		} `json:"sections"`
+		PasswordHistory []struct {
+			Value string `json:"value"`
+			Time  int64  `json:"time"`
+		} `json:"passwordHistory"`
+		DocumentAttributes *puxDocument `json:"documentAttributes"`
+	} `json:"details"`
+	Overview struct {
+		Title string `json:"title"`
+		URL   string `json:"url"`
+		URLs  []struct {
+			URL string `json:"url"`
+		} `json:"urls"`
+		Tags []string `json:"tags"`
+	} `json:"overview"`
+}
+
+type puxDocument struct {
+	FileName   string `json:"fileName"`
+	DocumentID string `json:"documentId"`
+}
+
+func load1PUX(filename string) (*pkgalan.Group, error) {
+	archive, err := zip.OpenReader(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer archive.Close()
+	files := map[string]*zip.File{}
+	for _, file := range archive.File {
+		files[file.Name] = file
+	}
+	data, err := readZipFile(files["export.data"])
+	if err != nil {
+		return nil, err
+	}
+	var export puxExport
+	if err := json.Unmarshal(data, &export); err != nil {
+		return nil, err
+	}
+	groups := newGroups()
+	for _, account := range export.Accounts {
+		for _, vault := range account.Vaults {
+			group := groups.Group([]string{vault.Attrs.Name})
+			for _, item := range vault.Items {
+				if item.State == "archived" || item.State == "deleted" {
+					glog.V(1).Infof("Skipping %s item: %s", item.State, item.Overview.Title)
+					continue
+				}
+				secret, err := item.toSecret(files)
+				if err != nil {
+					return nil, err
+				}
+				group.Secrets = append(group.Secrets, secret)
+			}
+		}
+	}
+	return groups.Root, nil
+}
+
+func (item *puxItem) toSecret(files map[string]*zip.File) (pkgalan.Secret, error) {
+	secret := pkgalan.Secret{
+		Title:    item.Overview.Title,
+		Notes:    item.Details.NotesPlain,
+		Tags:     item.Overview.Tags,
+		Modified: toTime(item.UpdatedAt),
+	}
+	urls := []string{item.Overview.URL}
+	for _, url := range item.Overview.URLs {
+		urls = append(urls, url.URL)
+	}
+	addURLs(&secret, urls)
+	for _, field := range item.Details.LoginFields {
+		switch {
+		case field.Designation == "username" && len(secret.Username) == 0:
+			secret.Username = field.Value
+		case field.Designation == "password" && len(secret.Password) == 0:
+			secret.Password = field.Value
+		default:
+			addField(&secret, "", field.Name, field.Value, field.FieldType == "P")
+		}
+	}
+	if item.CategoryUUID == categoryPassword && len(secret.Password) == 0 {
+		secret.Password = item.Details.Password
+	}
+	for _, section := range item.Details.Sections {
+		for _, field := range section.Fields {
+			name := field.Title
+			if len(name) == 0 {
+				name = field.ID
+			}
+			for kind, value := range field.Value {
+				switch kind {
+				case "file":
+					document := &puxDocument{}
+					if raw, err := json.Marshal(value); err == nil {
+						json.Unmarshal(raw, document)
+					}
+					if err := addDocument(&secret, files, document); err != nil {
+						return secret, err
+					}
+				case "totp":
+					text, _ := formatValue(kind, value)
+					addField(&secret, "", pkgalan.OTPField, text, true)
+				default:
+					text, protected := formatValue(kind, value)
+					addField(&secret, section.Title, name, text, protected)
+				}
+			}
+		}
+	}
+	if item.CategoryUUID == categoryDocument && item.Details.DocumentAttributes != nil {
+		if err := addDocument(&secret, files, item.Details.DocumentAttributes); err != nil {
+			return secret, err
+		}
+	}
+	for _, change := range item.Details.PasswordHistory {
+		addPasswordChange(&secret, change.Value, change.Time)
+	}
+	return secret, nil
+}
+
+// addDocument adds the content of a document as an attachment
+func addDocument(secret *pkgalan.Secret, files map[string]*zip.File, document *puxDocument) error {
+	if len(document.DocumentID) == 0 {
+		return nil
+	}
+	name := fmt.Sprintf("files/%s__%s", document.DocumentID, document.FileName)
+	file, ok := files[name]
+	if !ok {
+		glog.Infof("Missing document %s of %s", document.FileName, secret.Title)
+		return nil
+	}
+	content, err := readZipFile(file)
+	if err != nil {
+		return err
+	}
+	secret.Attachments = append(secret.Attachments, pkgalan.Attachment{Name: document.FileName, Content: content})
+	return nil
+}
+
+func readZipFile(file *zip.File) ([]byte, error) {
+	if file == nil {
+		return nil, fmt.Errorf("missing export.data")
+	}
+	reader, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return ioutil.ReadAll(reader)
+}
@@ -0,0 +1,161 @@
+// Copyright (C) 2018 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onepassword
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/golang/glog"
+
+	pkgalan "github.com/nlamirault/alan/pkg/alan"
+)
+
+// Provider exposes a 1Password export as a read-only password manager
+// storage. The vaults are the top-level groups, the 1PIF folders their
+// subgroups.
+type Provider struct {
+	filename string
+	tree     *pkgalan.Group
+	secrets  map[string]*pkgalan.Secret
+}
+
+// NewProvider creates a provider for a 1PUX export, or a 1PIF export file or directory
+func NewProvider(filename string) *Provider {
+	return &Provider{filename: filename}
+}
+
+// Open parses the export
+func (provider *Provider) Open() error {
+	glog.V(2).Infof("Open 1Password export: %s", provider.filename)
+	info, err := os.Stat(provider.filename)
+	if err != nil {
+		return err
+	}
+	var tree *pkgalan.Group
+	switch {
+	case info.IsDir():
+		tree, err = load1PIF(filepath.Join(provider.filename, "data.1pif"), vaultName(provider.filename))
+	case isZip(provider.filename):
+		tree, err = load1PUX(provider.filename)
+	default:
+		tree, err = load1PIF(provider.filename, vaultName(filepath.Dir(provider.filename)))
+	}
+	if err != nil {
+		return fmt.Errorf("Invalid 1Password export %s: %s", provider.filename, err)
+	}
+	provider.tree = tree
+	_, provider.secrets = tree.Index()
+	return nil
+}
+
+// Load returns the tree of the vaults and folders of the export
+func (provider *Provider) Load() (*pkgalan.Group, error) {
+	return provider.tree, nil
+}
+
+// Read returns the secret of an item, or nil if it doesn't exist
+func (provider *Provider) Read(path string) (*pkgalan.Secret, error) {
+	return provider.secrets[path], nil
+}
+
+// Write fails, 1Password exports are read-only
+func (provider *Provider) Write(path string, secret pkgalan.Secret) error {
+	return fmt.Errorf("1Password exports are read-only: can't write %s", path)
+}
+
+// Delete fails, 1Password exports are read-only
+func (provider *Provider) Delete(path string) error {
+	return fmt.Errorf("1Password exports are read-only: can't delete %s", path)
+}
+
+// CreateGroup fails, 1Password exports are read-only
+func (provider *Provider) CreateGroup(path string) error {
+	return fmt.Errorf("1Password exports are read-only: can't create %s", path)
+}
+
+// Close does nothing
+func (provider *Provider) Close() error {
+	return nil
+}
+
+func isZip(filename string) bool {
+	file, err := os.Open(filename)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	magic := make([]byte, 4)
+	if _, err := file.Read(magic); err != nil {
+		return false
+	}
+	return string(magic) == "PK\x03\x04"
+}
+
+// vaultName returns the name of the vault of a 1PIF export directory
+func vaultName(dir string) string {
+	name := strings.TrimSuffix(filepath.Base(dir), ".1pif")
+	if name == "." || name == string(filepath.Separator) {
+		return "1Password"
+	}
+	return name
+}
+
+// newGroups creates the tree of groups of an export
+func newGroups() *pkgalan.GroupTree {
+	groups := pkgalan.NewGroupTree()
+	groups.Root.Name = "1Password"
+	return groups
+}
+
+// addField adds a custom field, named after its section if any
+func addField(secret *pkgalan.Secret, section string, name string, value string, protected bool) {
+	if len(value) == 0 {
+		return
+	}
+	if len(section) > 0 && !strings.EqualFold(section, name) {
+		name = section + ": " + name
+	}
+	secret.Fields = append(secret.Fields, pkgalan.Field{Name: name, Value: value, Protected: protected})
+}
+
+// addURLs sets the URL of a secret, the other ones are custom fields
+func addURLs(secret *pkgalan.Secret, urls []string) {
+	count := 1
+	for _, url := range urls {
+		switch {
+		case len(url) == 0 || url == secret.URL:
+		case len(secret.URL) == 0:
+			secret.URL = url
+		default:
+			count++
+			addField(secret, "", fmt.Sprintf("%s %d", pkgalan.URLField, count), url, false)
+		}
+	}
+}
+
+// addPasswordChange adds a previous password, the history being sorted by time
+func addPasswordChange(secret *pkgalan.Secret, password string, changed int64) {
+	secret.PasswordHistory = append(secret.PasswordHistory, pkgalan.PasswordChange{
+		Password: password,
+		Changed:  toTime(changed),
+	})
+	sort.SliceStable(secret.PasswordHistory, func(i, j int) bool {
+		return secret.PasswordHistory[i].Changed.Before(secret.PasswordHistory[j].Changed)
+	})
+}
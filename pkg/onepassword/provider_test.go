@@ -0,0 +1,197 @@
+// Copyright (C) 2018 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onepassword
+
+import (
+	"archive/zip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	pkgalan "github.com/nlamirault/alan/pkg/alan"
+)
+
+const testExportData = `{
+  "accounts": [{
+    "attrs": {"accountName": "Alan"},
+    "vaults": [{
+      "attrs": {"uuid": "v1", "name": "Personal"},
+      "items": [{
+        "uuid": "i1", "updatedAt": 1525255965, "state": "active", "categoryUuid": "001",
+        "details": {
+          "loginFields": [
+            {"value": "alan", "name": "username", "fieldType": "T", "designation": "username"},
+            {"value": "enigma", "name": "password", "fieldType": "P", "designation": "password"}
+          ],
+          "notesPlain": "work account",
+          "sections": [{"title": "Security", "fields": [
+            {"title": "one-time password", "id": "TOTP_1", "value": {"totp": "otpauth://totp/github?secret=ABC"}},
+            {"title": "recovery code", "id": "r1", "value": {"concealed": "1234"}},
+            {"title": "key", "id": "f1", "value": {"file": {"fileName": "id_rsa", "documentId": "d1"}}}
+          ]}],
+          "passwordHistory": [{"value": "bombe", "time": 1525000000}, {"value": "turing", "time": 1524000000}]
+        },
+        "overview": {"title": "Github", "url": "https://github.com",
+          "urls": [{"url": "https://github.com"}, {"url": "https://gist.github.com"}], "tags": ["dev"]}
+      }, {
+        "uuid": "i2", "state": "archived", "categoryUuid": "003",
+        "details": {"notesPlain": "old"}, "overview": {"title": "Archived"}
+      }]
+    }, {
+      "attrs": {"uuid": "v2", "name": "Shared"},
+      "items": [{
+        "uuid": "i3", "state": "active", "categoryUuid": "002",
+        "details": {"sections": [{"title": "", "fields": [
+          {"title": "cardholder name", "id": "cardholder", "value": {"string": "Alan Turing"}},
+          {"title": "number", "id": "ccnum", "value": {"creditCardNumber": "4111111111111111"}},
+          {"title": "expiry date", "id": "expiry", "value": {"monthYear": 202512}}
+        ]}]},
+        "overview": {"title": "Visa"}
+      }, {
+        "uuid": "i4", "state": "active", "categoryUuid": "004",
+        "details": {"sections": [{"title": "Address", "fields": [
+          {"title": "address", "id": "address", "value": {"address": {"street": "Bletchley Park", "city": "Milton Keynes", "country": "uk", "zip": "MK3 6EB", "state": ""}}}
+        ]}]},
+        "overview": {"title": "Identity"}
+      }]
+    }]
+  }]
+}`
+
+const testPIF = `{"uuid":"F1","typeName":"system.folder.Regular","title":"Dev"}
+***5642bee8-a5ff-11dc-8314-0800200c9a66***
+{"uuid":"F2","typeName":"system.folder.Regular","title":"Tools","folderUuid":"F1"}
+***5642bee8-a5ff-11dc-8314-0800200c9a66***
+{"uuid":"I1","typeName":"webforms.WebForm","title":"Jenkins","location":"https://ci.example.com","folderUuid":"F2","updatedAt":1525255965,"secureContents":{"fields":[{"value":"alan","name":"login","type":"T","designation":"username"},{"value":"enigma","name":"pass","type":"P","designation":"password"},{"value":"✓","name":"remember","type":"C"}],"sections":[{"title":"","fields":[{"k":"concealed","n":"TOTP_X","t":"","v":"otpauth://totp/ci?secret=XYZ"},{"k":"date","n":"since","t":"member since","v":1514764800}]}]},"openContents":{"tags":["ci"]}}
+***5642bee8-a5ff-11dc-8314-0800200c9a66***
+{"uuid":"I2","typeName":"passwords.Password","title":"Wifi","secureContents":{"password":"bombe"}}
+***5642bee8-a5ff-11dc-8314-0800200c9a66***
+{"uuid":"I3","typeName":"securenotes.SecureNote","title":"Old","trashed":true,"secureContents":{"notesPlain":"deleted"}}
+***5642bee8-a5ff-11dc-8314-0800200c9a66***
+`
+
+func Test_1PUX(t *testing.T) {
+	dir, err := ioutil.TempDir("", "alan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "export.1pux")
+	file, err := os.Create(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive := zip.NewWriter(file)
+	for name, content := range map[string]string{
+		"export.attributes": `{"version": 1}`,
+		"export.data":       testExportData,
+		"files/d1__id_rsa":  "private key",
+	} {
+		w, _ := archive.Create(name)
+		w.Write([]byte(content))
+	}
+	archive.Close()
+	file.Close()
+
+	provider := NewProvider(filename)
+	if err := provider.Open(); err != nil {
+		t.Fatal(err)
+	}
+	tree, _ := provider.Load()
+	groups, secrets := tree.Index()
+	if len(secrets) != 3 || len(groups) != 3 {
+		t.Fatalf("Invalid tree: %v %v", groups, secrets)
+	}
+	github := secrets["Personal/Github"]
+	if github.Username != "alan" || github.Password != "enigma" || github.URL != "https://github.com" ||
+		github.Notes != "work account" || github.Tags[0] != "dev" || github.Modified.Unix() != 1525255965 {
+		t.Fatalf("Invalid secret: %#v", github)
+	}
+	expected := []pkgalan.Field{
+		{Name: "URL 2", Value: "https://gist.github.com"},
+		{Name: pkgalan.OTPField, Value: "otpauth://totp/github?secret=ABC", Protected: true},
+		{Name: "Security: recovery code", Value: "1234", Protected: true},
+	}
+	if len(github.Fields) != len(expected) {
+		t.Fatalf("Invalid fields: %v", github.Fields)
+	}
+	for i, field := range expected {
+		if github.Fields[i] != field {
+			t.Fatalf("Invalid field: %v", github.Fields[i])
+		}
+	}
+	if len(github.Attachments) != 1 || string(github.Attachments[0].Content) != "private key" {
+		t.Fatalf("Invalid attachments: %v", github.Attachments)
+	}
+	if history := github.PasswordHistory; len(history) != 2 || history[0].Password != "turing" {
+		t.Fatalf("Invalid history: %v", history)
+	}
+	if card := secrets["Shared/Visa"]; card.Field("number") == nil || !card.Field("number").Protected ||
+		card.Field("expiry date").Value != "12/2025" || card.Field("cardholder name").Value != "Alan Turing" {
+		t.Fatalf("Invalid card: %v", card.Fields)
+	}
+	if identity := secrets["Shared/Identity"]; identity.Field("address") == nil || identity.Field("address").Value != "Bletchley Park, Milton Keynes, MK3 6EB, uk" {
+		t.Fatalf("Invalid identity: %v", identity.Fields)
+	}
+	if err := provider.Write("Personal/Github", *github); err == nil {
+		t.Fatalf("Wrote into a 1Password export")
+	}
+}
+
+func Test_1PIF(t *testing.T) {
+	dir, err := ioutil.TempDir("", "alan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	export := filepath.Join(dir, "Work.1pif")
+	if err := os.MkdirAll(filepath.Join(export, "attachments", "I1"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(export, "data.1pif"), []byte(testPIF), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(export, "attachments", "I1", "token.txt"), []byte("secret"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, filename := range []string{export, filepath.Join(export, "data.1pif")} {
+		provider := NewProvider(filename)
+		if err := provider.Open(); err != nil {
+			t.Fatal(err)
+		}
+		tree, _ := provider.Load()
+		_, secrets := tree.Index()
+		if len(secrets) != 2 {
+			t.Fatalf("Invalid secrets: %v", secrets)
+		}
+		jenkins, _ := provider.Read("Work/Dev/Tools/Jenkins")
+		if jenkins == nil || jenkins.Username != "alan" || jenkins.Password != "enigma" ||
+			jenkins.URL != "https://ci.example.com" || len(jenkins.Fields) != 2 ||
+			jenkins.Field(pkgalan.OTPField).Value != "otpauth://totp/ci?secret=XYZ" ||
+			jenkins.Field("member since").Value != "2018-01-01" {
+			t.Fatalf("Invalid secret: %#v", jenkins)
+		}
+		if len(jenkins.Attachments) != 1 || string(jenkins.Attachments[0].Content) != "secret" {
+			t.Fatalf("Invalid attachments: %v", jenkins.Attachments)
+		}
+		if wifi := secrets["Work/Wifi"]; wifi.Password != "bombe" {
+			t.Fatalf("Invalid password: %#v", wifi)
+		}
+	}
+}
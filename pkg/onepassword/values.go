@@ -0,0 +1,108 @@
+// Copyright (C) 2018 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onepassword
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// formatValue returns the text of a field value of a kind, and true if it
+// is a secret value.
+func formatValue(kind string, value interface{}) (string, bool) {
+	switch strings.ToLower(kind) {
+	case "concealed", "creditcardnumber", "totp":
+		return toString(value), true
+	case "date":
+		if seconds, ok := toInt(value); ok {
+			return time.Unix(seconds, 0).UTC().Format("2006-01-02"), false
+		}
+	case "monthyear":
+		// YYYYMM
+		if month, ok := toInt(value); ok && month > 0 {
+			return fmt.Sprintf("%02d/%04d", month%100, month/100), false
+		}
+	case "email":
+		if email, ok := value.(map[string]interface{}); ok {
+			return toString(email["email_address"]), false
+		}
+	case "address":
+		if address, ok := value.(map[string]interface{}); ok {
+			return formatAddress(address), false
+		}
+	case "sshkey":
+		if key, ok := value.(map[string]interface{}); ok {
+			return toString(key["privateKey"]), true
+		}
+	}
+	return toString(value), false
+}
+
+// formatAddress returns an address on a single line
+func formatAddress(address map[string]interface{}) string {
+	parts := []string{}
+	for _, key := range []string{"street", "city", "state", "zip", "country"} {
+		if value := toString(address[key]); len(value) > 0 {
+			parts = append(parts, value)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+func toString(value interface{}) string {
+	switch value := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	case map[string]interface{}:
+		keys := []string{}
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		parts := []string{}
+		for _, key := range keys {
+			if text := toString(value[key]); len(text) > 0 {
+				parts = append(parts, text)
+			}
+		}
+		return strings.Join(parts, ", ")
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+func toInt(value interface{}) (int64, bool) {
+	switch value := value.(type) {
+	case float64:
+		return int64(value), true
+	case string:
+		n, err := strconv.ParseInt(value, 10, 64)
+		return n, err == nil
+	}
+	return 0, false
+}
+
+func toTime(seconds int64) time.Time {
+	if seconds <= 0 {
+		return time.Time{}
+	}
+	return time.Unix(seconds, 0).UTC()
+}
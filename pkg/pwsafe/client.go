@@ -0,0 +1,337 @@
+// Copyright (C) 2018 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pwsafe
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/golang/glog"
+
+	pkgalan "github.com/nlamirault/alan/pkg/alan"
+)
+
+const (
+	// EmailField is the name of the custom field of the email of an entry
+	EmailField = "Email"
+
+	// groupSeparator separates the levels of the group of an entry
+	groupSeparator = '.'
+
+	// defaultHistorySize is the number of previous passwords kept by default
+	defaultHistorySize = 5
+)
+
+// Client define a client to manage Password Safe V3 databases
+type Client struct {
+	filename string
+	password func() (string, error)
+	unlocked string
+	backups  int
+	db       *Database
+}
+
+// NewClient create a new Password Safe database client. The password
+// function is called once, when the database is opened or created.
+func NewClient(filename string, password func() (string, error)) (*Client, error) {
+	return &Client{
+		filename: filename,
+		password: password,
+		backups:  pkgalan.DefaultBackups,
+	}, nil
+}
+
+// SetBackups defines the number of backup copies kept when the database is saved
+func (client *Client) SetBackups(backups int) {
+	client.backups = backups
+}
+
+// Open decodes the database
+func (client *Client) Open() error {
+	glog.V(2).Infof("Open database from file: %s", client.filename)
+	file, err := os.Open(client.filename)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("Database file not exists")
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	password, err := client.password()
+	if err != nil {
+		return err
+	}
+	db, err := Decode(file, password)
+	if err != nil {
+		return err
+	}
+	client.db, client.unlocked = db, password
+	return nil
+}
+
+// Create creates a new empty database
+func (client *Client) Create() error {
+	password, err := client.password()
+	if err != nil {
+		return err
+	}
+	client.db, client.unlocked = NewDatabase(), password
+	return nil
+}
+
+// Save encrypts the database into its file.
+// The file is replaced atomically, after a backup of the previous one.
+func (client *Client) Save() error {
+	glog.V(2).Infof("Output file for database: %s", client.filename)
+	client.db.Header.SetTime(HeaderLastSave, time.Now())
+	client.db.Header.SetText(HeaderWhatSaved, pkgalan.Generator)
+	err := pkgalan.WriteFile(client.filename, client.backups, func(w io.Writer) error {
+		return client.db.Encode(w, client.unlocked)
+	})
+	if err != nil {
+		return err
+	}
+	glog.V(1).Infof("Database saved into: %s", client.filename)
+	return nil
+}
+
+// Close forgets the password of the database
+func (client *Client) Close() error {
+	glog.V(2).Infof("Close Password Safe database: %s", client.filename)
+	client.unlocked = ""
+	return nil
+}
+
+// Load returns the tree of groups of the database
+func (client *Client) Load() (*pkgalan.Group, error) {
+	tree := pkgalan.NewGroupTree()
+	for _, data := range client.db.Header.GetAll(HeaderEmptyGroups) {
+		tree.Group(splitGroup(string(data)))
+	}
+	for _, record := range client.db.Records {
+		secret := toSecret(record)
+		if len(secret.Title) == 0 {
+			glog.Infof("Skipping entry: %s", secret.URL)
+			continue
+		}
+		group := tree.Group(splitGroup(record.GetText(FieldGroup)))
+		group.Secrets = append(group.Secrets, secret)
+	}
+	return tree.Root, nil
+}
+
+// findRecord returns the index of the record with the UUID, or else with the path, or -1
+func (client *Client) findRecord(path string, uuid string) int {
+	if len(uuid) > 0 {
+		for i, record := range client.db.Records {
+			if encodeUUID(record.Get(FieldUUID)) == uuid {
+				return i
+			}
+		}
+	}
+	for i, record := range client.db.Records {
+		if recordPath(record) == path {
+			return i
+		}
+	}
+	return -1
+}
+
+// recordPath returns the alan path of a record
+func recordPath(record *Record) string {
+	names := append(splitGroup(record.GetText(FieldGroup)), record.GetText(FieldTitle))
+	return pkgalan.GroupPath(names)
+}
+
+func toSecret(record *Record) pkgalan.Secret {
+	secret := pkgalan.Secret{
+		UUID:            encodeUUID(record.Get(FieldUUID)),
+		Title:           record.GetText(FieldTitle),
+		Username:        record.GetText(FieldUsername),
+		Password:        record.GetText(FieldPassword),
+		URL:             record.GetText(FieldURL),
+		Notes:           strings.Replace(record.GetText(FieldNotes), "\r\n", "\n", -1),
+		PasswordHistory: parseHistory(record.GetText(FieldPasswordHistory)),
+		Modified:        record.GetTime(FieldModified),
+	}
+	if secret.Modified.IsZero() {
+		secret.Modified = record.GetTime(FieldCreated)
+	}
+	if email := record.GetText(FieldEmail); len(email) > 0 {
+		secret.Fields = append(secret.Fields, pkgalan.Field{Name: EmailField, Value: email})
+	}
+	return secret
+}
+
+// updateRecord sets the fields of a record from a secret. The fields which
+// alan doesn't know are kept. The previous password is added to the history.
+func updateRecord(record *Record, group []string, secret pkgalan.Secret) {
+	now := time.Now()
+	if len(record.Get(FieldUUID)) == 0 {
+		uuid, err := base64.StdEncoding.DecodeString(secret.UUID)
+		if err != nil || len(uuid) != 16 {
+			uuid = newUUID()
+		}
+		record.Set(FieldUUID, uuid)
+		record.SetTime(FieldCreated, now)
+	}
+	history := secret.PasswordHistory
+	previous := record.GetText(FieldPassword)
+	if len(history) == 0 {
+		history = parseHistory(record.GetText(FieldPasswordHistory))
+		if len(previous) > 0 && previous != secret.Password {
+			history = append(history, pkgalan.PasswordChange{Password: previous, Changed: now})
+		}
+	}
+	if previous != secret.Password {
+		record.SetTime(FieldPasswordChanged, now)
+	}
+	record.SetText(FieldGroup, joinGroup(group))
+	record.SetText(FieldTitle, secret.Title)
+	record.SetText(FieldUsername, secret.Username)
+	record.SetText(FieldPassword, secret.Password)
+	record.SetText(FieldURL, secret.URL)
+	record.SetText(FieldNotes, strings.Replace(secret.Notes, "\n", "\r\n", -1))
+	record.SetText(FieldPasswordHistory, formatHistory(history))
+	email := ""
+	for _, field := range secret.Fields {
+		if field.Name == EmailField {
+			email = field.Value
+		} else {
+			glog.Warningf("Password Safe records have no custom fields, skipping %s of %s", field.Name, secret.Title)
+		}
+	}
+	record.SetText(FieldEmail, email)
+	if len(secret.Attachments) > 0 {
+		glog.Warningf("Password Safe records have no attachments, skipping %d of %s", len(secret.Attachments), secret.Title)
+	}
+	if !secret.Modified.IsZero() {
+		now = secret.Modified
+	}
+	record.SetTime(FieldModified, now)
+}
+
+// parseHistory decodes the password history: its status, maximum size and
+// number of entries as hexadecimal, then for each entry its time, its length
+// and the password.
+func parseHistory(text string) []pkgalan.PasswordChange {
+	if len(text) < 5 {
+		return nil
+	}
+	count, err := strconv.ParseUint(text[3:5], 16, 8)
+	if err != nil {
+		return nil
+	}
+	history := []pkgalan.PasswordChange{}
+	for rest := text[5:]; count > 0 && len(rest) >= 12; count-- {
+		changed, err := strconv.ParseUint(rest[:8], 16, 32)
+		if err != nil {
+			return history
+		}
+		length, err := strconv.ParseUint(rest[8:12], 16, 16)
+		if err != nil {
+			return history
+		}
+		rest = rest[12:]
+		end := 0
+		for i := uint64(0); i < length && end < len(rest); i++ {
+			_, size := utf8.DecodeRuneInString(rest[end:])
+			end += size
+		}
+		change := pkgalan.PasswordChange{Password: rest[:end]}
+		if changed > 0 {
+			change.Changed = time.Unix(int64(changed), 0).UTC()
+		}
+		history = append(history, change)
+		rest = rest[end:]
+	}
+	return history
+}
+
+func formatHistory(history []pkgalan.PasswordChange) string {
+	if len(history) == 0 {
+		return ""
+	}
+	if len(history) > 0xff {
+		history = history[len(history)-0xff:]
+	}
+	size := defaultHistorySize
+	if len(history) > size {
+		size = len(history)
+	}
+	var text strings.Builder
+	fmt.Fprintf(&text, "1%02x%02x", size, len(history))
+	for _, change := range history {
+		changed := int64(0)
+		if !change.Changed.IsZero() {
+			changed = change.Changed.Unix()
+		}
+		fmt.Fprintf(&text, "%08x%04x%s", changed, utf8.RuneCountInString(change.Password), change.Password)
+	}
+	return text.String()
+}
+
+// splitGroup returns the levels of a group. Dots into names are escaped by a backslash.
+func splitGroup(group string) []string {
+	names := []string{}
+	var name strings.Builder
+	for i := 0; i < len(group); i++ {
+		switch {
+		case group[i] == '\\' && i+1 < len(group) && group[i+1] == groupSeparator:
+			name.WriteByte(groupSeparator)
+			i++
+		case group[i] == groupSeparator:
+			names = append(names, name.String())
+			name.Reset()
+		default:
+			name.WriteByte(group[i])
+		}
+	}
+	if name.Len() > 0 || len(names) > 0 {
+		names = append(names, name.String())
+	}
+	return names
+}
+
+func joinGroup(names []string) string {
+	escaped := []string{}
+	for _, name := range names {
+		escaped = append(escaped, strings.Replace(name, string(groupSeparator), `\`+string(groupSeparator), -1))
+	}
+	return strings.Join(escaped, string(groupSeparator))
+}
+
+func encodeUUID(uuid []byte) string {
+	if len(uuid) != 16 {
+		return ""
+	}
+	return base64.StdEncoding.EncodeToString(uuid)
+}
+
+func newUUID() []byte {
+	uuid := make([]byte, 16)
+	rand.Read(uuid)
+	// version 4, variant RFC 4122
+	uuid[6] = (uuid[6] & 0x0f) | 0x40
+	uuid[8] = (uuid[8] & 0x3f) | 0x80
+	return uuid
+}
@@ -0,0 +1,357 @@
+// Copyright (C) 2018 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pwsafe
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"time"
+
+	"golang.org/x/crypto/twofish"
+)
+
+// The Password Safe V3 format is described in
+// https://github.com/pwsafe/pwsafe/blob/master/docs/formatV3.txt
+
+const (
+	// DefaultIterations is the number of key stretching iterations of the new databases
+	DefaultIterations = 262144
+
+	minIterations = 2048
+	blockSize     = twofish.BlockSize
+)
+
+var (
+	tag       = []byte("PWS3")
+	eofMarker = []byte("PWS3-EOFPWS3-EOF")
+)
+
+// Header field types
+const (
+	HeaderVersion     byte = 0x00
+	HeaderUUID        byte = 0x01
+	HeaderLastSave    byte = 0x04
+	HeaderWhatSaved   byte = 0x06
+	HeaderEmptyGroups byte = 0x11
+)
+
+// Record field types
+const (
+	FieldUUID            byte = 0x01
+	FieldGroup           byte = 0x02
+	FieldTitle           byte = 0x03
+	FieldUsername        byte = 0x04
+	FieldNotes           byte = 0x05
+	FieldPassword        byte = 0x06
+	FieldCreated         byte = 0x07
+	FieldPasswordChanged byte = 0x08
+	FieldModified        byte = 0x0c
+	FieldURL             byte = 0x0d
+	FieldPasswordHistory byte = 0x0f
+	FieldEmail           byte = 0x14
+	fieldEnd             byte = 0xff
+)
+
+// formatVersion is the version 3.13 of the format, the minor version first
+var formatVersion = []byte{0x0d, 0x03}
+
+// Field is a typed value of the header or of a record
+type Field struct {
+	Type byte
+	Data []byte
+}
+
+// Record is a list of fields. The end of record field is implicit.
+type Record struct {
+	Fields []Field
+}
+
+// Database is a decoded Password Safe database
+type Database struct {
+	Iterations uint32
+	Header     Record
+	Records    []*Record
+}
+
+// NewDatabase creates an empty database
+func NewDatabase() *Database {
+	db := &Database{Iterations: DefaultIterations}
+	db.Header.Set(HeaderVersion, formatVersion)
+	db.Header.Set(HeaderUUID, newUUID())
+	return db
+}
+
+// Get returns the data of the first field of a type, or nil
+func (record *Record) Get(fieldType byte) []byte {
+	for _, field := range record.Fields {
+		if field.Type == fieldType {
+			return field.Data
+		}
+	}
+	return nil
+}
+
+// GetText returns the text of the first field of a type
+func (record *Record) GetText(fieldType byte) string {
+	return string(record.Get(fieldType))
+}
+
+// GetTime returns the time of the first field of a type, stored as a 32 bits time_t
+func (record *Record) GetTime(fieldType byte) time.Time {
+	data := record.Get(fieldType)
+	if len(data) < 4 {
+		return time.Time{}
+	}
+	return time.Unix(int64(binary.LittleEndian.Uint32(data)), 0).UTC()
+}
+
+// Set replaces the fields of a type. Empty data removes them.
+func (record *Record) Set(fieldType byte, data []byte) {
+	fields := record.Fields[:0]
+	found := false
+	for _, field := range record.Fields {
+		if field.Type != fieldType {
+			fields = append(fields, field)
+		} else if !found && len(data) > 0 {
+			fields = append(fields, Field{Type: fieldType, Data: data})
+			found = true
+		}
+	}
+	record.Fields = fields
+	if !found && len(data) > 0 {
+		record.Fields = append(record.Fields, Field{Type: fieldType, Data: data})
+	}
+}
+
+// SetText replaces the fields of a type by a text
+func (record *Record) SetText(fieldType byte, text string) {
+	record.Set(fieldType, []byte(text))
+}
+
+// SetTime replaces the fields of a type by a time
+func (record *Record) SetTime(fieldType byte, t time.Time) {
+	if t.IsZero() {
+		record.Set(fieldType, nil)
+		return
+	}
+	data := make([]byte, 4)
+	binary.LittleEndian.PutUint32(data, uint32(t.Unix()))
+	record.Set(fieldType, data)
+}
+
+// GetAll returns the data of all the fields of a type
+func (record *Record) GetAll(fieldType byte) [][]byte {
+	values := [][]byte{}
+	for _, field := range record.Fields {
+		if field.Type == fieldType {
+			values = append(values, field.Data)
+		}
+	}
+	return values
+}
+
+// SetAll replaces the fields of a type by one field per value
+func (record *Record) SetAll(fieldType byte, values [][]byte) {
+	record.Set(fieldType, nil)
+	for _, value := range values {
+		record.Fields = append(record.Fields, Field{Type: fieldType, Data: value})
+	}
+}
+
+// stretchKey computes the stretched key of a password
+func stretchKey(password string, salt []byte, iterations uint32) []byte {
+	hash := sha256.New()
+	hash.Write([]byte(password))
+	hash.Write(salt)
+	key := hash.Sum(nil)
+	for i := uint32(0); i < iterations; i++ {
+		sum := sha256.Sum256(key)
+		key = sum[:]
+	}
+	return key
+}
+
+// Decode reads a database encrypted with a password
+func Decode(r io.Reader, password string) (*Database, error) {
+	content, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	// tag, salt, iterations, H(P'), B1-B4, IV, the end of file and HMAC
+	if len(content) < 4+32+4+32+4*blockSize+blockSize+len(eofMarker)+32 || !bytes.Equal(content[:4], tag) {
+		return nil, fmt.Errorf("Not a Password Safe V3 database")
+	}
+	salt := content[4:36]
+	iterations := binary.LittleEndian.Uint32(content[36:40])
+	stretched := stretchKey(password, salt, iterations)
+	if hash := sha256.Sum256(stretched); !hmac.Equal(hash[:], content[40:72]) {
+		return nil, fmt.Errorf("Invalid password")
+	}
+	keyCipher, err := twofish.NewCipher(stretched)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]byte, 4*blockSize)
+	for i := 0; i < 4; i++ {
+		keyCipher.Decrypt(keys[i*blockSize:], content[72+i*blockSize:72+(i+1)*blockSize])
+	}
+	recordCipher, err := twofish.NewCipher(keys[:32])
+	if err != nil {
+		return nil, err
+	}
+	iv := content[136:152]
+	end := -1
+	for offset := 152; offset+blockSize <= len(content); offset += blockSize {
+		if bytes.Equal(content[offset:offset+blockSize], eofMarker) {
+			end = offset
+			break
+		}
+	}
+	if end < 0 {
+		return nil, fmt.Errorf("Invalid database: no end of file")
+	}
+	encrypted := content[152:end]
+	expectedMAC := content[end+len(eofMarker):]
+	if len(expectedMAC) != sha256.Size {
+		return nil, fmt.Errorf("Invalid database: no HMAC")
+	}
+	plain := make([]byte, len(encrypted))
+	cipher.NewCBCDecrypter(recordCipher, iv).CryptBlocks(plain, encrypted)
+
+	mac := hmac.New(sha256.New, keys[32:])
+	db := &Database{Iterations: iterations}
+	record := &db.Header
+	inHeader := true
+	for offset := 0; offset < len(plain); {
+		if len(plain)-offset < blockSize {
+			return nil, fmt.Errorf("Invalid database: truncated field")
+		}
+		length := int(binary.LittleEndian.Uint32(plain[offset:]))
+		fieldType := plain[offset+4]
+		if offset+5+length > len(plain) {
+			return nil, fmt.Errorf("Invalid database: invalid field length %d", length)
+		}
+		data := append([]byte{}, plain[offset+5:offset+5+length]...)
+		mac.Write(data)
+		offset += fieldBlocks(length) * blockSize
+		if fieldType != fieldEnd {
+			record.Fields = append(record.Fields, Field{Type: fieldType, Data: data})
+			continue
+		}
+		if !inHeader {
+			db.Records = append(db.Records, record)
+		}
+		inHeader = false
+		record = &Record{}
+	}
+	if !hmac.Equal(mac.Sum(nil), expectedMAC) {
+		return nil, fmt.Errorf("Invalid database: HMAC mismatch")
+	}
+	return db, nil
+}
+
+// Encode writes the database encrypted with a password
+func (db *Database) Encode(w io.Writer, password string) error {
+	if db.Iterations < minIterations {
+		db.Iterations = minIterations
+	}
+	random := func(size int) ([]byte, error) {
+		data := make([]byte, size)
+		_, err := rand.Read(data)
+		return data, err
+	}
+	salt, err := random(32)
+	if err != nil {
+		return err
+	}
+	keys, err := random(4 * blockSize)
+	if err != nil {
+		return err
+	}
+	iv, err := random(blockSize)
+	if err != nil {
+		return err
+	}
+	stretched := stretchKey(password, salt, db.Iterations)
+	keyCipher, err := twofish.NewCipher(stretched)
+	if err != nil {
+		return err
+	}
+	recordCipher, err := twofish.NewCipher(keys[:32])
+	if err != nil {
+		return err
+	}
+
+	var buffer bytes.Buffer
+	buffer.Write(tag)
+	buffer.Write(salt)
+	binary.Write(&buffer, binary.LittleEndian, db.Iterations)
+	hash := sha256.Sum256(stretched)
+	buffer.Write(hash[:])
+	encryptedKeys := make([]byte, len(keys))
+	for i := 0; i < 4; i++ {
+		keyCipher.Encrypt(encryptedKeys[i*blockSize:], keys[i*blockSize:(i+1)*blockSize])
+	}
+	buffer.Write(encryptedKeys)
+	buffer.Write(iv)
+
+	mac := hmac.New(sha256.New, keys[32:])
+	var plain bytes.Buffer
+	records := append([]*Record{&db.Header}, db.Records...)
+	for _, record := range records {
+		for _, field := range append(record.Fields, Field{Type: fieldEnd}) {
+			if err := writeField(&plain, field); err != nil {
+				return err
+			}
+			mac.Write(field.Data)
+		}
+	}
+	encrypted := make([]byte, plain.Len())
+	cipher.NewCBCEncrypter(recordCipher, iv).CryptBlocks(encrypted, plain.Bytes())
+	buffer.Write(encrypted)
+	buffer.Write(eofMarker)
+	buffer.Write(mac.Sum(nil))
+	_, err = w.Write(buffer.Bytes())
+	return err
+}
+
+// fieldBlocks returns the number of blocks of a field: the first one holds
+// the length, the type and the beginning of the data.
+func fieldBlocks(length int) int {
+	if length <= blockSize-5 {
+		return 1
+	}
+	return 1 + (length-(blockSize-5)+blockSize-1)/blockSize
+}
+
+// writeField writes a field padded with random bytes
+func writeField(w *bytes.Buffer, field Field) error {
+	block := make([]byte, fieldBlocks(len(field.Data))*blockSize)
+	if _, err := rand.Read(block); err != nil {
+		return err
+	}
+	binary.LittleEndian.PutUint32(block, uint32(len(field.Data)))
+	block[4] = field.Type
+	copy(block[5:], field.Data)
+	_, err := w.Write(block)
+	return err
+}
@@ -0,0 +1,159 @@
+// Copyright (C) 2018 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pwsafe
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/golang/glog"
+
+	pkgalan "github.com/nlamirault/alan/pkg/alan"
+)
+
+// Provider exposes a Password Safe database as a password manager storage.
+// Written entries are matched by UUID, then by path. Updated entries keep
+// their previous password into their history.
+type Provider struct {
+	client    *Client
+	overwrite bool
+	modified  bool
+}
+
+// NewProvider creates a provider for the database of the client.
+// Using overwrite, an existing database is replaced by a new one.
+func NewProvider(client *Client, overwrite bool) *Provider {
+	return &Provider{
+		client:    client,
+		overwrite: overwrite,
+	}
+}
+
+// Open decodes the database, or creates a new one if it doesn't exist
+func (provider *Provider) Open() error {
+	if _, err := os.Stat(provider.client.filename); err == nil && !provider.overwrite {
+		return provider.client.Open()
+	}
+	glog.V(1).Infof("Create database: %s", provider.client.filename)
+	provider.modified = true
+	return provider.client.Create()
+}
+
+// Load returns the tree of groups of the database
+func (provider *Provider) Load() (*pkgalan.Group, error) {
+	return provider.client.Load()
+}
+
+// Read returns the secret of an entry, or nil if it doesn't exist
+func (provider *Provider) Read(path string) (*pkgalan.Secret, error) {
+	index := provider.client.findRecord(path, "")
+	if index < 0 {
+		return nil, nil
+	}
+	secret := toSecret(provider.client.db.Records[index])
+	return &secret, nil
+}
+
+// Write creates or updates an entry
+func (provider *Provider) Write(path string, secret pkgalan.Secret) error {
+	names := pkgalan.SplitPath(path)
+	if len(names) == 0 {
+		return fmt.Errorf("Invalid path: %s", path)
+	}
+	db := provider.client.db
+	record := &Record{}
+	if index := provider.client.findRecord(path, secret.UUID); index >= 0 {
+		record = db.Records[index]
+	} else {
+		db.Records = append(db.Records, record)
+	}
+	glog.V(1).Infof("Write entry: %s", path)
+	group := names[:len(names)-1]
+	updateRecord(record, group, secret)
+	provider.removeEmptyGroups(group)
+	provider.modified = true
+	return nil
+}
+
+// Delete removes an entry
+func (provider *Provider) Delete(path string) error {
+	index := provider.client.findRecord(path, "")
+	if index < 0 {
+		return fmt.Errorf("No entry for path %s", path)
+	}
+	glog.V(1).Infof("Delete entry: %s", path)
+	db := provider.client.db
+	db.Records = append(db.Records[:index], db.Records[index+1:]...)
+	provider.modified = true
+	return nil
+}
+
+// CreateGroup keeps an empty group into the header of the database
+func (provider *Provider) CreateGroup(path string) error {
+	names := pkgalan.SplitPath(path)
+	if len(names) == 0 {
+		return nil
+	}
+	for _, record := range provider.client.db.Records {
+		if isSubgroup(splitGroup(record.GetText(FieldGroup)), names) {
+			return nil
+		}
+	}
+	emptyGroups := provider.client.db.Header.GetAll(HeaderEmptyGroups)
+	for _, data := range emptyGroups {
+		if isSubgroup(splitGroup(string(data)), names) {
+			return nil
+		}
+	}
+	provider.client.db.Header.SetAll(HeaderEmptyGroups, append(emptyGroups, []byte(joinGroup(names))))
+	provider.modified = true
+	return nil
+}
+
+// removeEmptyGroups removes the empty groups containing the group
+func (provider *Provider) removeEmptyGroups(group []string) {
+	emptyGroups := [][]byte{}
+	for _, data := range provider.client.db.Header.GetAll(HeaderEmptyGroups) {
+		if !isSubgroup(group, splitGroup(string(data))) {
+			emptyGroups = append(emptyGroups, data)
+		}
+	}
+	provider.client.db.Header.SetAll(HeaderEmptyGroups, emptyGroups)
+}
+
+// isSubgroup returns true if the group is the parent group or one of its subgroups
+func isSubgroup(group []string, parent []string) bool {
+	if len(group) < len(parent) {
+		return false
+	}
+	return strings.Join(group[:len(parent)], "\x00") == strings.Join(parent, "\x00")
+}
+
+// Discard drops the changes not saved yet
+func (provider *Provider) Discard() {
+	provider.modified = false
+}
+
+// Close saves the database if it was modified
+func (provider *Provider) Close() error {
+	if provider.modified {
+		if err := provider.client.Save(); err != nil {
+			return err
+		}
+		provider.modified = false
+	}
+	return provider.client.Close()
+}
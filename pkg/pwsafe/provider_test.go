@@ -0,0 +1,149 @@
+// Copyright (C) 2018 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pwsafe
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	pkgalan "github.com/nlamirault/alan/pkg/alan"
+)
+
+func Test_Format(t *testing.T) {
+	db := NewDatabase()
+	db.Iterations = minIterations
+	record := &Record{}
+	record.SetText(FieldTitle, "Github")
+	record.SetText(FieldNotes, "a note longer than a single block of the database")
+	record.Set(0x0e, []byte("\\u\\t\\p\\n"))
+	db.Records = append(db.Records, record)
+
+	var buffer bytes.Buffer
+	if err := db.Encode(&buffer, "turing"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Decode(bytes.NewReader(buffer.Bytes()), "enigma"); err == nil {
+		t.Fatalf("Decoded with an invalid password")
+	}
+	content := buffer.Bytes()
+	content[160] ^= 0xff
+	if _, err := Decode(bytes.NewReader(content), "turing"); err == nil {
+		t.Fatalf("Decoded a corrupted database")
+	}
+	content[160] ^= 0xff
+	decoded, err := Decode(bytes.NewReader(content), "turing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded.Header.Fields, db.Header.Fields) || !reflect.DeepEqual(decoded.Records, db.Records) {
+		t.Fatalf("Invalid database: %#v", decoded)
+	}
+}
+
+func Test_PasswordHistory(t *testing.T) {
+	history := []pkgalan.PasswordChange{
+		{Password: "enigma", Changed: time.Unix(1525255965, 0).UTC()},
+		{Password: "bömbe"},
+	}
+	text := formatHistory(history)
+	if expected := "105025ae98f1d0006enigma000000000005bömbe"; text != expected {
+		t.Fatalf("Invalid history: %s", text)
+	}
+	if parsed := parseHistory(text); !reflect.DeepEqual(parsed, history) {
+		t.Fatalf("Invalid parsed history: %v", parsed)
+	}
+}
+
+func Test_Provider(t *testing.T) {
+	dir, err := ioutil.TempDir("", "alan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	password := func() (string, error) { return "turing", nil }
+	client, _ := NewClient(filepath.Join(dir, "alan.psafe3"), password)
+	provider := NewProvider(client, false)
+	if err := provider.Open(); err != nil {
+		t.Fatal(err)
+	}
+	client.db.Iterations = minIterations
+	writes := map[string]pkgalan.Secret{
+		"Dev/Github":        {Title: "Github", Username: "alan", Password: "enigma", Notes: "two\nlines"},
+		"Dev/v1.0/Gitlab":   {Title: "Gitlab", Password: "bombe", Fields: []pkgalan.Field{{Name: EmailField, Value: "alan@bletchley.uk"}}},
+		"Social/Twitter":    {Title: "Twitter", Password: "turing"},
+		"Social/Mastodon":   {Title: "Mastodon"},
+		"Work/Servers/db01": {Title: "db01"},
+	}
+	for path, secret := range writes {
+		if err := provider.Write(path, secret); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := provider.CreateGroup("Home/Empty"); err != nil {
+		t.Fatal(err)
+	}
+	if err := provider.CreateGroup("Work/Empty"); err != nil {
+		t.Fatal(err)
+	}
+	if err := provider.Delete("Social/Mastodon"); err != nil {
+		t.Fatal(err)
+	}
+	if err := provider.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	client, _ = NewClient(client.filename, password)
+	provider = NewProvider(client, false)
+	if err := provider.Open(); err != nil {
+		t.Fatal(err)
+	}
+	if err := provider.Write("Dev/Github", pkgalan.Secret{Title: "Github", Username: "alan", Password: "bletchley"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := provider.Write("Home/Empty/Mail", pkgalan.Secret{Title: "Mail"}); err != nil {
+		t.Fatal(err)
+	}
+	index := client.findRecord("Dev/v1.0/Gitlab", "")
+	if group := client.db.Records[index].GetText(FieldGroup); group != `Dev.v1\.0` {
+		t.Fatalf("Invalid group: %s", group)
+	}
+	tree, err := provider.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	groups, secrets := tree.Index()
+	if len(secrets) != 5 || secrets["Dev/v1.0/Gitlab"].Fields[0].Value != "alan@bletchley.uk" ||
+		secrets["Dev/Github"].Password != "bletchley" || secrets["Dev/Github"].Notes != "" {
+		t.Fatalf("Invalid secrets: %v", secrets)
+	}
+	if history := secrets["Dev/Github"].PasswordHistory; len(history) != 1 || history[0].Password != "enigma" {
+		t.Fatalf("Invalid history: %v", history)
+	}
+	if _, ok := groups["Work/Empty"]; !ok || len(client.db.Header.GetAll(HeaderEmptyGroups)) != 1 {
+		t.Fatalf("Invalid groups: %v", groups)
+	}
+	if secret, _ := provider.Read("Social/Mastodon"); secret != nil {
+		t.Fatalf("Deleted secret: %v", secret)
+	}
+	if err := provider.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,214 @@
+// Copyright (C) 2018 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/golang/glog"
+
+	pkgalan "github.com/nlamirault/alan/pkg/alan"
+)
+
+// MaxChunkSize is the maximum size of the attachments stored into their secret.
+// Once it is reached, attachments are split into chunks of this size, each one
+// into its own secret, to stay below the Vault request size limit.
+var MaxChunkSize = 1 << 20
+
+// writeAttachments returns the description of the attachments to store into
+// the secret, and the paths of the chunks written. Small attachments are
+// embedded while their total size fits, others are written in chunks under
+// the attachments folder. The chunks of each write have their own folder,
+// referenced by the description, so that the chunks of the previous versions
+// are never overwritten.
+func (client *Client) writeAttachments(key string, attachments []pkgalan.Attachment) ([]map[string]interface{}, []string, error) {
+	result := []map[string]interface{}{}
+	written := []string{}
+	embedded := 0
+	for _, attachment := range attachments {
+		description := map[string]interface{}{
+			"Name": attachment.Name,
+			"Size": len(attachment.Content),
+		}
+		if embedded+len(attachment.Content) <= MaxChunkSize {
+			embedded += len(attachment.Content)
+			description["Data"] = base64.StdEncoding.EncodeToString(attachment.Content)
+			result = append(result, description)
+			continue
+		}
+		folder := newChunkFolder()
+		chunks := 0
+		for offset := 0; offset < len(attachment.Content); offset += MaxChunkSize {
+			end := offset + MaxChunkSize
+			if end > len(attachment.Content) {
+				end = len(attachment.Content)
+			}
+			glog.V(2).Infof("Write attachment chunk: %s %s %d", key, attachment.Name, chunks)
+			path := attachmentChunkPath(key, folder, chunks)
+			err := client.writeData(path, map[string]interface{}{
+				"Data": base64.StdEncoding.EncodeToString(attachment.Content[offset:end]),
+			}, nil)
+			if err != nil {
+				return nil, written, err
+			}
+			written = append(written, path)
+			chunks++
+		}
+		description["Folder"] = folder
+		description["Chunks"] = chunks
+		result = append(result, description)
+	}
+	return result, written, nil
+}
+
+// readAttachments decodes the attachments described into the secret data
+func (client *Client) readAttachments(key string, data map[string]interface{}) ([]pkgalan.Attachment, error) {
+	descriptions, _ := data[pkgalan.Attachments].([]interface{})
+	attachments := []pkgalan.Attachment{}
+	for i, value := range descriptions {
+		description, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("Invalid attachment %d for %s", i, key)
+		}
+		size, err := toInt(description["Size"])
+		if err != nil {
+			return nil, err
+		}
+		chunks, err := toInt(description["Chunks"])
+		if err != nil {
+			return nil, err
+		}
+		attachment := pkgalan.Attachment{
+			Name: toString(description["Name"]),
+		}
+		if chunks == 0 {
+			if attachment.Content, err = base64.StdEncoding.DecodeString(toString(description["Data"])); err != nil {
+				return nil, err
+			}
+		}
+		for chunk := 0; chunk < chunks; chunk++ {
+			glog.V(2).Infof("Read attachment chunk: %s %s %d", key, attachment.Name, chunk)
+			chunkData, err := client.Read(attachmentChunkPath(key, chunkFolder(i, description), chunk))
+			if err != nil {
+				return nil, err
+			}
+			content, err := base64.StdEncoding.DecodeString(toString(chunkData["Data"]))
+			if err != nil {
+				return nil, err
+			}
+			attachment.Content = append(attachment.Content, content...)
+		}
+		if len(attachment.Content) != size {
+			return nil, fmt.Errorf("Invalid size for attachment %s of %s: %d, expected %d",
+				attachment.Name, key, len(attachment.Content), size)
+		}
+		attachments = append(attachments, attachment)
+	}
+	return attachments, nil
+}
+
+// attachmentChunks returns the paths of the chunks of the attachments
+// described into the secret data
+func attachmentChunks(key string, data map[string]interface{}) []string {
+	descriptions, _ := data[pkgalan.Attachments].([]interface{})
+	paths := []string{}
+	for i, value := range descriptions {
+		description, _ := value.(map[string]interface{})
+		count, _ := toInt(description["Chunks"])
+		for chunk := 0; chunk < count; chunk++ {
+			paths = append(paths, attachmentChunkPath(key, chunkFolder(i, description), chunk))
+		}
+	}
+	return paths
+}
+
+// secretChunks returns the paths of all the chunks stored for a secret,
+// whatever the version which uses them
+func (client *Client) secretChunks(key string) ([]string, error) {
+	dir, name := path.Split(key)
+	paths := []string{}
+	var list func(folder string) error
+	list = func(folder string) error {
+		data, err := client.list(folder)
+		if err != nil || data == nil {
+			return err
+		}
+		keys, _ := data["keys"].([]interface{})
+		for _, value := range keys {
+			child := toString(value)
+			if strings.HasSuffix(child, pkgalan.PathSeparator) {
+				if err := list(pkgalan.JoinPath(folder, child)); err != nil {
+					return err
+				}
+				continue
+			}
+			paths = append(paths, pkgalan.JoinPath(folder, child))
+		}
+		return nil
+	}
+	if err := list(pkgalan.JoinPath(dir, pkgalan.AttachmentsFolder, name)); err != nil {
+		return nil, err
+	}
+	return paths, nil
+}
+
+// removeChunks removes attachment chunks. Using a KV version 2 secrets engine,
+// all their versions are removed.
+func (client *Client) removeChunks(paths []string) error {
+	kvVersion, err := client.kvVersion()
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		glog.V(2).Infof("Remove attachment chunk: %s", path)
+		if kvVersion == 2 {
+			_, err = client.vault.Logical().Delete(client.metadataPath(path))
+		} else {
+			err = client.deleteData(path)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// chunkFolder returns the folder of the chunks of an attachment. Attachments
+// written before the chunk folders use their index.
+func chunkFolder(index int, description map[string]interface{}) string {
+	if folder := toString(description["Folder"]); len(folder) > 0 {
+		return folder
+	}
+	return strconv.Itoa(index)
+}
+
+// newChunkFolder returns a random name for the chunks of an attachment
+func newChunkFolder() string {
+	folder := make([]byte, 8)
+	rand.Read(folder)
+	return hex.EncodeToString(folder)
+}
+
+// attachmentChunkPath returns the path of a chunk: <folder>/.attachments/<secret>/<chunk folder>/<chunk>
+func attachmentChunkPath(key string, folder string, chunk int) string {
+	dir, name := path.Split(key)
+	return pkgalan.JoinPath(dir, pkgalan.AttachmentsFolder, name, folder, strconv.Itoa(chunk))
+}
@@ -0,0 +1,254 @@
+// Copyright (C) 2018 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/golang/glog"
+	vaultapi "github.com/hashicorp/vault/api"
+	homedir "github.com/mitchellh/go-homedir"
+)
+
+const (
+	// AuthToken uses an existing Vault token
+	AuthToken = "token"
+	// AuthUserpass uses the username & password auth method
+	AuthUserpass = "userpass"
+	// AuthLDAP uses the LDAP auth method
+	AuthLDAP = "ldap"
+	// AuthAppRole uses the AppRole auth method
+	AuthAppRole = "approle"
+	// AuthCert uses the TLS certificates auth method
+	AuthCert = "cert"
+	// AuthKubernetes uses the Kubernetes auth method
+	AuthKubernetes = "kubernetes"
+
+	// DefaultKubernetesTokenPath is the service account token mounted into pods
+	DefaultKubernetesTokenPath = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+	tokenHelperFile = ".vault-token"
+)
+
+// AuthMethods lists the supported authentication methods
+var AuthMethods = []string{
+	AuthToken,
+	AuthUserpass,
+	AuthLDAP,
+	AuthAppRole,
+	AuthCert,
+	AuthKubernetes,
+}
+
+// Authenticator performs a login against Vault and returns a client token
+type Authenticator interface {
+	Login(client *vaultapi.Client) (string, error)
+}
+
+// TokenAuth authenticates using an existing token.
+// If Token is empty, the VAULT_TOKEN environment variable then the
+// ~/.vault-token file written by the Vault CLI are used.
+type TokenAuth struct {
+	Token string
+}
+
+// Login checks the token against the Vault server
+func (auth *TokenAuth) Login(client *vaultapi.Client) (string, error) {
+	token := auth.Token
+	if len(token) == 0 {
+		var err error
+		token, err = LookupToken()
+		if err != nil {
+			return "", err
+		}
+	}
+	if len(token) == 0 {
+		return "", fmt.Errorf("No Vault token found")
+	}
+	client.SetToken(token)
+	if _, err := client.Auth().Token().LookupSelf(); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// LookupToken retrieve the token from the environment or the Vault CLI token helper file
+func LookupToken() (string, error) {
+	if token := os.Getenv(vaultapi.EnvVaultToken); len(token) > 0 {
+		glog.V(2).Infof("Use token from %s", vaultapi.EnvVaultToken)
+		return token, nil
+	}
+	home, err := homedir.Dir()
+	if err != nil {
+		return "", err
+	}
+	filename := filepath.Join(home, tokenHelperFile)
+	data, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	glog.V(2).Infof("Use token from %s", filename)
+	return strings.TrimSpace(string(data)), nil
+}
+
+// UserpassAuth authenticates using the userpass auth method
+type UserpassAuth struct {
+	Mount    string
+	Username string
+	Password string
+}
+
+// Login performs authentication using username and password
+func (auth *UserpassAuth) Login(client *vaultapi.Client) (string, error) {
+	return passwordLogin(client, mountOrDefault(auth.Mount, AuthUserpass), auth.Username, auth.Password)
+}
+
+// LDAPAuth authenticates using the LDAP auth method
+type LDAPAuth struct {
+	Mount    string
+	Username string
+	Password string
+}
+
+// Login performs authentication using LDAP credentials
+func (auth *LDAPAuth) Login(client *vaultapi.Client) (string, error) {
+	return passwordLogin(client, mountOrDefault(auth.Mount, AuthLDAP), auth.Username, auth.Password)
+}
+
+// AppRoleAuth authenticates using the AppRole auth method.
+// If Wrapped is true, SecretID is a response-wrapping token which is
+// unwrapped to obtain the real secret ID.
+type AppRoleAuth struct {
+	Mount    string
+	RoleID   string
+	SecretID string
+	Wrapped  bool
+}
+
+// Login performs authentication using a role ID and a secret ID
+func (auth *AppRoleAuth) Login(client *vaultapi.Client) (string, error) {
+	if len(auth.RoleID) == 0 {
+		return "", fmt.Errorf("Missing AppRole role ID")
+	}
+	secretID := auth.SecretID
+	if auth.Wrapped {
+		glog.V(2).Info("Unwrap AppRole secret ID")
+		unwrapped, err := client.Logical().Unwrap(auth.SecretID)
+		if err != nil {
+			return "", err
+		}
+		if unwrapped == nil {
+			return "", fmt.Errorf("No secret ID in wrapped response")
+		}
+		value, ok := unwrapped.Data["secret_id"].(string)
+		if !ok {
+			return "", fmt.Errorf("No secret ID in wrapped response")
+		}
+		secretID = value
+		client.ClearToken()
+	}
+	options := map[string]interface{}{
+		"role_id": auth.RoleID,
+	}
+	if len(secretID) > 0 {
+		options["secret_id"] = secretID
+	}
+	return login(client, fmt.Sprintf("auth/%s/login", mountOrDefault(auth.Mount, AuthAppRole)), options)
+}
+
+// CertAuth authenticates using the TLS certificates auth method.
+// The client certificate and key of the Config are presented by the transport.
+type CertAuth struct {
+	Mount string
+	Name  string
+}
+
+// Login performs authentication using the client certificate
+func (auth *CertAuth) Login(client *vaultapi.Client) (string, error) {
+	options := map[string]interface{}{}
+	if len(auth.Name) > 0 {
+		options["name"] = auth.Name
+	}
+	return login(client, fmt.Sprintf("auth/%s/login", mountOrDefault(auth.Mount, AuthCert)), options)
+}
+
+// KubernetesAuth authenticates using a Kubernetes service account token.
+// If JWT is empty, the token is read from TokenPath.
+type KubernetesAuth struct {
+	Mount     string
+	Role      string
+	JWT       string
+	TokenPath string
+}
+
+// Login performs authentication using the service account token
+func (auth *KubernetesAuth) Login(client *vaultapi.Client) (string, error) {
+	if len(auth.Role) == 0 {
+		return "", fmt.Errorf("Missing Kubernetes role")
+	}
+	jwt := auth.JWT
+	if len(jwt) == 0 {
+		tokenPath := auth.TokenPath
+		if len(tokenPath) == 0 {
+			tokenPath = DefaultKubernetesTokenPath
+		}
+		data, err := ioutil.ReadFile(tokenPath)
+		if err != nil {
+			return "", err
+		}
+		jwt = strings.TrimSpace(string(data))
+	}
+	options := map[string]interface{}{
+		"role": auth.Role,
+		"jwt":  jwt,
+	}
+	return login(client, fmt.Sprintf("auth/%s/login", mountOrDefault(auth.Mount, AuthKubernetes)), options)
+}
+
+func passwordLogin(client *vaultapi.Client, mount string, username string, password string) (string, error) {
+	if len(username) == 0 {
+		return "", fmt.Errorf("Missing username for %s authentication", mount)
+	}
+	options := map[string]interface{}{
+		"password": password,
+	}
+	return login(client, fmt.Sprintf("auth/%s/login/%s", mount, username), options)
+}
+
+func login(client *vaultapi.Client, path string, options map[string]interface{}) (string, error) {
+	glog.V(2).Infof("Login using: %s", path)
+	secret, err := client.Logical().Write(path, options)
+	if err != nil {
+		return "", err
+	}
+	if secret == nil || secret.Auth == nil {
+		return "", fmt.Errorf("No authentication information from %s", path)
+	}
+	return secret.Auth.ClientToken, nil
+}
+
+func mountOrDefault(mount string, method string) string {
+	if len(mount) == 0 {
+		return method
+	}
+	return strings.Trim(mount, "/")
+}
@@ -0,0 +1,108 @@
+// Copyright (C) 2018 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	vaultapi "github.com/hashicorp/vault/api"
+)
+
+func newTestAuthServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := map[string]interface{}{}
+		json.NewDecoder(r.Body).Decode(&body)
+		switch r.URL.Path {
+		case "/v1/auth/userpass/login/alan", "/v1/auth/corp-ldap/login/alan":
+			if body["password"] != "turing" {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprint(w, `{"errors":["invalid username or password"]}`)
+				return
+			}
+			fmt.Fprint(w, `{"auth":{"client_token":"password-token"}}`)
+		case "/v1/sys/wrapping/unwrap":
+			if r.Header.Get("X-Vault-Token") != "wrapping-token" {
+				fmt.Fprint(w, `{"data":{"token":"not-a-secret-id"}}`)
+				return
+			}
+			fmt.Fprint(w, `{"data":{"secret_id":"unwrapped-secret"}}`)
+		case "/v1/auth/approle/login":
+			if body["role_id"] != "role" || body["secret_id"] != "unwrapped-secret" {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprint(w, `{"errors":["invalid secret id"]}`)
+				return
+			}
+			fmt.Fprint(w, `{"auth":{"client_token":"approle-token"}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func newTestAPIClient(t *testing.T, address string) *vaultapi.Client {
+	client, err := vaultapi.NewClient(&vaultapi.Config{Address: address})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.ClearToken()
+	return client
+}
+
+func Test_AuthenticatorsLogin(t *testing.T) {
+	server := newTestAuthServer(t)
+	defer server.Close()
+
+	tests := []struct {
+		auth  Authenticator
+		token string
+	}{
+		{&UserpassAuth{Username: "alan", Password: "turing"}, "password-token"},
+		{&LDAPAuth{Mount: "/corp-ldap/", Username: "alan", Password: "turing"}, "password-token"},
+		{&AppRoleAuth{RoleID: "role", SecretID: "wrapping-token", Wrapped: true}, "approle-token"},
+	}
+	for _, test := range tests {
+		token, err := test.auth.Login(newTestAPIClient(t, server.URL))
+		if err != nil {
+			t.Fatalf("%T: %s", test.auth, err)
+		}
+		if token != test.token {
+			t.Fatalf("%T: invalid token %s", test.auth, token)
+		}
+	}
+}
+
+func Test_UserpassAuthInvalidPassword(t *testing.T) {
+	server := newTestAuthServer(t)
+	defer server.Close()
+
+	auth := &UserpassAuth{Username: "alan", Password: "enigma"}
+	if _, err := auth.Login(newTestAPIClient(t, server.URL)); err == nil {
+		t.Fatal("Expected an authentication error")
+	}
+}
+
+func Test_AppRoleAuthInvalidWrappedResponse(t *testing.T) {
+	server := newTestAuthServer(t)
+	defer server.Close()
+
+	auth := &AppRoleAuth{RoleID: "role", SecretID: "other-token", Wrapped: true}
+	if _, err := auth.Login(newTestAPIClient(t, server.URL)); err == nil {
+		t.Fatal("Expected an error for a wrapped response without secret ID")
+	}
+}
@@ -18,6 +18,10 @@ import (
 	"crypto/tls"
 	"fmt"
 	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/golang/glog"
 	vaultapi "github.com/hashicorp/vault/api"
@@ -28,69 +32,224 @@ import (
 const (
 	// DefaultAddr define the default Vault URL
 	DefaultAddr = "http://127.0.0.1:8200"
+
+	// DefaultMount define the default KV secrets engine mount
+	DefaultMount = "secret"
+
+	// DefaultPrefix define the default path for alan secrets into the mount
+	DefaultPrefix = "alan"
 )
 
+// Config define the Vault client settings
+type Config struct {
+	// Address is the Vault server URL
+	Address string
+
+	// Mount is the path of the KV secrets engine
+	Mount string
+
+	// Prefix is the path of the alan secrets into the mount.
+	// It is a Go template which can use the fields of PrefixData.
+	Prefix string
+
+	// CACert is the path to a PEM-encoded CA certificate file used to verify
+	// the Vault server certificate
+	CACert string
+
+	// CAPath is the path to a directory of PEM-encoded CA certificate files
+	CAPath string
+
+	// ClientCert is the path to the client certificate presented to the Vault
+	// server, used by the cert authentication method
+	ClientCert string
+
+	// ClientKey is the path to the private key of the client certificate
+	ClientKey string
+
+	// TLSServerName is used to set the SNI host when connecting via TLS
+	TLSServerName string
+
+	// TLSSkipVerify disables the verification of the Vault server certificate.
+	// This is insecure and must only be used for development.
+	TLSSkipVerify bool
+}
+
+// NewConfig returns a configuration using the default settings, overridden
+// by the standard Vault environment variables (VAULT_ADDR, VAULT_CACERT,
+// VAULT_CAPATH, VAULT_CLIENT_CERT, VAULT_CLIENT_KEY, VAULT_TLS_SERVER_NAME
+// and VAULT_SKIP_VERIFY)
+func NewConfig() *Config {
+	config := &Config{
+		Address:       DefaultAddr,
+		Mount:         DefaultMount,
+		Prefix:        DefaultPrefix,
+		CACert:        os.Getenv(vaultapi.EnvVaultCACert),
+		CAPath:        os.Getenv(vaultapi.EnvVaultCAPath),
+		ClientCert:    os.Getenv(vaultapi.EnvVaultClientCert),
+		ClientKey:     os.Getenv(vaultapi.EnvVaultClientKey),
+		TLSServerName: os.Getenv(vaultapi.EnvVaultTLSServerName),
+	}
+	if addr := os.Getenv(vaultapi.EnvVaultAddress); len(addr) > 0 {
+		config.Address = addr
+	}
+	if v := os.Getenv(vaultapi.EnvVaultInsecure); len(v) > 0 {
+		insecure, err := strconv.ParseBool(v)
+		if err != nil {
+			glog.Warningf("Invalid value for %s: %s", vaultapi.EnvVaultInsecure, v)
+		}
+		config.TLSSkipVerify = insecure
+	}
+	return config
+}
+
 // Client is the Client for the REST API of Vault
 type Client struct {
-	vault    *vaultapi.Client
-	username string
-	password string
+	vault     *vaultapi.Client
+	auth      Authenticator
+	mount     string
+	prefix    string
+	kvversion int
 }
 
 // NewClient creates a client to manage Vault entities
-func NewClient(vaultAddr string, username string, password string) (*Client, error) {
-	glog.V(2).Infof("Setup using Vault server: %s %s", vaultAddr, username)
-	transport := &http.Transport{}
-	transport = &http.Transport{
-		TLSClientConfig: &tls.Config{
-			InsecureSkipVerify: true,
-		},
-	}
-	vaultConfig := vaultapi.Config{
-		Address: vaultAddr,
-		HttpClient: &http.Client{
-			Transport: transport,
-		},
-	}
-	client, err := vaultapi.NewClient(&vaultConfig)
+func NewClient(config *Config, auth Authenticator) (*Client, error) {
+	glog.V(2).Infof("Setup using Vault server: %s %s/%s", config.Address, config.Mount, config.Prefix)
+	if len(strings.Trim(config.Mount, "/")) == 0 {
+		return nil, fmt.Errorf("Missing Vault mount")
+	}
+	if _, ok := auth.(*CertAuth); ok && (len(config.ClientCert) == 0 || len(config.ClientKey) == 0) {
+		return nil, fmt.Errorf("Client certificate and key are required for cert authentication")
+	}
+	vaultConfig := vaultapi.DefaultConfig()
+	if vaultConfig.Error != nil {
+		return nil, vaultConfig.Error
+	}
+	vaultConfig.Address = config.Address
+
+	// Only use the given settings, not the ones read from the environment
+	// by the default configuration
+	transport := vaultConfig.HttpClient.Transport.(*http.Transport)
+	transport.TLSClientConfig = &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		NextProtos: transport.TLSClientConfig.NextProtos,
+	}
+	if config.TLSSkipVerify {
+		glog.Warning("TLS verification of the Vault server is disabled")
+	}
+	if err := vaultConfig.ConfigureTLS(&vaultapi.TLSConfig{
+		CACert:        config.CACert,
+		CAPath:        config.CAPath,
+		ClientCert:    config.ClientCert,
+		ClientKey:     config.ClientKey,
+		TLSServerName: config.TLSServerName,
+		Insecure:      config.TLSSkipVerify,
+	}); err != nil {
+		return nil, err
+	}
+	client, err := vaultapi.NewClient(vaultConfig)
 	if err != nil {
 		return nil, err
 	}
 	return &Client{
-		vault:    client,
-		username: username,
-		password: password,
+		vault:  client,
+		auth:   auth,
+		mount:  strings.Trim(config.Mount, "/"),
+		prefix: config.Prefix,
 	}, nil
 }
 
 // Login performs authentication with the Vault server
 func (client *Client) Login() error {
-	glog.V(2).Infof("Do authentication to the Vault using: %s", client.username)
-	options := map[string]interface{}{
-		"password": client.password,
-	}
-
-	// the login path
-	path := fmt.Sprintf("auth/userpass/login/%s", client.username)
-	secret, err := client.vault.Logical().Write(path, options)
+	glog.V(2).Infof("Do authentication to the Vault using: %T", client.auth)
+	token, err := client.auth.Login(client.vault)
 	if err != nil {
 		return err
 	}
-	client.vault.SetToken(secret.Auth.ClientToken)
-	return nil
+	client.vault.SetToken(token)
+	return client.resolvePrefix()
+}
+
+// Mount returns the path of the KV secrets engine
+func (client *Client) Mount() string {
+	return client.mount
+}
+
+// Prefix returns the path of the alan secrets into the mount
+func (client *Client) Prefix() string {
+	return client.prefix
 }
 
 // Write create a new secret
 func (client *Client) Write(key string, secret pkgalan.Secret) error {
-	glog.V(2).Infof("Write secret: %s %s", key, secret)
-	path := fmt.Sprintf("/secret/alan/%s", key)
-	_, err := client.vault.Logical().Write(path,
-		map[string]interface{}{
-			"Title":    secret.Title,
-			"URL":      secret.URL,
-			"UserName": secret.Username,
-			"Password": secret.Password,
-		})
+	return client.write(key, secret, nil)
+}
+
+// WriteCAS create or update a secret only if its current version is the
+// given one. A version of 0 allows the write only if the secret doesn't exist.
+// Check-and-set requires a KV version 2 secrets engine.
+func (client *Client) WriteCAS(key string, secret pkgalan.Secret, version int) error {
+	kvVersion, err := client.kvVersion()
+	if err != nil {
+		return err
+	}
+	if kvVersion != 2 {
+		return fmt.Errorf("Check-and-set requires a KV version 2 secrets engine")
+	}
+	return client.write(key, secret, map[string]interface{}{
+		"cas": version,
+	})
+}
+
+func (client *Client) write(key string, secret pkgalan.Secret, options map[string]interface{}) error {
+	glog.V(2).Infof("Write secret: %s %s", key, secret.Title)
+	kvVersion, err := client.kvVersion()
+	if err != nil {
+		return err
+	}
+	data := toData(secret)
+	previous, _, err := client.readVersion(key, 0)
+	if err != nil {
+		return err
+	}
+	attachments, chunks, err := client.writeAttachments(key, secret.Attachments)
+	if err == nil {
+		if len(attachments) > 0 {
+			data[pkgalan.Attachments] = attachments
+		}
+		err = client.writeData(key, data, options)
+	}
+	if err != nil {
+		// the chunks of a rejected write aren't used by any version
+		if err := client.removeChunks(chunks); err != nil {
+			glog.Warningf("Can't remove the attachment chunks of %s: %s", key, err)
+		}
+		return err
+	}
+	if kvVersion == 2 {
+		// the previous versions still use their chunks
+		return nil
+	}
+	return client.removeChunks(attachmentChunks(key, previous))
+}
+
+func (client *Client) writeData(key string, data map[string]interface{}, options map[string]interface{}) error {
+	path, err := client.dataPath(key)
+	if err != nil {
+		return err
+	}
+	kvVersion, err := client.kvVersion()
+	if err != nil {
+		return err
+	}
+	if kvVersion == 2 {
+		data = map[string]interface{}{
+			"data": data,
+		}
+		if options != nil {
+			data["options"] = options
+		}
+	}
+	_, err = client.vault.Logical().Write(path, data)
 	if err != nil {
 		return err
 	}
@@ -99,28 +258,287 @@ func (client *Client) Write(key string, secret pkgalan.Secret) error {
 
 // Read retrieve a secret
 func (client *Client) Read(key string) (map[string]interface{}, error) {
-	glog.V(2).Infof("Read secret: %s ", key)
-	path := fmt.Sprintf("/secret/alan/%s", key)
-	secret, err := client.vault.Logical().Read(path)
+	return client.ReadVersion(key, 0)
+}
+
+// ReadSecret retrieve a secret using the alan fields
+func (client *Client) ReadSecret(key string) (*pkgalan.Secret, error) {
+	return client.ReadSecretVersion(key, 0)
+}
+
+// ReadSecretVersion retrieve a version of a secret using the alan fields
+func (client *Client) ReadSecretVersion(key string, version int) (*pkgalan.Secret, error) {
+	data, info, err := client.readVersion(key, version)
 	if err != nil {
 		return nil, err
 	}
-	if secret == nil {
+	if data == nil {
 		return nil, fmt.Errorf("No secret for path %s", key)
 	}
-	return secret.Data, nil
+	return client.toSecret(key, data, info)
+}
+
+// toSecret decodes the secret data, with its attachments.
+// The modification time is the creation time of the version, if known.
+func (client *Client) toSecret(key string, data map[string]interface{}, info *SecretVersion) (*pkgalan.Secret, error) {
+	secret := toSecret(data)
+	attachments, err := client.readAttachments(key, data)
+	if err != nil {
+		return nil, err
+	}
+	secret.Attachments = attachments
+	if info != nil {
+		secret.Modified = info.CreatedTime
+	}
+	return secret, nil
+}
+
+func toData(secret pkgalan.Secret) map[string]interface{} {
+	data := map[string]interface{}{
+		pkgalan.Title:    secret.Title,
+		pkgalan.URL:      secret.URL,
+		pkgalan.Username: secret.Username,
+		pkgalan.Password: secret.Password,
+	}
+	if len(secret.Notes) > 0 {
+		data[pkgalan.Notes] = secret.Notes
+	}
+	if len(secret.UUID) > 0 {
+		data[pkgalan.UUID] = secret.UUID
+	}
+	if len(secret.Tags) > 0 {
+		data[pkgalan.Tags] = secret.Tags
+	}
+	if len(secret.Fields) > 0 {
+		fields := []map[string]interface{}{}
+		for _, field := range secret.Fields {
+			fields = append(fields, map[string]interface{}{
+				"Name":      field.Name,
+				"Value":     field.Value,
+				"Protected": field.Protected,
+			})
+		}
+		data[pkgalan.Fields] = fields
+	}
+	if len(secret.PasswordHistory) > 0 {
+		history := []map[string]interface{}{}
+		for _, change := range secret.PasswordHistory {
+			value := map[string]interface{}{"Password": change.Password}
+			if !change.Changed.IsZero() {
+				value["Changed"] = change.Changed.UTC().Format(time.RFC3339)
+			}
+			history = append(history, value)
+		}
+		data[pkgalan.PasswordHistory] = history
+	}
+	return data
+}
+
+func toSecret(data map[string]interface{}) *pkgalan.Secret {
+	secret := &pkgalan.Secret{
+		UUID:     toString(data[pkgalan.UUID]),
+		Title:    toString(data[pkgalan.Title]),
+		Username: toString(data[pkgalan.Username]),
+		Password: toString(data[pkgalan.Password]),
+		URL:      toString(data[pkgalan.URL]),
+		Notes:    toString(data[pkgalan.Notes]),
+	}
+	tags, _ := data[pkgalan.Tags].([]interface{})
+	for _, tag := range tags {
+		secret.Tags = append(secret.Tags, toString(tag))
+	}
+	fields, _ := data[pkgalan.Fields].([]interface{})
+	for _, value := range fields {
+		field, ok := value.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		protected, _ := field["Protected"].(bool)
+		secret.Fields = append(secret.Fields, pkgalan.Field{
+			Name:      toString(field["Name"]),
+			Value:     toString(field["Value"]),
+			Protected: protected,
+		})
+	}
+	history, _ := data[pkgalan.PasswordHistory].([]interface{})
+	for _, value := range history {
+		change, ok := value.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		changed, _ := time.Parse(time.RFC3339, toString(change["Changed"]))
+		secret.PasswordHistory = append(secret.PasswordHistory, pkgalan.PasswordChange{
+			Password: toString(change["Password"]),
+			Changed:  changed,
+		})
+	}
+	return secret
+}
+
+func toString(value interface{}) string {
+	if value == nil {
+		return ""
+	}
+	if text, ok := value.(string); ok {
+		return text
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+// ReadVersion retrieve a version of a secret. A version of 0 reads the
+// latest one. Versions require a KV version 2 secrets engine.
+func (client *Client) ReadVersion(key string, version int) (map[string]interface{}, error) {
+	data, _, err := client.readVersion(key, version)
+	if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		return nil, fmt.Errorf("No secret for path %s", key)
+	}
+	return data, nil
+}
+
+// readVersion retrieve a version of a secret, or nil if it doesn't exist.
+// Using a KV version 2 secrets engine, it also returns the version informations.
+func (client *Client) readVersion(key string, version int) (map[string]interface{}, *SecretVersion, error) {
+	glog.V(2).Infof("Read secret: %s %d", key, version)
+	path, err := client.dataPath(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	kvVersion, err := client.kvVersion()
+	if err != nil {
+		return nil, nil, err
+	}
+	if kvVersion != 2 {
+		if version > 0 {
+			return nil, nil, fmt.Errorf("Secret versions requires a KV version 2 secrets engine")
+		}
+		secret, err := client.vault.Logical().Read(path)
+		if err != nil || secret == nil {
+			return nil, nil, err
+		}
+		return secret.Data, nil, nil
+	}
+
+	secret, err := client.readWithParams(path, version)
+	if err != nil {
+		return nil, nil, err
+	}
+	if secret == nil || secret.Data["data"] == nil {
+		return nil, nil, nil
+	}
+	data, ok := secret.Data["data"].(map[string]interface{})
+	if !ok {
+		return nil, nil, fmt.Errorf("Invalid secret data for path %s", key)
+	}
+	metadata, _ := secret.Data["metadata"].(map[string]interface{})
+	info := &SecretVersion{
+		CreatedTime: toTime(metadata["created_time"]),
+	}
+	if info.Version, err = toInt(metadata["version"]); err != nil {
+		return nil, nil, err
+	}
+	return data, info, nil
 }
 
 // List retrieve some secrets
 func (client *Client) List(key string) (map[string]interface{}, error) {
-	glog.V(2).Infof("List secrets: %s ", key)
-	path := fmt.Sprintf("/secret/alan/%s", key)
-	secret, err := client.vault.Logical().List(path)
+	data, err := client.list(key)
 	if err != nil {
 		return nil, err
 	}
-	if secret == nil {
+	if data == nil {
 		return nil, fmt.Errorf("No secrets for path %s", key)
 	}
+	return data, nil
+}
+
+// list retrieve some secrets, or nil if the path doesn't exist
+func (client *Client) list(key string) (map[string]interface{}, error) {
+	glog.V(2).Infof("List secrets: %s ", key)
+	path, err := client.listPath(key)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := client.vault.Logical().List(path)
+	if err != nil || secret == nil {
+		return nil, err
+	}
 	return secret.Data, nil
 }
+
+// Delete removes a secret and its attachments.
+// Using a KV version 2 secrets engine, the latest version is deleted and can
+// be undeleted, so its attachments are kept.
+func (client *Client) Delete(key string) error {
+	glog.V(2).Infof("Delete secret: %s", key)
+	kvVersion, err := client.kvVersion()
+	if err != nil {
+		return err
+	}
+	data, _, err := client.readVersion(key, 0)
+	if err != nil {
+		return err
+	}
+	if data == nil {
+		return fmt.Errorf("No secret for path %s", key)
+	}
+	if kvVersion != 2 {
+		if err := client.removeChunks(attachmentChunks(key, data)); err != nil {
+			return err
+		}
+	}
+	return client.deleteData(key)
+}
+
+// Destroy removes a secret and its attachments. Using a KV version 2 secrets
+// engine, all their versions are removed.
+func (client *Client) Destroy(key string) error {
+	kvVersion, err := client.kvVersion()
+	if err != nil {
+		return err
+	}
+	if kvVersion != 2 {
+		return client.Delete(key)
+	}
+	glog.V(2).Infof("Destroy secret: %s", key)
+	chunks, err := client.secretChunks(key)
+	if err != nil {
+		return err
+	}
+	if err := client.removeChunks(chunks); err != nil {
+		return err
+	}
+	_, err = client.vault.Logical().Delete(client.metadataPath(key))
+	return err
+}
+
+func (client *Client) deleteData(key string) error {
+	path, err := client.dataPath(key)
+	if err != nil {
+		return err
+	}
+	_, err = client.vault.Logical().Delete(path)
+	return err
+}
+
+// readWithParams reads a path with the version query parameter, which isn't
+// supported by the logical API.
+func (client *Client) readWithParams(path string, version int) (*vaultapi.Secret, error) {
+	request := client.vault.NewRequest("GET", "/v1/"+path)
+	if version > 0 {
+		request.Params.Set("version", strconv.Itoa(version))
+	}
+	resp, err := client.vault.RawRequest(request)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	if resp != nil && resp.StatusCode == 404 {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return vaultapi.ParseSecret(resp.Body)
+}
@@ -0,0 +1,78 @@
+// Copyright (C) 2018 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_TLSConfiguration(t *testing.T) {
+	server := httptest.NewTLSServer(newFakeKV(2))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "alan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	caCert := filepath.Join(dir, "ca.pem")
+	certificate := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := ioutil.WriteFile(caCert, certificate, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		setup func(config *Config)
+		valid bool
+	}{
+		{"unknown authority", func(config *Config) {}, false},
+		{"ca certificate", func(config *Config) { config.CACert = caCert }, true},
+		{"skip verify", func(config *Config) { config.TLSSkipVerify = true }, true},
+	}
+	for _, test := range tests {
+		config := NewConfig()
+		config.Address = server.URL
+		config.CACert = ""
+		config.CAPath = ""
+		config.TLSSkipVerify = false
+		test.setup(config)
+		client, err := NewClient(config, &TokenAuth{Token: "test"})
+		if err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+		_, err = client.KVVersion()
+		if test.valid && err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+		if !test.valid && err == nil {
+			t.Fatalf("%s: expected a TLS error", test.name)
+		}
+	}
+}
+
+func Test_CertAuthRequiresClientCertificate(t *testing.T) {
+	config := NewConfig()
+	config.ClientCert = ""
+	config.ClientKey = ""
+	if _, err := NewClient(config, &CertAuth{}); err == nil {
+		t.Fatal("Expected an error without client certificate")
+	}
+}
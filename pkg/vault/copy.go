@@ -0,0 +1,196 @@
+// Copyright (C) 2018 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/golang/glog"
+
+	pkgalan "github.com/nlamirault/alan/pkg/alan"
+)
+
+// Copy copies a secret, or all the secrets of a folder, to another path, with
+// their attachments and the markers of the empty groups. A copied secret is
+// renamed after the last element of its new path. Existing secrets are only
+// overwritten using force. It returns the paths of the copied secrets.
+func (client *Client) Copy(from string, to string, force bool) ([]string, error) {
+	return client.copy(from, to, false, force)
+}
+
+// Move moves a secret, or all the secrets of a folder, to another path.
+// Existing secrets are only overwritten using force. It returns the paths of
+// the moved secrets.
+func (client *Client) Move(from string, to string, force bool) ([]string, error) {
+	return client.copy(from, to, true, force)
+}
+
+// Remove deletes a secret or, if recursive, all the secrets of a folder and
+// the markers of its empty groups. With destroy, all the versions of the
+// secrets are removed. It returns the paths of the removed secrets.
+func (client *Client) Remove(key string, recursive bool, destroy bool) ([]string, error) {
+	if len(strings.Trim(key, "/")) == 0 {
+		return nil, fmt.Errorf("Missing path")
+	}
+	paths, markers, single, err := client.secretPaths(key)
+	if err != nil {
+		return nil, err
+	}
+	if !single && !recursive {
+		return nil, fmt.Errorf("%s is a folder: use the recursive mode", key)
+	}
+	remove := client.Delete
+	if destroy {
+		remove = client.Destroy
+	}
+	removed := []string{}
+	for _, path := range paths {
+		glog.V(2).Infof("Remove secret: %s", path)
+		if err := remove(path); err != nil {
+			return removed, err
+		}
+		removed = append(removed, path)
+	}
+	for _, marker := range markers {
+		glog.V(2).Infof("Remove group marker: %s", marker)
+		if err := remove(marker); err != nil {
+			return removed, err
+		}
+	}
+	return removed, nil
+}
+
+func (client *Client) copy(from string, to string, move bool, force bool) ([]string, error) {
+	from, to = strings.Trim(from, "/"), strings.Trim(to, "/")
+	if len(from) == 0 || len(to) == 0 {
+		return nil, fmt.Errorf("Missing source or destination path")
+	}
+	if from == to || strings.HasPrefix(to, from+"/") {
+		return nil, fmt.Errorf("Can't copy %s into itself", from)
+	}
+	paths, markers, single, err := client.secretPaths(from)
+	if err != nil {
+		return nil, err
+	}
+	targets := map[string]string{}
+	for _, path := range paths {
+		targets[path] = pkgalan.JoinPath(to, strings.TrimPrefix(path, from+"/"))
+		if single {
+			targets[path] = to
+		}
+		if force {
+			continue
+		}
+		data, _, err := client.readVersion(targets[path], 0)
+		if err != nil {
+			return nil, err
+		}
+		if data != nil {
+			return nil, fmt.Errorf("Secret %s already exists: use the force mode to overwrite it", targets[path])
+		}
+	}
+	copied := []string{}
+	for _, path := range paths {
+		data, info, err := client.readVersion(path, 0)
+		if err != nil {
+			return copied, err
+		}
+		secret, err := client.toSecret(path, data, info)
+		if err != nil {
+			return copied, err
+		}
+		target := targets[path]
+		if single {
+			names := pkgalan.SplitPath(to)
+			secret.Title = pkgalan.UnescapeName(names[len(names)-1])
+		}
+		if !move {
+			secret.UUID = ""
+		}
+		glog.V(2).Infof("Copy secret %s to %s", path, target)
+		if err := client.Write(target, *secret); err != nil {
+			return copied, err
+		}
+		if move {
+			if err := client.Delete(path); err != nil {
+				return copied, err
+			}
+		}
+		copied = append(copied, target)
+	}
+	for _, marker := range markers {
+		target := pkgalan.JoinPath(to, strings.TrimPrefix(marker, from+"/"))
+		_, name := splitKey(strings.TrimSuffix(target, "/"+pkgalan.GroupMarker))
+		glog.V(2).Infof("Copy group marker %s to %s", marker, target)
+		if err := client.Write(target, pkgalan.Secret{Title: name}); err != nil {
+			return copied, err
+		}
+		if move {
+			if err := client.Delete(marker); err != nil {
+				return copied, err
+			}
+		}
+	}
+	return copied, nil
+}
+
+// secretPaths returns the path if it is a secret, or the paths of the
+// existing secrets and group markers of the folder otherwise.
+func (client *Client) secretPaths(key string) ([]string, []string, bool, error) {
+	key = strings.Trim(key, "/")
+	data, _, err := client.readVersion(key, 0)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	if data != nil {
+		return []string{key}, nil, true, nil
+	}
+	// Deleted secrets are still listed by KV version 2
+	exists := func(path string) (bool, error) {
+		data, _, err := client.readVersion(path, 0)
+		return data != nil, err
+	}
+	paths := []string{}
+	markers := []string{}
+	addMarker := func(folder string) error {
+		marker := pkgalan.JoinPath(folder, pkgalan.GroupMarker)
+		ok, err := exists(marker)
+		if ok {
+			markers = append(markers, marker)
+		}
+		return err
+	}
+	if err := addMarker(key); err != nil {
+		return nil, nil, false, err
+	}
+	err = client.Walk(key, func(path string, folder bool, depth int) error {
+		if folder {
+			return addMarker(path)
+		}
+		ok, err := exists(path)
+		if ok {
+			paths = append(paths, path)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, nil, false, err
+	}
+	if len(paths) == 0 && len(markers) == 0 {
+		return nil, nil, false, fmt.Errorf("No secret for path %s", key)
+	}
+	return paths, markers, false, nil
+}
@@ -0,0 +1,100 @@
+// Copyright (C) 2018 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"reflect"
+	"testing"
+
+	pkgalan "github.com/nlamirault/alan/pkg/alan"
+)
+
+func Test_CopyMoveRemove(t *testing.T) {
+	for _, kvVersion := range []int{1, 2} {
+		client, _, stop := newTestClient(t, kvVersion)
+		defer stop()
+
+		for _, title := range []string{"Github", "Gitlab"} {
+			secret := pkgalan.Secret{UUID: title, Title: title, Username: "alan", Password: "turing",
+				Attachments: []pkgalan.Attachment{{Name: "key", Content: []byte("enigma")}}}
+			if err := client.Write("Dev/"+title, secret); err != nil {
+				t.Fatalf("KV v%d: %s", kvVersion, err)
+			}
+		}
+
+		if _, err := client.Copy("Dev", "Dev/Backup", false); err == nil {
+			t.Fatalf("KV v%d: copied a folder into itself", kvVersion)
+		}
+		copied, err := client.Copy("Dev/Github", "Work/GitHub", false)
+		if err != nil || !reflect.DeepEqual(copied, []string{"Work/GitHub"}) {
+			t.Fatalf("KV v%d: invalid copy: %v %v", kvVersion, copied, err)
+		}
+		if copied, err := client.Copy("Dev/Gitlab", "Work/GitHub", false); err == nil || len(copied) != 0 {
+			t.Fatalf("KV v%d: overwritten without force: %v", kvVersion, copied)
+		}
+		if _, err := client.Move("Dev/Gitlab", "Dev/Github", false); err == nil {
+			t.Fatalf("KV v%d: moved over an existing secret without force", kvVersion)
+		}
+		if secret, err := client.ReadSecret("Dev/Gitlab"); err != nil || secret.Title != "Gitlab" {
+			t.Fatalf("KV v%d: secret moved: %#v %v", kvVersion, secret, err)
+		}
+		secret, err := client.ReadSecret("Work/GitHub")
+		if err != nil || secret.Title != "GitHub" || secret.Password != "turing" || len(secret.UUID) != 0 ||
+			len(secret.Attachments) != 1 || string(secret.Attachments[0].Content) != "enigma" {
+			t.Fatalf("KV v%d: invalid copied secret: %#v %v", kvVersion, secret, err)
+		}
+
+		if _, err := client.Copy("Dev/Gitlab", "Work/GitHub", true); err != nil {
+			t.Fatalf("KV v%d: %s", kvVersion, err)
+		}
+		if secret, err := client.ReadSecret("Work/GitHub"); err != nil || secret.Title != "GitHub" {
+			t.Fatalf("KV v%d: invalid overwritten secret: %#v %v", kvVersion, secret, err)
+		}
+
+		if err := client.Write("Dev/Empty/"+pkgalan.GroupMarker, pkgalan.Secret{Title: "Empty"}); err != nil {
+			t.Fatalf("KV v%d: %s", kvVersion, err)
+		}
+		moved, err := client.Move("Dev", "Archive/Dev", false)
+		if err != nil || !reflect.DeepEqual(moved, []string{"Archive/Dev/Github", "Archive/Dev/Gitlab"}) {
+			t.Fatalf("KV v%d: invalid move: %v %v", kvVersion, moved, err)
+		}
+		if secret, err := client.ReadSecret("Archive/Dev/Gitlab"); err != nil || secret.UUID != "Gitlab" {
+			t.Fatalf("KV v%d: invalid moved secret: %#v %v", kvVersion, secret, err)
+		}
+		if _, err := client.ReadSecret("Dev/Github"); err == nil {
+			t.Fatalf("KV v%d: secret not moved", kvVersion)
+		}
+		if _, err := client.ReadSecret("Dev/Empty/" + pkgalan.GroupMarker); err == nil {
+			t.Fatalf("KV v%d: group marker not moved", kvVersion)
+		}
+		if secret, err := client.ReadSecret("Archive/Dev/Empty/" + pkgalan.GroupMarker); err != nil || secret.Title != "Empty" {
+			t.Fatalf("KV v%d: invalid moved group marker: %#v %v", kvVersion, secret, err)
+		}
+
+		if _, err := client.Remove("Archive", false, false); err == nil {
+			t.Fatalf("KV v%d: removed a folder without the recursive mode", kvVersion)
+		}
+		removed, err := client.Remove("Archive", true, true)
+		if err != nil || len(removed) != 2 {
+			t.Fatalf("KV v%d: invalid remove: %v %v", kvVersion, removed, err)
+		}
+		if _, err := client.ReadSecret("Archive/Dev/Empty/" + pkgalan.GroupMarker); err == nil {
+			t.Fatalf("KV v%d: group marker not removed", kvVersion)
+		}
+		if _, err := client.Remove("Archive", true, false); err == nil {
+			t.Fatalf("KV v%d: removed a missing folder", kvVersion)
+		}
+	}
+}
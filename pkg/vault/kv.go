@@ -0,0 +1,208 @@
+// Copyright (C) 2018 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/golang/glog"
+
+	pkgalan "github.com/nlamirault/alan/pkg/alan"
+)
+
+// SecretVersion describe a version of a secret into a KV version 2 secrets engine
+type SecretVersion struct {
+	Version      int
+	CreatedTime  time.Time
+	DeletionTime time.Time
+	Destroyed    bool
+}
+
+// SecretMetadata describe the metadata of a secret into a KV version 2 secrets engine
+type SecretMetadata struct {
+	CurrentVersion int
+	CreatedTime    time.Time
+	UpdatedTime    time.Time
+	Versions       []SecretVersion
+}
+
+// Metadata retrieve the metadata of a secret.
+// It returns nil if the secret doesn't exist.
+func (client *Client) Metadata(key string) (*SecretMetadata, error) {
+	glog.V(2).Infof("Read secret metadata: %s", key)
+	kvVersion, err := client.kvVersion()
+	if err != nil {
+		return nil, err
+	}
+	if kvVersion != 2 {
+		return nil, fmt.Errorf("Secret metadata requires a KV version 2 secrets engine")
+	}
+	secret, err := client.vault.Logical().Read(client.metadataPath(key))
+	if err != nil {
+		return nil, err
+	}
+	if secret == nil {
+		return nil, nil
+	}
+	return parseMetadata(secret.Data)
+}
+
+// History retrieve all versions of a secret, the most recent first
+func (client *Client) History(key string) ([]SecretVersion, error) {
+	metadata, err := client.Metadata(key)
+	if err != nil {
+		return nil, err
+	}
+	if metadata == nil {
+		return nil, fmt.Errorf("No secret for path %s", key)
+	}
+	return metadata.Versions, nil
+}
+
+// KVVersion returns the version of the KV secrets engine used
+func (client *Client) KVVersion() (int, error) {
+	return client.kvVersion()
+}
+
+func (client *Client) kvVersion() (int, error) {
+	if client.kvversion > 0 {
+		return client.kvversion, nil
+	}
+	options, err := client.mountOptions()
+	if err != nil {
+		return 0, err
+	}
+	client.kvversion = 1
+	if options["version"] == "2" {
+		client.kvversion = 2
+	}
+	glog.V(2).Infof("KV secrets engine version for %s: %d", client.mount, client.kvversion)
+	return client.kvversion, nil
+}
+
+// mountOptions retrieve the options of the mount using sys/mounts, or the
+// UI endpoint which doesn't requires a privileged token
+func (client *Client) mountOptions() (map[string]string, error) {
+	mounts, err := client.vault.Sys().ListMounts()
+	if err == nil {
+		mount, ok := mounts[client.mount+"/"]
+		if !ok {
+			return nil, fmt.Errorf("No secrets engine mounted at %s", client.mount)
+		}
+		return mount.Options, nil
+	}
+	glog.V(2).Infof("Can't list mounts: %s", err)
+	secret, err := client.vault.Logical().Read(fmt.Sprintf("sys/internal/ui/mounts/%s", client.mount))
+	if err != nil {
+		return nil, err
+	}
+	if secret == nil {
+		return nil, fmt.Errorf("No secrets engine mounted at %s", client.mount)
+	}
+	options := map[string]string{}
+	if data, ok := secret.Data["options"].(map[string]interface{}); ok {
+		for key, value := range data {
+			options[key] = fmt.Sprintf("%v", value)
+		}
+	}
+	return options, nil
+}
+
+func (client *Client) dataPath(key string) (string, error) {
+	kvVersion, err := client.kvVersion()
+	if err != nil {
+		return "", err
+	}
+	if kvVersion == 2 {
+		return pkgalan.JoinPath(client.mount, "data", client.prefix, key), nil
+	}
+	return pkgalan.JoinPath(client.mount, client.prefix, key), nil
+}
+
+func (client *Client) listPath(key string) (string, error) {
+	kvVersion, err := client.kvVersion()
+	if err != nil {
+		return "", err
+	}
+	if kvVersion == 2 {
+		return pkgalan.JoinPath(client.mount, "metadata", client.prefix, key), nil
+	}
+	return pkgalan.JoinPath(client.mount, client.prefix, key), nil
+}
+
+func (client *Client) metadataPath(key string) string {
+	return pkgalan.JoinPath(client.mount, "metadata", client.prefix, key)
+}
+
+func parseMetadata(data map[string]interface{}) (*SecretMetadata, error) {
+	metadata := &SecretMetadata{}
+	var err error
+	if metadata.CurrentVersion, err = toInt(data["current_version"]); err != nil {
+		return nil, err
+	}
+	metadata.CreatedTime = toTime(data["created_time"])
+	metadata.UpdatedTime = toTime(data["updated_time"])
+	versions, _ := data["versions"].(map[string]interface{})
+	for key, value := range versions {
+		number, err := strconv.Atoi(key)
+		if err != nil {
+			return nil, err
+		}
+		info, _ := value.(map[string]interface{})
+		destroyed, _ := info["destroyed"].(bool)
+		metadata.Versions = append(metadata.Versions, SecretVersion{
+			Version:      number,
+			CreatedTime:  toTime(info["created_time"]),
+			DeletionTime: toTime(info["deletion_time"]),
+			Destroyed:    destroyed,
+		})
+	}
+	sort.Slice(metadata.Versions, func(i, j int) bool {
+		return metadata.Versions[i].Version > metadata.Versions[j].Version
+	})
+	return metadata, nil
+}
+
+func toInt(value interface{}) (int, error) {
+	switch v := value.(type) {
+	case nil:
+		return 0, nil
+	case json.Number:
+		n, err := v.Int64()
+		return int(n), err
+	case float64:
+		return int(v), nil
+	case int:
+		return v, nil
+	}
+	return 0, fmt.Errorf("Invalid number: %v", value)
+}
+
+func toTime(value interface{}) time.Time {
+	text, ok := value.(string)
+	if !ok || len(text) == 0 {
+		return time.Time{}
+	}
+	t, err := time.Parse(time.RFC3339Nano, text)
+	if err != nil {
+		glog.V(2).Infof("Invalid time %s: %s", text, err)
+		return time.Time{}
+	}
+	return t
+}
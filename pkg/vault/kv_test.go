@@ -0,0 +1,270 @@
+// Copyright (C) 2018 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	pkgalan "github.com/nlamirault/alan/pkg/alan"
+)
+
+func Test_ReadWriteKVVersions(t *testing.T) {
+	for _, kvVersion := range []int{1, 2} {
+		client, kv, stop := newTestClient(t, kvVersion)
+		defer stop()
+
+		secret := pkgalan.Secret{Title: "Github", Username: "alan", Password: "turing", URL: "https://github.com"}
+		if err := client.Write("Dev/Github", secret); err != nil {
+			t.Fatalf("KV v%d: %s", kvVersion, err)
+		}
+		if _, ok := kv.secrets["alan/Dev/Github"]; !ok {
+			t.Fatalf("KV v%d: secret not stored under prefix: %v", kvVersion, kv.secrets)
+		}
+		data, err := client.Read("Dev/Github")
+		if err != nil {
+			t.Fatalf("KV v%d: %s", kvVersion, err)
+		}
+		if data[pkgalan.Password] != "turing" {
+			t.Fatalf("KV v%d: invalid secret: %v", kvVersion, data)
+		}
+		keys, err := client.List("Dev")
+		if err != nil {
+			t.Fatalf("KV v%d: %s", kvVersion, err)
+		}
+		if len(keys["keys"].([]interface{})) != 1 {
+			t.Fatalf("KV v%d: invalid keys: %v", kvVersion, keys)
+		}
+	}
+}
+
+func Test_KV2VersionsAndCheckAndSet(t *testing.T) {
+	client, _, stop := newTestClient(t, 2)
+	defer stop()
+
+	if err := client.WriteCAS("Dev/Github", pkgalan.Secret{Title: "Github", Password: "one"}, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.WriteCAS("Dev/Github", pkgalan.Secret{Title: "Github", Password: "two"}, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.WriteCAS("Dev/Github", pkgalan.Secret{Title: "Github", Password: "three"}, 1); err == nil {
+		t.Fatal("Expected a check-and-set error")
+	}
+
+	data, err := client.ReadVersion("Dev/Github", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data[pkgalan.Password] != "one" {
+		t.Fatalf("Invalid first version: %v", data)
+	}
+	versions, err := client.History("Dev/Github")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 2 || versions[0].Version != 2 {
+		t.Fatalf("Invalid history: %v", versions)
+	}
+}
+
+func Test_NotesAndCustomFields(t *testing.T) {
+	client, _, stop := newTestClient(t, 2)
+	defer stop()
+
+	secret := pkgalan.Secret{
+		Title: "AWS",
+		Notes: "Root account",
+		Fields: []pkgalan.Field{
+			{Name: "API key", Value: "AKIA"},
+			{Name: "Recovery codes", Value: "1234 5678", Protected: true},
+		},
+	}
+	if err := client.Write("Cloud/AWS", secret); err != nil {
+		t.Fatal(err)
+	}
+	result, err := client.ReadSecret("Cloud/AWS")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Notes != secret.Notes || len(result.Fields) != 2 {
+		t.Fatalf("Invalid secret: %#v", result)
+	}
+	for i, field := range secret.Fields {
+		if result.Fields[i] != field {
+			t.Fatalf("Invalid field %d: %#v", i, result.Fields[i])
+		}
+	}
+}
+
+func Test_Attachments(t *testing.T) {
+	client, kv, stop := newTestClient(t, 2)
+	defer stop()
+	defer func(size int) { MaxChunkSize = size }(MaxChunkSize)
+	MaxChunkSize = 4
+
+	secret := pkgalan.Secret{
+		Title: "Server",
+		Attachments: []pkgalan.Attachment{
+			{Name: "id_rsa.pub", Content: []byte("ssh")},
+			{Name: "license.txt", Content: []byte("0123456789")},
+		},
+	}
+	if err := client.Write("Infra/Server", secret); err != nil {
+		t.Fatal(err)
+	}
+	if chunks := attachmentKeys(kv); len(chunks) != 3 {
+		t.Fatalf("Invalid attachment chunks: %v", chunks)
+	}
+	result, err := client.ReadSecret("Infra/Server")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Attachments) != 2 {
+		t.Fatalf("Invalid attachments: %#v", result.Attachments)
+	}
+	for i, attachment := range secret.Attachments {
+		if result.Attachments[i].Name != attachment.Name || string(result.Attachments[i].Content) != string(attachment.Content) {
+			t.Fatalf("Invalid attachment %d: %#v", i, result.Attachments[i])
+		}
+	}
+}
+
+func Test_AttachmentsUpdate(t *testing.T) {
+	for _, kvVersion := range []int{1, 2} {
+		client, kv, stop := newTestClient(t, kvVersion)
+		defer stop()
+		defer func(size int) { MaxChunkSize = size }(MaxChunkSize)
+		MaxChunkSize = 4
+
+		// the attachments fit one by one, but not together
+		secret := pkgalan.Secret{
+			Title: "Server",
+			Attachments: []pkgalan.Attachment{
+				{Name: "id_rsa.pub", Content: []byte("ssh")},
+				{Name: "id_rsa", Content: []byte("rsa")},
+				{Name: "license.txt", Content: []byte("0123456789")},
+			},
+		}
+		if err := client.Write("Infra/Server", secret); err != nil {
+			t.Fatal(err)
+		}
+		if chunks := attachmentKeys(kv); len(chunks) != 4 {
+			t.Fatalf("KV v%d: invalid attachment chunks: %v", kvVersion, chunks)
+		}
+
+		// without versions, the chunks of the previous attachments are deleted
+		secret.Attachments = []pkgalan.Attachment{
+			{Name: "id_rsa.pub", Content: []byte("ssh")},
+			{Name: "license.txt", Content: []byte("01234")},
+		}
+		if err := client.Write("Infra/Server", secret); err != nil {
+			t.Fatal(err)
+		}
+		expected := map[int]int{1: 2, 2: 6}[kvVersion]
+		if chunks := attachmentKeys(kv); len(chunks) != expected {
+			t.Fatalf("KV v%d: invalid attachment chunks: %v", kvVersion, chunks)
+		}
+		result, err := client.ReadSecret("Infra/Server")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(result.Attachments) != 2 || string(result.Attachments[1].Content) != "01234" {
+			t.Fatalf("KV v%d: invalid attachments: %#v", kvVersion, result.Attachments)
+		}
+
+		secret.Attachments = nil
+		if err := client.Write("Infra/Server", secret); err != nil {
+			t.Fatal(err)
+		}
+		if err := client.Destroy("Infra/Server"); err != nil {
+			t.Fatal(err)
+		}
+		if chunks := attachmentKeys(kv); len(chunks) != 0 {
+			t.Fatalf("KV v%d: attachment chunks left: %v", kvVersion, chunks)
+		}
+	}
+}
+
+func Test_AttachmentsVersions(t *testing.T) {
+	client, _, stop := newTestClient(t, 2)
+	defer stop()
+	defer func(size int) { MaxChunkSize = size }(MaxChunkSize)
+	MaxChunkSize = 4
+
+	for _, content := range []string{"first license", "second license"} {
+		secret := pkgalan.Secret{
+			Title:       "Server",
+			Attachments: []pkgalan.Attachment{{Name: "license.txt", Content: []byte(content)}},
+		}
+		if err := client.Write("Infra/Server", secret); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for version, expected := range map[int]string{1: "first license", 2: "second license"} {
+		secret, err := client.ReadSecretVersion("Infra/Server", version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(secret.Attachments) != 1 || string(secret.Attachments[0].Content) != expected {
+			t.Fatalf("Invalid attachments of version %d: %#v", version, secret.Attachments)
+		}
+	}
+}
+
+func Test_AttachmentsCheckAndSetConflict(t *testing.T) {
+	client, kv, stop := newTestClient(t, 2)
+	defer stop()
+	defer func(size int) { MaxChunkSize = size }(MaxChunkSize)
+	MaxChunkSize = 4
+
+	secret := pkgalan.Secret{
+		Title:       "Server",
+		Attachments: []pkgalan.Attachment{{Name: "license.txt", Content: []byte("teammate")}},
+	}
+	if err := client.WriteCAS("Infra/Server", secret, 0); err != nil {
+		t.Fatal(err)
+	}
+	chunks := attachmentKeys(kv)
+	secret.Attachments[0].Content = []byte("rejected")
+	if err := client.WriteCAS("Infra/Server", secret, 0); err == nil {
+		t.Fatal("Expected a check-and-set error")
+	}
+	if left := attachmentKeys(kv); strings.Join(left, ",") != strings.Join(chunks, ",") {
+		t.Fatalf("Invalid attachment chunks after the conflict: %v, expected %v", left, chunks)
+	}
+	result, err := client.ReadSecret("Infra/Server")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(result.Attachments[0].Content) != "teammate" {
+		t.Fatalf("Invalid attachment: %s", result.Attachments[0].Content)
+	}
+}
+
+// attachmentKeys returns the sorted keys of the attachment chunks
+func attachmentKeys(kv *fakeKV) []string {
+	kv.Lock()
+	defer kv.Unlock()
+	keys := []string{}
+	for key := range kv.secrets {
+		if strings.Contains(key, pkgalan.AttachmentsFolder) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,97 @@
+// Copyright (C) 2018 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/golang/glog"
+)
+
+// PrefixData define the values available into the prefix template.
+// They are retrieved from the Vault token used by the client.
+type PrefixData struct {
+	// Username is the login name of the token (userpass and ldap methods),
+	// or its display name
+	Username string
+	// DisplayName is the display name of the token
+	DisplayName string
+	// EntityID is the identifier of the identity entity of the token
+	EntityID string
+	// EntityName is the name of the identity entity of the token
+	EntityName string
+}
+
+// resolvePrefix renders the prefix template using the token informations
+func (client *Client) resolvePrefix() error {
+	if !strings.Contains(client.prefix, "{{") {
+		return nil
+	}
+	tmpl, err := template.New("prefix").Option("missingkey=error").Parse(client.prefix)
+	if err != nil {
+		return fmt.Errorf("Invalid prefix template %s: %s", client.prefix, err)
+	}
+	data, err := client.prefixData(strings.Contains(client.prefix, ".EntityName"))
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return fmt.Errorf("Invalid prefix template %s: %s", client.prefix, err)
+	}
+	prefix := strings.Trim(buf.String(), "/")
+	if strings.Contains(prefix, "//") || len(prefix) == 0 {
+		return fmt.Errorf("Invalid prefix %s from template %s", prefix, client.prefix)
+	}
+	glog.V(1).Infof("Use prefix: %s", prefix)
+	client.prefix = prefix
+	return nil
+}
+
+func (client *Client) prefixData(withEntity bool) (*PrefixData, error) {
+	secret, err := client.vault.Auth().Token().LookupSelf()
+	if err != nil {
+		return nil, err
+	}
+	if secret == nil {
+		return nil, fmt.Errorf("Can't retrieve token informations")
+	}
+	data := &PrefixData{}
+	data.DisplayName, _ = secret.Data["display_name"].(string)
+	data.EntityID, _ = secret.Data["entity_id"].(string)
+	if meta, ok := secret.Data["meta"].(map[string]interface{}); ok {
+		data.Username, _ = meta["username"].(string)
+	}
+	if len(data.Username) == 0 {
+		data.Username = data.DisplayName
+	}
+	if withEntity {
+		if len(data.EntityID) == 0 {
+			return nil, fmt.Errorf("No identity entity for the token")
+		}
+		entity, err := client.vault.Logical().Read(fmt.Sprintf("identity/entity/id/%s", data.EntityID))
+		if err != nil {
+			return nil, err
+		}
+		if entity == nil {
+			return nil, fmt.Errorf("Can't read identity entity %s", data.EntityID)
+		}
+		data.EntityName, _ = entity.Data["name"].(string)
+	}
+	return data, nil
+}
@@ -0,0 +1,61 @@
+// Copyright (C) 2018 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	pkgalan "github.com/nlamirault/alan/pkg/alan"
+)
+
+func Test_PrefixTemplate(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/auth/token/lookup-self":
+			fmt.Fprint(w, `{"data":{"display_name":"userpass-alan","entity_id":"e1","meta":{"username":"alan"}}}`)
+		case "/v1/identity/entity/id/e1":
+			fmt.Fprint(w, `{"data":{"name":"alan.turing"}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	tests := map[string]string{
+		"infra/passwords":                 "infra/passwords",
+		"users/{{.Username}}":             "users/alan",
+		"/users/{{.EntityName}}/secrets/": "users/alan.turing/secrets",
+	}
+	for prefix, expected := range tests {
+		config := NewConfig()
+		config.Address = server.URL
+		config.Mount = "team-kv"
+		config.Prefix = prefix
+		client, err := NewClient(config, &TokenAuth{Token: "test"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		client.vault.SetToken("test")
+		if err := client.resolvePrefix(); err != nil {
+			t.Fatalf("%s: %s", prefix, err)
+		}
+		if path := pkgalan.JoinPath(client.Mount(), "data", client.Prefix(), "Dev/Github"); path != fmt.Sprintf("team-kv/data/%s/Dev/Github", expected) {
+			t.Fatalf("%s: invalid path %s", prefix, path)
+		}
+	}
+}
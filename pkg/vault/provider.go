@@ -0,0 +1,211 @@
+// Copyright (C) 2018 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/golang/glog"
+
+	pkgalan "github.com/nlamirault/alan/pkg/alan"
+)
+
+// Provider exposes the Vault secrets as a password manager storage
+type Provider struct {
+	client   *Client
+	cas      bool
+	recycled []pkgalan.RecycledSecret
+	// versions are the versions of the secrets when they were read
+	versions map[string]int
+}
+
+// NewProvider creates a provider using the Vault client.
+// Using check-and-set, writes fail if a secret is modified by someone else
+// since it was loaded or read.
+func NewProvider(client *Client, cas bool) *Provider {
+	return &Provider{
+		client:   client,
+		cas:      cas,
+		versions: map[string]int{},
+	}
+}
+
+// Open performs authentication with the Vault server
+func (provider *Provider) Open() error {
+	return provider.client.Login()
+}
+
+// Load returns the tree of the secrets under the prefix.
+// Deleted secrets of a KV version 2 secrets engine are kept as recycled.
+func (provider *Provider) Load() (*pkgalan.Group, error) {
+	provider.recycled = []pkgalan.RecycledSecret{}
+	tree := &pkgalan.Group{Name: "Root"}
+	if err := provider.client.loadGroup(tree, &provider.recycled, provider.versions); err != nil {
+		return nil, err
+	}
+	for _, recycled := range provider.recycled {
+		if err := provider.recordMissing(recycled.Path); err != nil {
+			return nil, err
+		}
+	}
+	return tree, nil
+}
+
+// Recycled returns the deleted secrets found by Load
+func (provider *Provider) Recycled() []pkgalan.RecycledSecret {
+	return provider.recycled
+}
+
+// Recycle deletes a secret. Using a KV version 2 secrets engine, its versions
+// are kept and it can be restored.
+func (provider *Provider) Recycle(path string) error {
+	return provider.client.Delete(path)
+}
+
+// Read retrieve a secret, or nil if it doesn't exist
+func (provider *Provider) Read(path string) (*pkgalan.Secret, error) {
+	data, info, err := provider.client.readVersion(path, 0)
+	if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		return nil, provider.recordMissing(path)
+	}
+	if info != nil {
+		provider.versions[path] = info.Version
+	}
+	return provider.client.toSecret(path, data, info)
+}
+
+// recordMissing keeps the version of a secret which doesn't exist, or which
+// was deleted, for the check-and-set writes
+func (provider *Provider) recordMissing(path string) error {
+	if !provider.cas {
+		return nil
+	}
+	metadata, err := provider.client.Metadata(path)
+	if err != nil {
+		return err
+	}
+	provider.versions[path] = 0
+	if metadata != nil {
+		provider.versions[path] = metadata.CurrentVersion
+	}
+	return nil
+}
+
+// Write stores a secret. Using check-and-set, the secret must still have the
+// version it had when it was loaded or read, and a secret never read must
+// not exist.
+func (provider *Provider) Write(path string, secret pkgalan.Secret) error {
+	if !provider.cas {
+		return provider.client.Write(path, secret)
+	}
+	version := provider.versions[path]
+	if err := provider.client.WriteCAS(path, secret, version); err != nil {
+		if strings.Contains(err.Error(), "check-and-set") {
+			return fmt.Errorf("Conflict on secret %s: modified since version %d was read", path, version)
+		}
+		return fmt.Errorf("Can't write secret %s: %s", path, err)
+	}
+	provider.versions[path] = version + 1
+	return nil
+}
+
+// Version returns the current version of a secret, 0 on a KV version 1 secrets engine
+func (provider *Provider) Version(path string) (int, error) {
+	kvVersion, err := provider.client.kvVersion()
+	if err != nil || kvVersion != 2 {
+		return 0, err
+	}
+	metadata, err := provider.client.Metadata(path)
+	if err != nil || metadata == nil {
+		return 0, err
+	}
+	return metadata.CurrentVersion, nil
+}
+
+// Delete removes a secret, with all its versions
+func (provider *Provider) Delete(path string) error {
+	if err := provider.client.Destroy(path); err != nil {
+		return err
+	}
+	delete(provider.versions, path)
+	return nil
+}
+
+// CreateGroup keeps an empty group using a marker secret
+func (provider *Provider) CreateGroup(path string) error {
+	names := pkgalan.SplitPath(path)
+	if len(names) == 0 {
+		return nil
+	}
+	return provider.Write(pkgalan.JoinPath(path, pkgalan.GroupMarker), pkgalan.Secret{Title: names[len(names)-1]})
+}
+
+// Close does nothing, secrets are written immediately
+func (provider *Provider) Close() error {
+	return nil
+}
+
+// Load returns the tree of the secrets and the folders under the prefix
+func (client *Client) Load() (*pkgalan.Group, error) {
+	tree := &pkgalan.Group{Name: "Root"}
+	if err := client.loadGroup(tree, nil, nil); err != nil {
+		return nil, err
+	}
+	return tree, nil
+}
+
+// loadGroup loads recursively the secrets and the folders under the Vault path of the group.
+// Deleted secrets are added to recycled, and the versions of the secrets to versions, if not nil.
+func (client *Client) loadGroup(group *pkgalan.Group, recycled *[]pkgalan.RecycledSecret, versions map[string]int) error {
+	glog.V(2).Infof("Analyse Vault group: %s", group.Path)
+	groups := map[string]*pkgalan.Group{group.Path: group}
+	return client.Walk(group.Path, func(path string, folder bool, depth int) error {
+		parentPath, name := splitKey(path)
+		parent := groups[parentPath]
+		if folder {
+			subgroup := pkgalan.NewGroup(parent.Path, name)
+			parent.Groups = append(parent.Groups, subgroup)
+			groups[path] = subgroup
+			return nil
+		}
+		glog.V(2).Infof("Secret for: %s", path)
+		data, info, err := client.readVersion(path, 0)
+		if err != nil {
+			return err
+		}
+		// Deleted secrets are still listed by KV version 2
+		if data == nil {
+			if recycled != nil {
+				*recycled = append(*recycled, pkgalan.RecycledSecret{Path: path})
+			}
+			return nil
+		}
+		if versions != nil && info != nil {
+			versions[path] = info.Version
+		}
+		secret, err := client.toSecret(path, data, info)
+		if err != nil {
+			return err
+		}
+		if len(secret.Title) > 0 {
+			parent.Secrets = append(parent.Secrets, *secret)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,140 @@
+// Copyright (C) 2018 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"strings"
+	"testing"
+
+	pkgalan "github.com/nlamirault/alan/pkg/alan"
+)
+
+func Test_Provider(t *testing.T) {
+	for _, kvVersion := range []int{1, 2} {
+		client, _, stop := newTestClient(t, kvVersion)
+		defer stop()
+
+		provider := NewProvider(client, kvVersion == 2)
+		if err := provider.Write("Dev/Github", pkgalan.Secret{Title: "Github", Password: "turing"}); err != nil {
+			t.Fatalf("KV v%d: %s", kvVersion, err)
+		}
+		if err := provider.Write("Dev/Gitlab", pkgalan.Secret{Title: "Gitlab", Password: "enigma"}); err != nil {
+			t.Fatalf("KV v%d: %s", kvVersion, err)
+		}
+		if err := provider.Write("Dev/Github", pkgalan.Secret{Title: "Github", Password: "bombe"}); err != nil {
+			t.Fatalf("KV v%d: %s", kvVersion, err)
+		}
+		if version, err := provider.Version("Dev/Github"); err != nil || version != 2*(kvVersion-1) {
+			t.Fatalf("KV v%d: invalid version %d %v", kvVersion, version, err)
+		}
+		if err := provider.CreateGroup("Work/Empty"); err != nil {
+			t.Fatalf("KV v%d: %s", kvVersion, err)
+		}
+		if err := provider.Delete("Dev/Gitlab"); err != nil {
+			t.Fatalf("KV v%d: %s", kvVersion, err)
+		}
+		if secret, err := provider.Read("Dev/Gitlab"); err != nil || secret != nil {
+			t.Fatalf("KV v%d: deleted secret: %#v %v", kvVersion, secret, err)
+		}
+
+		tree, err := provider.Load()
+		if err != nil {
+			t.Fatalf("KV v%d: %s", kvVersion, err)
+		}
+		groups, secrets := tree.Index()
+		if len(secrets) != 1 || secrets["Dev/Github"].Password != "bombe" {
+			t.Fatalf("KV v%d: invalid secrets: %v", kvVersion, secrets)
+		}
+		if group, ok := groups["Work/Empty"]; !ok || !group.IsEmpty() {
+			t.Fatalf("KV v%d: invalid groups: %v", kvVersion, groups)
+		}
+	}
+}
+
+func Test_ProviderRecycle(t *testing.T) {
+	client, kv, stop := newTestClient(t, 2)
+	defer stop()
+
+	provider := NewProvider(client, false)
+	for _, title := range []string{"Github", "Gitlab"} {
+		if err := provider.Write("Dev/"+title, pkgalan.Secret{Title: title}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := provider.Recycle("Dev/Github"); err != nil {
+		t.Fatal(err)
+	}
+	if err := provider.Delete("Dev/Gitlab"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := kv.secrets["alan/Dev/Gitlab"]; ok {
+		t.Fatalf("Secret versions not destroyed: %v", kv.secrets)
+	}
+	tree, err := provider.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, secrets := tree.Index(); len(secrets) != 0 {
+		t.Fatalf("Deleted secrets loaded: %v", secrets)
+	}
+	recycled := provider.Recycled()
+	if len(recycled) != 1 || recycled[0].Path != "Dev/Github" {
+		t.Fatalf("Invalid recycled secrets: %v", recycled)
+	}
+}
+
+func Test_ProviderCheckAndSet(t *testing.T) {
+	client, _, stop := newTestClient(t, 2)
+	defer stop()
+
+	provider := NewProvider(client, true)
+	if err := provider.Write("Dev/Github", pkgalan.Secret{Title: "Github", Password: "turing"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := provider.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if secret, err := provider.Read("Dev/Gitlab"); err != nil || secret != nil {
+		t.Fatalf("Invalid secret: %v %v", secret, err)
+	}
+
+	// a teammate modifies the secrets meanwhile
+	teammate := NewProvider(client, true)
+	if _, err := teammate.Read("Dev/Github"); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"Dev/Github", "Dev/Gitlab"} {
+		if err := teammate.Write(path, pkgalan.Secret{Title: path, Password: "enigma"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, path := range []string{"Dev/Github", "Dev/Gitlab"} {
+		err := provider.Write(path, pkgalan.Secret{Title: path, Password: "bombe"})
+		if err == nil || !strings.Contains(err.Error(), "Conflict") {
+			t.Fatalf("Expected a conflict on %s: %v", path, err)
+		}
+		if secret, _ := client.ReadSecret(path); secret.Password != "enigma" {
+			t.Fatalf("Concurrent change overwritten: %v", secret)
+		}
+	}
+	// once read again, the secret can be written
+	if _, err := provider.Read("Dev/Github"); err != nil {
+		t.Fatal(err)
+	}
+	if err := provider.Write("Dev/Github", pkgalan.Secret{Title: "Github", Password: "bombe"}); err != nil {
+		t.Fatal(err)
+	}
+}
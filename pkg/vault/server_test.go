@@ -0,0 +1,226 @@
+// Copyright (C) 2018 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeVersion struct {
+	data    map[string]interface{}
+	created time.Time
+	deleted time.Time
+}
+
+// fakeKV is an in-memory KV secrets engine mounted at "secret/"
+type fakeKV struct {
+	sync.Mutex
+	version int
+	secrets map[string][]*fakeVersion
+}
+
+func newFakeKV(version int) *fakeKV {
+	return &fakeKV{
+		version: version,
+		secrets: map[string][]*fakeVersion{},
+	}
+}
+
+func (kv *fakeKV) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	kv.Lock()
+	defer kv.Unlock()
+
+	path := strings.TrimPrefix(r.URL.Path, "/v1/")
+	if path == "sys/mounts" {
+		fmt.Fprintf(w, `{"secret/":{"type":"kv","options":{"version":"%d"}}}`, kv.version)
+		return
+	}
+	if !strings.HasPrefix(path, "secret/") {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	path = strings.TrimPrefix(path, "secret/")
+	body := map[string]interface{}{}
+	json.NewDecoder(r.Body).Decode(&body)
+
+	if kv.version == 1 {
+		kv.serveV1(w, r, path, body)
+		return
+	}
+	switch {
+	case strings.HasPrefix(path, "data/"):
+		kv.serveData(w, r, strings.TrimPrefix(path, "data/"), body)
+	case strings.HasPrefix(path, "metadata/"):
+		kv.serveMetadata(w, r, strings.TrimPrefix(path, "metadata/"))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (kv *fakeKV) serveV1(w http.ResponseWriter, r *http.Request, path string, body map[string]interface{}) {
+	switch {
+	case r.URL.Query().Get("list") == "true":
+		kv.list(w, path)
+	case r.Method == "GET":
+		versions := kv.secrets[path]
+		if len(versions) == 0 {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		writeJSON(w, map[string]interface{}{"data": versions[len(versions)-1].data})
+	case r.Method == "PUT":
+		kv.secrets[path] = []*fakeVersion{{data: body, created: time.Now()}}
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == "DELETE":
+		delete(kv.secrets, path)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (kv *fakeKV) serveData(w http.ResponseWriter, r *http.Request, path string, body map[string]interface{}) {
+	versions := kv.secrets[path]
+	switch r.Method {
+	case "GET":
+		index := len(versions) - 1
+		if v := r.URL.Query().Get("version"); len(v) > 0 {
+			index, _ = strconv.Atoi(v)
+			index--
+		}
+		if index < 0 || index >= len(versions) || !versions[index].deleted.IsZero() {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		writeJSON(w, map[string]interface{}{
+			"data": map[string]interface{}{
+				"data": versions[index].data,
+				"metadata": map[string]interface{}{
+					"version":      index + 1,
+					"created_time": versions[index].created.Format(time.RFC3339Nano),
+				},
+			},
+		})
+	case "PUT":
+		if options, ok := body["options"].(map[string]interface{}); ok && options["cas"] != nil {
+			if int(options["cas"].(float64)) != len(versions) {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprint(w, `{"errors":["check-and-set parameter did not match the current version"]}`)
+				return
+			}
+		}
+		data, _ := body["data"].(map[string]interface{})
+		kv.secrets[path] = append(versions, &fakeVersion{data: data, created: time.Now()})
+		writeJSON(w, map[string]interface{}{"data": map[string]interface{}{"version": len(versions) + 1}})
+	case "DELETE":
+		if len(versions) > 0 {
+			versions[len(versions)-1].deleted = time.Now()
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (kv *fakeKV) serveMetadata(w http.ResponseWriter, r *http.Request, path string) {
+	if r.URL.Query().Get("list") == "true" {
+		kv.list(w, path)
+		return
+	}
+	versions := kv.secrets[path]
+	switch r.Method {
+	case "GET":
+		if len(versions) == 0 {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		infos := map[string]interface{}{}
+		for i, version := range versions {
+			deletion := ""
+			if !version.deleted.IsZero() {
+				deletion = version.deleted.Format(time.RFC3339Nano)
+			}
+			infos[strconv.Itoa(i+1)] = map[string]interface{}{
+				"created_time":  version.created.Format(time.RFC3339Nano),
+				"deletion_time": deletion,
+				"destroyed":     false,
+			}
+		}
+		writeJSON(w, map[string]interface{}{
+			"data": map[string]interface{}{
+				"current_version": len(versions),
+				"created_time":    versions[0].created.Format(time.RFC3339Nano),
+				"updated_time":    versions[len(versions)-1].created.Format(time.RFC3339Nano),
+				"versions":        infos,
+			},
+		})
+	case "DELETE":
+		delete(kv.secrets, path)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (kv *fakeKV) list(w http.ResponseWriter, path string) {
+	prefix := strings.Trim(path, "/")
+	if len(prefix) > 0 {
+		prefix += "/"
+	}
+	keys := map[string]bool{}
+	for key := range kv.secrets {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		rest := strings.TrimPrefix(key, prefix)
+		if i := strings.Index(rest, "/"); i >= 0 {
+			keys[rest[:i+1]] = true
+		} else {
+			keys[rest] = true
+		}
+	}
+	if len(keys) == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	result := []string{}
+	for key := range keys {
+		result = append(result, key)
+	}
+	sort.Strings(result)
+	writeJSON(w, map[string]interface{}{"data": map[string]interface{}{"keys": result}})
+}
+
+func writeJSON(w http.ResponseWriter, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(data)
+}
+
+// newTestClient creates a client for a fake KV secrets engine
+func newTestClient(t *testing.T, kvVersion int) (*Client, *fakeKV, func()) {
+	kv := newFakeKV(kvVersion)
+	server := httptest.NewServer(kv)
+	config := NewConfig()
+	config.Address = server.URL
+	client, err := NewClient(config, &TokenAuth{Token: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.vault.SetToken("test")
+	return client, kv, server.Close
+}
@@ -0,0 +1,131 @@
+// Copyright (C) 2018 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/golang/glog"
+
+	pkgalan "github.com/nlamirault/alan/pkg/alan"
+)
+
+// SkipFolder is returned by a WalkFunc to not walk the content of a folder
+var SkipFolder = errors.New("skip this folder")
+
+// WalkFunc is called for each folder and secret under the walked path, with
+// their path relative to the prefix and their depth, starting at 1.
+type WalkFunc func(path string, folder bool, depth int) error
+
+// Walk lists recursively the folders and the secrets under a path, in
+// lexical order. Secrets aren't read: the deleted secrets of a KV version 2
+// secrets engine are walked too.
+func (client *Client) Walk(key string, fn WalkFunc) error {
+	return client.walk(strings.Trim(key, "/"), 1, fn)
+}
+
+func (client *Client) walk(key string, depth int, fn WalkFunc) error {
+	glog.V(2).Infof("Walk Vault path: %s", key)
+	data, err := client.list(key)
+	if err != nil || data == nil {
+		return err
+	}
+	names := []string{}
+	keys, _ := data["keys"].([]interface{})
+	for _, value := range keys {
+		if name, _ := value.(string); !pkgalan.IsReserved(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		path := pkgalan.JoinPath(key, strings.TrimSuffix(name, "/"))
+		if !strings.HasSuffix(name, "/") {
+			if err := fn(path, false, depth); err != nil {
+				return err
+			}
+			continue
+		}
+		switch err := fn(path, true, depth); err {
+		case nil:
+			if err := client.walk(path, depth+1, fn); err != nil {
+				return err
+			}
+		case SkipFolder:
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Folder is a Vault folder, with its secrets and subfolders
+type Folder struct {
+	Name      string    `json:"name"`
+	Path      string    `json:"path"`
+	Count     int       `json:"count"`
+	Truncated bool      `json:"truncated,omitempty"`
+	Secrets   []string  `json:"secrets"`
+	Folders   []*Folder `json:"folders"`
+}
+
+// Tree returns the hierarchy of the folders and the secrets under a path.
+// The folders deeper than depth are not walked, unless depth is 0. Count is
+// the number of secrets of a folder and of its subfolders.
+func (client *Client) Tree(key string, depth int) (*Folder, error) {
+	key = strings.Trim(key, "/")
+	root := &Folder{Name: key, Path: key, Secrets: []string{}, Folders: []*Folder{}}
+	folders := map[string]*Folder{key: root}
+	err := client.Walk(key, func(path string, folder bool, level int) error {
+		parentPath, name := splitKey(path)
+		parent := folders[parentPath]
+		if !folder {
+			parent.Secrets = append(parent.Secrets, name)
+			return nil
+		}
+		child := &Folder{Name: name, Path: path, Secrets: []string{}, Folders: []*Folder{}}
+		parent.Folders = append(parent.Folders, child)
+		folders[path] = child
+		if depth > 0 && level >= depth {
+			child.Truncated = true
+			return SkipFolder
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	root.count()
+	return root, nil
+}
+
+// splitKey returns the path of the parent folder of a walked path, and its unescaped name
+func splitKey(path string) (string, string) {
+	parent, name := "", path
+	if i := strings.LastIndex(path, pkgalan.PathSeparator); i >= 0 {
+		parent, name = path[:i], path[i+1:]
+	}
+	return parent, pkgalan.UnescapeName(name)
+}
+
+func (folder *Folder) count() int {
+	folder.Count = len(folder.Secrets)
+	for _, child := range folder.Folders {
+		folder.Count += child.count()
+	}
+	return folder.Count
+}
@@ -0,0 +1,76 @@
+// Copyright (C) 2018 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"reflect"
+	"testing"
+
+	pkgalan "github.com/nlamirault/alan/pkg/alan"
+)
+
+func Test_Walk(t *testing.T) {
+	for _, kvVersion := range []int{1, 2} {
+		client, _, stop := newTestClient(t, kvVersion)
+		defer stop()
+
+		for _, path := range []string{"Dev/Github", "Dev/Tools/Jenkins", "Social/Twitter", "Mail", "A%2FB/C"} {
+			if err := client.Write(path, pkgalan.Secret{Title: path}); err != nil {
+				t.Fatalf("KV v%d: %s", kvVersion, err)
+			}
+		}
+		walked := []string{}
+		err := client.Walk("", func(path string, folder bool, depth int) error {
+			walked = append(walked, path)
+			if path == "Social" {
+				return SkipFolder
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("KV v%d: %s", kvVersion, err)
+		}
+		expected := []string{"A%2FB", "A%2FB/C", "Dev", "Dev/Github", "Dev/Tools", "Dev/Tools/Jenkins", "Mail", "Social"}
+		if !reflect.DeepEqual(walked, expected) {
+			t.Fatalf("KV v%d: invalid walk: %v", kvVersion, walked)
+		}
+
+		tree, err := client.Tree("", 0)
+		if err != nil {
+			t.Fatalf("KV v%d: %s", kvVersion, err)
+		}
+		if tree.Count != 5 || len(tree.Folders) != 3 || tree.Folders[0].Name != "A/B" || tree.Folders[1].Count != 2 ||
+			!reflect.DeepEqual(tree.Folders[1].Folders[0].Secrets, []string{"Jenkins"}) {
+			t.Fatalf("KV v%d: invalid tree: %#v", kvVersion, tree)
+		}
+		tree, err = client.Tree("Dev", 1)
+		if err != nil {
+			t.Fatalf("KV v%d: %s", kvVersion, err)
+		}
+		if tree.Count != 1 || !tree.Folders[0].Truncated || len(tree.Folders[0].Secrets) != 0 {
+			t.Fatalf("KV v%d: invalid tree: %#v", kvVersion, tree)
+		}
+
+		// Load walks the same hierarchy
+		loaded, err := client.Load()
+		if err != nil {
+			t.Fatalf("KV v%d: %s", kvVersion, err)
+		}
+		groups, secrets := loaded.Index()
+		if len(secrets) != 5 || groups["A%2FB"] == nil || groups["A%2FB"].Name != "A/B" || len(groups["A%2FB"].Secrets) != 1 {
+			t.Fatalf("KV v%d: invalid groups: %v %v", kvVersion, groups, secrets)
+		}
+	}
+}